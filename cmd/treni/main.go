@@ -3,65 +3,106 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 	"time"
 
-	"github.com/emiliopalmerini/treni/internal/api/viaggiatreno"
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/api/provider"
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/punctuality"
+	"github.com/emiliopalmerini/treni/internal/service"
 	"github.com/emiliopalmerini/treni/internal/storage"
-	"github.com/emiliopalmerini/treni/internal/storage/sqlc"
 )
 
+// providerName selects the train data provider, set by --provider or TRENI_PROVIDER
+var providerName = os.Getenv("TRENI_PROVIDER")
+
 func main() {
-	if len(os.Args) < 2 {
+	argv, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(argv) < 1 {
 		printUsage()
 		os.Exit(1)
 	}
 
-	cmd := os.Args[1]
-	args := os.Args[2:]
+	cmd := argv[0]
+	args := argv[1:]
 
 	switch cmd {
 	case "train":
-		if len(args) < 1 {
-			fmt.Fprintln(os.Stderr, "error: train number required")
-			os.Exit(1)
+		where, args := takeFlag(args, "--where")
+		if where {
+			whereCmd(parseTrainArgs(args))
+		} else {
+			trainCmd(parseTrainArgs(args))
 		}
-		trainCmd(args[0])
 	case "station":
+		at, args := takeOption(args, "--at")
 		if len(args) < 1 {
 			fmt.Fprintln(os.Stderr, "error: station code or name required")
 			os.Exit(1)
 		}
-		stationCmd(args[0])
+		stationCmd(args[0], parseBoardTime(at))
 	case "search":
 		if len(args) < 1 {
 			fmt.Fprintln(os.Stderr, "error: search query required")
 			os.Exit(1)
 		}
 		searchCmd(args[0])
+	case "journey":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "error: origin and destination stations required")
+			os.Exit(1)
+		}
+		journeyCmd(args[0], args[1])
 	case "history":
 		if len(args) < 1 {
 			fmt.Fprintln(os.Stderr, "error: train number required")
 			os.Exit(1)
 		}
-		historyCmd(args[0])
+		historyCmd(parseTrainArgs(args[:1]))
 	case "record":
+		recordCmd(parseTrainArgs(args))
+	case "finalize":
+		finalizeCmd()
+	case "snapshot":
 		if len(args) < 1 {
-			fmt.Fprintln(os.Stderr, "error: train number required")
+			fmt.Fprintln(os.Stderr, "error: station code required")
 			os.Exit(1)
 		}
-		recordCmd(args[0])
+		snapshotCmd(args)
+	case "timeline":
+		timelineCmd(parseTrainArgs(args))
 	case "stats":
 		if len(args) < 1 {
 			fmt.Fprintln(os.Stderr, "error: train number required")
 			os.Exit(1)
 		}
-		statsCmd(args[0])
+		if len(args) > 1 {
+			stopStatsCmd(parseTrainArgs(args[:1]), args[1])
+		} else {
+			statsCmd(parseTrainArgs(args[:1]))
+		}
+	case "platforms":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "error: train number and station code required")
+			os.Exit(1)
+		}
+		platformsCmd(parseTrainArgs(args[:1]), args[1])
 	case "top":
 		topCmd(args)
+	case "db":
+		dbCmd(args)
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -75,78 +116,327 @@ func printUsage() {
 	fmt.Println(`treni - Train tracking CLI
 
 Usage:
-  treni <command> [arguments]
+  treni [--provider <name>[,<name>...]] [--output <format>] <command> [arguments]
+
+Options:
+  --provider <name>  Train data provider (see TRENI_PROVIDER)
+  -o, --output <format>
+                     Output format for train, station, search, journey,
+                     history, stats, platforms and top: table (default),
+                     json, csv or tsv
+
+Trains:
+  A train is given by its number. When several trains share the number,
+  add the origin station code, and optionally the departure day:
+  <number>/<origin>[/YYYY-MM-DD]
+
+  train, record and timeline also take --date <YYYY-MM-DD|today|yesterday|tomorrow>
+  to pick the run departing on another day
 
 Commands:
-  train <number>     Get real-time status for a train
-  station <code>     Get arrivals/departures for a station
+  train <train> [--date <day>]  Get real-time status for a train
+  train <train> --where  Show where the train is and when it is expected
+                     at its next stops
+  station <code> [--at <time>]  Get arrivals/departures for a station, now
+                     or at HH:MM (or YYYY-MM-DDTHH:MM), Italian time
   search <query>     Search for stations by name
-  record <number>    Record current train delay to database
-  history <number>   Get historical delays for a train
-  stats <number>     Get statistics for a train
+  journey <from> <to>  Find the next direct trains between two stations
+  record <train> [--date <day>]  Record a train's delay to database; before
+                     the train arrives the record is provisional
+  finalize           Record again the provisional records of the last two
+                     days whose trains have arrived
+  snapshot <station>...  Record every train on the stations' boards; days
+                     without a recorded delay fall back to these
+  history <train>    Get historical delays for a train
+  timeline <train> [--date <day>]  Show how a run's delay evolved along
+                     the journey, as observed while it ran
+  stats <train> [station]  Get statistics for a train, optionally at one station
+  platforms <train> <station>  Show the platforms a train uses at a
+                     station, the most used first
   top [delayed|reliable]  Show top delayed or reliable trains
+  db migrate         Apply pending database migrations
+  db rollback [n|all]  Revert the last n (default 1) migrations
+  db status          Show applied and pending migrations
   help               Show this help message
 
 Examples:
   treni train 9311
+  treni train 2345/S01700
+  treni train 9311 --date yesterday
+  treni train 9311 --where
   treni station S01700
+  treni station S01700 --at 18:30
   treni search Milano
+  treni journey S01700 "Bologna Centrale"
   treni record 9311
+  treni record 9311 --date yesterday
+  treni finalize
+  treni snapshot S01700 S08409
   treni history 9311
+  treni timeline 9311 --date yesterday
   treni stats 9311
+  treni stats 9311 S05704
+  treni stats 2345/S01700
+  treni platforms 9311 S01700
   treni top delayed
-  treni top reliable`)
+  treni top reliable
+  treni db status
+  treni --provider trenord train 10911
+  treni --provider viaggiatreno,trenord train 10911
+  treni --output json train 9311
+  treni top delayed -o csv > delayed.csv
+
+Environment:
+  TRENI_PROVIDER     Default provider (viaggiatreno, trenord, or a
+                     comma-separated list queried in priority order)
+  TRENI_PUNCTUALITY  JSON file of on-time thresholds per train category
+                     and data provider (default: 5 min, 15 for high
+                     speed and long distance)`)
+}
+
+// parseGlobalFlags extracts global options from anywhere in args and returns
+// the remaining arguments
+func parseGlobalFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--provider":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--provider requires a value")
+			}
+			providerName = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--provider="):
+			providerName = strings.TrimPrefix(arg, "--provider=")
+		case arg == "--output" || arg == "-o":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s requires a value", arg)
+			}
+			format, err := parseOutputFormat(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			outputFormat = format
+			i++
+		case strings.HasPrefix(arg, "--output="):
+			format, err := parseOutputFormat(strings.TrimPrefix(arg, "--output="))
+			if err != nil {
+				return nil, err
+			}
+			outputFormat = format
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, nil
+}
+
+func newClient() api.TrainClient {
+	client, err := provider.New(providerName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	return client
 }
 
-func getDB() (*storage.DB, *sqlc.Queries, error) {
+// openDB connects to Turso when TRENI_DATABASE_URL is set, or to the local
+// SQLite database otherwise, without running migrations
+func openDB() (*storage.DB, bool, error) {
 	// Check for Treni Turso env vars first
 	if os.Getenv("TRENI_DATABASE_URL") != "" {
 		db, err := storage.New()
-		if err != nil {
-			return nil, nil, err
-		}
-		return db, sqlc.New(db.DB), nil
+		return db, false, err
 	}
 
 	// Fall back to local SQLite
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return nil, nil, err
+		return nil, true, err
 	}
 
 	dbPath := filepath.Join(home, ".local", "share", "treni", "treni.db")
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		return nil, nil, err
+		return nil, true, err
 	}
 
 	db, err := storage.NewLocal(dbPath)
+	return db, true, err
+}
+
+func getDB() (*storage.DB, error) {
+	db, local, err := openDB()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	// Run migrations
-	if err := db.Migrate(); err != nil {
-		db.Close()
-		return nil, nil, err
+	// Keep the local database up to date; remote ones use 'treni db migrate'
+	if local {
+		if err := db.Migrate(); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 
-	return db, sqlc.New(db.DB), nil
+	return db, nil
 }
 
-func trainCmd(trainNumber string) {
-	client := viaggiatreno.New()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// newService builds a service on the selected provider, backed by the
+// database cache when it can be opened
+func newService() (*service.Service, func()) {
+	client := newClient()
+	db, err := getDB()
+	if err != nil {
+		return newPolicyService(client, nil), func() {}
+	}
+	return newPolicyService(client, db.DB), func() { db.Close() }
+}
+
+// newHistoryService builds a service over the database for the commands that
+// only read recorded history
+func newHistoryService() (*service.Service, func()) {
+	db, err := getDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	return newPolicyService(nil, db.DB), func() { db.Close() }
+}
+
+// newPolicyService builds a service judging punctuality by the policy in
+// TRENI_PUNCTUALITY, exiting when it cannot be loaded
+func newPolicyService(client api.TrainClient, db *sql.DB) *service.Service {
+	svc := service.New(client, db)
+	svc.SetPunctuality(loadPolicy())
+	return svc
+}
+
+// loadPolicy loads the punctuality policy in TRENI_PUNCTUALITY, exiting when
+// it cannot be loaded
+func loadPolicy() punctuality.Policy {
+	policy, err := punctuality.FromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	return policy
+}
+
+// takeOption removes a command option given as "name value" or "name=value"
+// from args, returning its value and the remaining arguments
+func takeOption(args []string, name string) (string, []string) {
+	var value string
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == name:
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: %s requires a value\n", name)
+				os.Exit(1)
+			}
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], name+"="):
+			value = strings.TrimPrefix(args[i], name+"=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return value, rest
+}
+
+// takeFlag removes a boolean command option from args, reporting whether it
+// was given
+func takeFlag(args []string, name string) (bool, []string) {
+	var found bool
+	var rest []string
+	for _, arg := range args {
+		if arg == name {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return found, rest
+}
 
-	train, err := client.GetTrain(ctx, trainNumber)
+// parseTrainArgs parses a train argument and its --date option, exiting when
+// either is missing or malformed
+func parseTrainArgs(args []string) domain.TrainRef {
+	date, args := takeOption(args, "--date")
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "error: train number required")
+		os.Exit(1)
+	}
+
+	ref, err := domain.ParseTrainRef(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if date != "" {
+		if ref.Date, err = domain.ParseDate(date, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	return ref
+}
+
+// parseBoardTime parses the --at option of station, exiting when it is
+// malformed
+func parseBoardTime(s string) time.Time {
+	at, err := domain.ParseBoardTime(s, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	return at
+}
+
+// getTrain fetches the train run, listing the candidates and exiting when
+// several trains share the number
+func getTrain(ctx context.Context, client api.TrainClient, ref domain.TrainRef) *domain.Train {
+	train, err := api.GetTrainRun(ctx, client, ref)
+	var ambiguous *api.AmbiguousTrainError
+	if errors.As(err, &ambiguous) {
+		out := os.Stdout
+		if machineOutput() {
+			out = os.Stderr
+		}
+		fmt.Fprintf(out, "%d trains are numbered %s:\n", len(ambiguous.Candidates), ref.Number)
+		for _, c := range ambiguous.Candidates {
+			fmt.Fprintf(out, "  %s - from %s\n", domain.TrainRef{Number: c.Number, OriginCode: c.OriginCode}, c.Origin)
+		}
+		fmt.Fprintf(out, "\nAdd the origin to pick one, e.g. %s\n",
+			domain.TrainRef{Number: ref.Number, OriginCode: ambiguous.Candidates[0].OriginCode})
+		os.Exit(1)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	return train
+}
+
+func trainCmd(ref domain.TrainRef) {
+	client := newClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	train := getTrain(ctx, client, ref)
+	train.Status = loadPolicy().TrainStatus(train)
+
+	if emit(train, func() table {
+		return tableOf(train.Stops).prepend("train_number", func(int) string { return train.Number })
+	}) {
+		return
+	}
 
 	fmt.Printf("%s %s\n", train.Category, train.Number)
 	fmt.Printf("%s → %s\n", train.Origin, train.Destination)
-	fmt.Printf("Status: %s\n", train.Status)
+	fmt.Printf("Status: %s\n", train.Status.Label())
 	if train.Delay > 0 {
 		fmt.Printf("Delay: +%d min\n", train.Delay)
 	} else if train.Delay < 0 {
@@ -155,7 +445,7 @@ func trainCmd(trainNumber string) {
 		fmt.Println("Delay: On time")
 	}
 	if !train.LastUpdate.IsZero() {
-		fmt.Printf("Last update: %s\n", train.LastUpdate.Format("15:04"))
+		fmt.Printf("Last update: %s\n", clock(train.LastUpdate))
 	}
 
 	if len(train.Stops) > 0 {
@@ -164,15 +454,9 @@ func trainCmd(trainNumber string) {
 		fmt.Fprintln(w, "Station\tArr\tDep\tDelay\tPlatform")
 		fmt.Fprintln(w, "-------\t---\t---\t-----\t--------")
 		for _, stop := range train.Stops {
-			arr := "-"
-			dep := "-"
+			arr := clock(stop.ScheduledArrival)
+			dep := clock(stop.ScheduledDepart)
 			delay := "-"
-			if !stop.ScheduledArrival.IsZero() {
-				arr = stop.ScheduledArrival.Format("15:04")
-			}
-			if !stop.ScheduledDepart.IsZero() {
-				dep = stop.ScheduledDepart.Format("15:04")
-			}
 			if stop.DepartureDelay != 0 {
 				delay = fmt.Sprintf("%+d", stop.DepartureDelay)
 			} else if stop.ArrivalDelay != 0 {
@@ -188,14 +472,83 @@ func trainCmd(trainNumber string) {
 	}
 }
 
-func stationCmd(stationCode string) {
-	client := viaggiatreno.New()
+// whereCmd shows where a train is and when it is expected at its next stops
+func whereCmd(ref domain.TrainRef) {
+	client := newClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	train := getTrain(ctx, client, ref)
+	train.Status = loadPolicy().TrainStatus(train)
+	pos := train.Position(time.Now())
+
+	if emit(pos, func() table { return tableOf(pos.Remaining) }) {
+		return
+	}
+
+	fmt.Printf("%s %s\n", train.Category, train.Number)
+	fmt.Printf("%s → %s\n", train.Origin, train.Destination)
+	fmt.Printf("Status: %s\n", train.Status.Label())
+
+	switch {
+	case pos.Arrived():
+		fmt.Printf("Arrived at %s\n", pos.LastStation)
+	case pos.LastStop < 0:
+		fmt.Println("Not departed yet")
+	default:
+		seen := ""
+		if !pos.LastSeen.IsZero() {
+			seen = " at " + clock(pos.LastSeen)
+		}
+		fmt.Printf("Last seen: %s%s\n", pos.LastStation, seen)
+	}
+	if pos.NextStop >= 0 {
+		next := pos.Remaining[0]
+		fmt.Printf("Next stop: %s, expected %s\n", next.StationName, clock(firstTime(next.Arrival, next.Departure)))
+	}
+	fmt.Printf("Progress: %s %d%%\n", progressBar(pos.Progress, 30), pos.Progress)
+
+	if len(pos.Remaining) > 0 {
+		fmt.Println("\nNext stops:")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Station\tArr\tDep\tPlatform")
+		fmt.Fprintln(w, "-------\t---\t---\t--------")
+		for _, e := range pos.Remaining {
+			platform := train.Stops[e.Stop].Platform
+			if platform == "" {
+				platform = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.StationName, clock(e.Arrival), clock(e.Departure), platform)
+		}
+		w.Flush()
+	}
+}
+
+// firstTime returns the first of times that is not zero
+func firstTime(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// progressBar draws percent as a bar of the given width
+func progressBar(percent, width int) string {
+	done := percent * width / 100
+	return "[" + strings.Repeat("#", done) + strings.Repeat("-", width-done) + "]"
+}
+
+func stationCmd(stationCode string, at time.Time) {
+	svc, closeDB := newService()
+	defer closeDB()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	// If it doesn't look like a station code, search first
 	if len(stationCode) < 3 || stationCode[0] != 'S' {
-		stations, err := client.SearchStation(ctx, stationCode)
+		stations, err := svc.SearchStations(ctx, stationCode)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
@@ -204,6 +557,13 @@ func stationCmd(stationCode string) {
 			fmt.Fprintf(os.Stderr, "error: no stations found for %q\n", stationCode)
 			os.Exit(1)
 		}
+		if len(stations) > 1 && machineOutput() {
+			fmt.Fprintf(os.Stderr, "error: %d stations match %q, use a station code:\n", len(stations), stationCode)
+			for _, s := range stations {
+				fmt.Fprintf(os.Stderr, "  %s - %s\n", s.Code, s.Name)
+			}
+			os.Exit(1)
+		}
 		if len(stations) > 1 {
 			fmt.Println("Multiple stations found:")
 			for _, s := range stations {
@@ -213,15 +573,30 @@ func stationCmd(stationCode string) {
 			return
 		}
 		stationCode = stations[0].Code
-		fmt.Printf("Using station: %s (%s)\n\n", stations[0].Name, stations[0].Code)
+		infof("Using station: %s (%s)\n\n", stations[0].Name, stations[0].Code)
 	}
 
-	station, err := client.GetStation(ctx, stationCode)
+	station, err := svc.GetStationAt(ctx, stationCode, at)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 
+	if emit(station, func() table { return boardTable(station) }) {
+		return
+	}
+
+	if station.Name != station.Code {
+		fmt.Printf("%s (%s)", station.Name, station.Code)
+		if station.Region != "" {
+			fmt.Printf(" - %s", station.Region)
+		}
+		fmt.Print("\n\n")
+	}
+	if !at.IsZero() {
+		fmt.Printf("Board at %s\n\n", at.In(domain.Rome).Format("Mon 2 Jan 15:04"))
+	}
+
 	// Departures
 	fmt.Println("DEPARTURES")
 	if len(station.Departures) == 0 {
@@ -240,7 +615,7 @@ func stationCmd(stationCode string) {
 				platform = "-"
 			}
 			fmt.Fprintf(w, "%s\t%s %s\t%s\t%s\t%s\n",
-				d.ScheduledTime.Format("15:04"),
+				clock(d.ScheduledTime),
 				d.TrainCategory,
 				d.TrainNumber,
 				d.Destination,
@@ -271,7 +646,7 @@ func stationCmd(stationCode string) {
 				platform = "-"
 			}
 			fmt.Fprintf(w, "%s\t%s %s\t%s\t%s\t%s\n",
-				a.ScheduledTime.Format("15:04"),
+				clock(a.ScheduledTime),
 				a.TrainCategory,
 				a.TrainNumber,
 				a.Origin,
@@ -284,16 +659,24 @@ func stationCmd(stationCode string) {
 }
 
 func searchCmd(query string) {
-	client := viaggiatreno.New()
+	svc, closeDB := newService()
+	defer closeDB()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	stations, err := client.SearchStation(ctx, query)
+	stations, err := svc.SearchStations(ctx, query)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 
+	if stations == nil {
+		stations = []domain.Station{}
+	}
+	if emit(stations, func() table { return tableOf(stations) }) {
+		return
+	}
+
 	if len(stations) == 0 {
 		fmt.Printf("No stations found for %q\n", query)
 		return
@@ -309,80 +692,253 @@ func searchCmd(query string) {
 	w.Flush()
 }
 
-func recordCmd(trainNumber string) {
-	client := viaggiatreno.New()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func journeyCmd(fromQuery, toQuery string) {
+	svc, closeDB := newService()
+	defer closeDB()
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	train, err := client.GetTrain(ctx, trainNumber)
+	from, err := svc.ResolveStation(ctx, fromQuery)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	to, err := svc.ResolveStation(ctx, toQuery)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	journeys, err := svc.FindJourneys(ctx, from.Code, to.Code, 10)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	if journeys == nil {
+		journeys = []domain.Journey{}
+	}
+
+	if emit(journeys, func() table { return journeyTable(journeys) }) {
+		return
+	}
+
+	if len(journeys) == 0 {
+		fmt.Printf("No direct trains found from %s to %s among the next departures\n", from.Name, to.Name)
+		return
+	}
+
+	fmt.Printf("Direct trains from %s to %s:\n\n", from.Name, to.Name)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Train\tDep\tExpected\tArr\tExpected\tDelay\tPlatform\tStatus")
+	fmt.Fprintln(w, "-----\t---\t--------\t---\t--------\t-----\t--------\t------")
+	for _, j := range journeys {
+		delay := "-"
+		if j.Delay != 0 {
+			delay = fmt.Sprintf("%+d", j.Delay)
+		}
+		platform := j.From.Platform
+		if platform == "" {
+			platform = "-"
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			j.TrainCategory, j.TrainNumber,
+			clock(j.From.ScheduledDepart), clock(j.From.ExpectedDeparture()),
+			clock(j.To.ScheduledArrival), clock(j.To.ExpectedArrival()),
+			delay, platform, j.Status.Label())
+	}
+	w.Flush()
+}
+
+// clock formats a time of day in Italian time, or "-" when unknown
+func clock(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(domain.Rome).Format("15:04")
+}
 
-	db, queries, err := getDB()
+func recordCmd(ref domain.TrainRef) {
+	client := newClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	train := getTrain(ctx, client, ref)
+
+	db, err := getDB()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	cancelled := train.Status == "cancelled"
-	today := time.Now().Truncate(24 * time.Hour)
-
-	err = queries.InsertDelayRecord(ctx, sqlc.InsertDelayRecordParams{
-		TrainNumber:   train.Number,
-		TrainCategory: sql.NullString{String: train.Category, Valid: train.Category != ""},
-		Origin:        train.Origin,
-		Destination:   train.Destination,
-		Date:          today,
-		Delay:         int64(train.Delay),
-		Cancelled:     sql.NullBool{Bool: cancelled, Valid: true},
-		Source:        sql.NullString{String: "viaggiatreno", Valid: true},
-	})
-	if err != nil {
+	// Runs are filed under the day they left their origin, in Italy, so a
+	// train crossing midnight or a back-filled past run lands on its own day
+	date := train.ServiceDay()
+	if date.IsZero() {
+		date = ref.Date
+	}
+	if date.IsZero() {
+		date = domain.ServiceDay(time.Now())
+	}
+
+	svc := newPolicyService(client, db.DB)
+	if err := svc.RecordTrain(ctx, train, date); err != nil {
 		fmt.Fprintf(os.Stderr, "error recording: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Recorded: %s %s (%s → %s) delay: %+d min\n",
-		train.Category, train.Number, train.Origin, train.Destination, train.Delay)
+	fmt.Printf("Recorded: %s %s (%s → %s) delay: %+d min, %d stops\n",
+		train.Category, train.Number, train.Origin, train.Destination, train.Delay, len(train.Stops))
+	if c := train.Completeness(); !c.Final() {
+		fmt.Printf("Provisional (%s): the delay is kept out of statistics until\n", strings.ReplaceAll(string(c), "_", " "))
+		fmt.Println("the train arrives. Record it again then, or run 'treni finalize'.")
+	}
+}
+
+// finalizeCmd records again the runs of the last two days recorded before
+// they arrived, if they have arrived by now
+func finalizeCmd() {
+	client := newClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	db, err := getDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	svc := newPolicyService(client, db.DB)
+	since := domain.ServiceDay(time.Now()).AddDate(0, 0, -2)
+	n, err := svc.FinalizeRecords(ctx, since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	fmt.Printf("Finalised %d records\n", n)
 }
 
-func historyCmd(trainNumber string) {
-	db, queries, err := getDB()
+// snapshotCmd records every train on the boards of the given stations
+func snapshotCmd(stationCodes []string) {
+	client := newClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := getDB()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
+	svc := newPolicyService(client, db.DB)
+	failed := false
+	for _, code := range stationCodes {
+		station, err := client.GetStation(ctx, code)
+		if err == nil {
+			err = svc.RecordBoard(ctx, station, time.Now())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: station %s: %v\n", code, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Recorded: %s, %d departures and %d arrivals\n",
+			station.Name, len(station.Departures), len(station.Arrivals))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// timelineCmd shows the delay observations of a train run, with a bar per
+// observation scaled to the largest delay
+func timelineCmd(ref domain.TrainRef) {
+	svc, closeDB := newHistoryService()
+	defer closeDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	timeline, err := svc.GetDelayTimeline(ctx, ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error querying: %v\n", err)
+		os.Exit(1)
+	}
+
+	if emit(timeline, func() table { return tableOf(timeline) }) {
+		return
+	}
+
+	if len(timeline) == 0 {
+		fmt.Printf("No observations for train %s\n", ref)
+		fmt.Println("Add it to TRENI_WATCHLIST, or use 'treni record' while it runs.")
+		return
+	}
+
+	worst := 1
+	for _, o := range timeline {
+		worst = max(worst, o.Delay)
+	}
+
+	fmt.Printf("Delay timeline for train %s (%d observations):\n\n", ref, len(timeline))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Time\tDelay\tLast station\t")
+	fmt.Fprintln(w, "----\t-----\t------------\t")
+	for _, o := range timeline {
+		station := o.LastStation
+		if station == "" {
+			station = "-"
+		}
+		fmt.Fprintf(w, "%s\t%+d min\t%s\t%s\n",
+			o.ObservedAt.Format("15:04"), o.Delay, station, strings.Repeat("#", max(o.Delay, 0)*20/worst))
+	}
+	w.Flush()
+}
+
+func historyCmd(ref domain.TrainRef) {
+	svc, closeDB := newHistoryService()
+	defer closeDB()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	records, err := queries.GetDelayRecordsByTrain(ctx, trainNumber)
+	records, err := svc.GetDelayHistory(ctx, ref)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error querying: %v\n", err)
 		os.Exit(1)
 	}
 
+	if emit(records, func() table { return tableOf(records) }) {
+		return
+	}
+
 	if len(records) == 0 {
-		fmt.Printf("No history found for train %s\n", trainNumber)
+		fmt.Printf("No history found for train %s\n", ref)
 		fmt.Println("Use 'treni record <number>' to start recording delays.")
 		return
 	}
 
-	fmt.Printf("History for train %s (%d records):\n\n", trainNumber, len(records))
+	fmt.Printf("History for train %s (%d records):\n\n", ref, len(records))
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	fmt.Fprintln(w, "Date\tRoute\tDelay\tStatus")
 	fmt.Fprintln(w, "----\t-----\t-----\t------")
 	for _, r := range records {
 		status := "OK"
-		if r.Cancelled.Valid && r.Cancelled.Bool {
+		switch {
+		case r.Cancelled:
 			status = "CANCELLED"
-		} else if r.Delay > 5 {
+		case r.Status.Disrupted():
+			status = strings.ToUpper(r.Status.Label())
+		case !svc.Punctuality().OnTime(r.TrainCategory, r.Source, r.Delay):
 			status = "DELAYED"
 		}
+		if r.Observed {
+			status += " (board)"
+		}
+		if !r.Completeness.Final() {
+			status += " (provisional)"
+		}
 		delay := fmt.Sprintf("%+d min", r.Delay)
 		fmt.Fprintf(w, "%s\t%s → %s\t%s\t%s\n",
 			r.Date.Format("2006-01-02"), r.Origin, r.Destination, delay, status)
@@ -390,62 +946,130 @@ func historyCmd(trainNumber string) {
 	w.Flush()
 }
 
-func statsCmd(trainNumber string) {
-	db, queries, err := getDB()
+func statsCmd(ref domain.TrainRef) {
+	svc, closeDB := newHistoryService()
+	defer closeDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stats, err := svc.GetTrainStats(ctx, ref)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
+		fmt.Fprintf(os.Stderr, "error querying: %v\n", err)
 		os.Exit(1)
 	}
-	defer db.Close()
+	var provisional int
+	if stats != nil && stats.TotalTrips == 0 {
+		provisional = stats.ProvisionalTrips
+		stats = nil
+	}
+
+	if emit(stats, func() table { return tableOf(optional(stats)) }) {
+		return
+	}
+
+	if stats == nil {
+		fmt.Printf("No stats found for train %s\n", ref)
+		if provisional > 0 {
+			fmt.Printf("%d provisional records wait for the train to arrive; see 'treni finalize'.\n", provisional)
+		}
+		return
+	}
+
+	fmt.Printf("Statistics for train %s:\n\n", ref)
+	fmt.Printf("Total trips:     %d\n", stats.TotalTrips)
+	fmt.Printf("On time:         %d (%.1f%%, up to %d min late)\n", stats.OnTimeTrips, stats.OnTimeRate*100, stats.OnTimeThreshold)
+	fmt.Printf("Delayed:         %d\n", stats.DelayedTrips)
+	fmt.Printf("Cancelled:       %d\n", stats.CancelledTrips)
+	if stats.PartiallyCancelledTrips > 0 {
+		fmt.Printf("Part cancelled:  %d\n", stats.PartiallyCancelledTrips)
+	}
+	if stats.ReroutedTrips > 0 {
+		fmt.Printf("Rerouted:        %d\n", stats.ReroutedTrips)
+	}
+	fmt.Printf("Average delay:   %.1f min\n", stats.AverageDelay)
+	fmt.Printf("Max delay:       %d min\n", stats.MaxDelay)
+	fmt.Printf("Median delay:    %d min (80%%: %d, 95%%: %d)\n", stats.P50Delay, stats.P80Delay, stats.P95Delay)
+	fmt.Printf("Std deviation:   %.1f min\n", stats.DelayStdDev)
+
+	ran := 0
+	for _, b := range stats.Histogram {
+		ran += b.Trips
+	}
+	fmt.Println("\nDelay distribution:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, b := range stats.Histogram {
+		fmt.Fprintf(w, "  %s min\t%d\t%s\n", b.Label(), b.Trips, strings.Repeat("#", 20*b.Trips/max(ran, 1)))
+	}
+	w.Flush()
+	if stats.ProvisionalTrips > 0 {
+		fmt.Printf("\n%d provisional records, taken before the train arrived, are not counted.\n", stats.ProvisionalTrips)
+	}
+}
+
+func stopStatsCmd(ref domain.TrainRef, stationCode string) {
+	svc, closeDB := newHistoryService()
+	defer closeDB()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	stats, err := queries.GetTrainStats(ctx, trainNumber)
+	stats, err := svc.GetStopStats(ctx, ref, stationCode)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			fmt.Printf("No stats found for train %s\n", trainNumber)
-			return
-		}
 		fmt.Fprintf(os.Stderr, "error querying: %v\n", err)
 		os.Exit(1)
 	}
+	if stats != nil && stats.TotalStops == 0 {
+		stats = nil
+	}
 
-	if stats.TotalTrips == 0 {
-		fmt.Printf("No stats found for train %s\n", trainNumber)
+	if emit(stats, func() table { return tableOf(optional(stats)) }) {
 		return
 	}
 
-	onTimeTrips := int64(0)
-	if stats.OnTimeTrips.Valid {
-		onTimeTrips = int64(stats.OnTimeTrips.Float64)
-	}
-	delayedTrips := int64(0)
-	if stats.DelayedTrips.Valid {
-		delayedTrips = int64(stats.DelayedTrips.Float64)
+	if stats == nil {
+		fmt.Printf("No stats found for train %s at %s\n", ref, stationCode)
+		return
 	}
-	cancelledTrips := int64(0)
-	if stats.CancelledTrips.Valid {
-		cancelledTrips = int64(stats.CancelledTrips.Float64)
+
+	fmt.Printf("Statistics for train %s at %s:\n\n", ref, stationCode)
+	fmt.Printf("Recorded stops:  %d\n", stats.TotalStops)
+	fmt.Printf("On time:         %d (%.1f%%)\n", stats.OnTimeStops, stats.OnTimeRate*100)
+	fmt.Printf("Avg arrival:     %+.1f min\n", stats.AverageArrivalDelay)
+	fmt.Printf("Avg departure:   %+.1f min\n", stats.AverageDepartureDelay)
+	fmt.Printf("Max arrival:     %+d min\n", stats.MaxArrivalDelay)
+}
+
+func platformsCmd(ref domain.TrainRef, stationCode string) {
+	svc, closeDB := newHistoryService()
+	defer closeDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	usage, err := svc.GetPlatformUsage(ctx, ref, stationCode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error querying: %v\n", err)
+		os.Exit(1)
 	}
 
-	onTimeRate := float64(onTimeTrips) / float64(stats.TotalTrips) * 100
+	if emit(usage, func() table { return tableOf(usage) }) {
+		return
+	}
 
-	fmt.Printf("Statistics for train %s:\n\n", trainNumber)
-	fmt.Printf("Total trips:     %d\n", stats.TotalTrips)
-	fmt.Printf("On time:         %d (%.1f%%)\n", onTimeTrips, onTimeRate)
-	fmt.Printf("Delayed:         %d\n", delayedTrips)
-	fmt.Printf("Cancelled:       %d\n", cancelledTrips)
-	if stats.AverageDelay.Valid {
-		fmt.Printf("Average delay:   %.1f min\n", stats.AverageDelay.Float64)
+	if len(usage) == 0 {
+		fmt.Printf("No platforms recorded for train %s at %s\n", ref, stationCode)
+		return
 	}
-	if stats.MaxDelay != nil {
-		if v, ok := stats.MaxDelay.(int64); ok {
-			fmt.Printf("Max delay:       %d min\n", v)
-		} else if v, ok := stats.MaxDelay.(float64); ok {
-			fmt.Printf("Max delay:       %.0f min\n", v)
-		}
+
+	fmt.Printf("Platforms used by train %s at %s:\n\n", ref, stationCode)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Platform\tRuns\tShare\tChanged")
+	fmt.Fprintln(w, "--------\t----\t-----\t-------")
+	for _, u := range usage {
+		fmt.Fprintf(w, "%s\t%d\t%.0f%%\t%d\n", u.Platform, u.Uses, u.Share*100, u.Changes)
 	}
+	w.Flush()
 }
 
 func topCmd(args []string) {
@@ -454,98 +1078,134 @@ func topCmd(args []string) {
 		subCmd = args[0]
 	}
 
-	db, queries, err := getDB()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
-		os.Exit(1)
-	}
-	defer db.Close()
+	svc, closeDB := newHistoryService()
+	defer closeDB()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	to := time.Now().Truncate(24 * time.Hour)
-	from := to.AddDate(0, 0, -30)
-
+	var fetch func(context.Context, int, int) ([]service.TrainRanking, error)
 	switch subCmd {
 	case "delayed":
-		trains, err := queries.GetMostDelayedTrains(ctx, sqlc.GetMostDelayedTrainsParams{
-			FromDate:   from,
-			ToDate:     to,
-			LimitCount: 10,
-		})
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error querying: %v\n", err)
-			os.Exit(1)
-		}
+		fetch = svc.GetMostDelayedTrains
+	case "reliable":
+		fetch = svc.GetMostReliableTrains
+	default:
+		fmt.Fprintf(os.Stderr, "unknown subcommand: %s (use 'delayed' or 'reliable')\n", subCmd)
+		os.Exit(1)
+	}
 
-		if len(trains) == 0 {
-			fmt.Println("No data found")
-			return
-		}
+	trains, err := fetch(ctx, 30, 10)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error querying: %v\n", err)
+		os.Exit(1)
+	}
+	if trains == nil {
+		trains = []service.TrainRanking{}
+	}
 
+	if emit(trains, func() table {
+		return tableOf(trains).prepend("rank", func(i int) string { return strconv.Itoa(i + 1) })
+	}) {
+		return
+	}
+
+	if len(trains) == 0 {
+		fmt.Println("No data found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if subCmd == "delayed" {
 		fmt.Println("Most delayed trains (last 30 days):")
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 		fmt.Fprintln(w, "Train\tRoute\tTrips\tAvg Delay\tMax Delay")
 		fmt.Fprintln(w, "-----\t-----\t-----\t---------\t---------")
-		for _, t := range trains {
-			cat := ""
-			if t.TrainCategory.Valid {
-				cat = t.TrainCategory.String + " "
-			}
-			avgDelay := 0.0
-			if t.AvgDelay.Valid {
-				avgDelay = t.AvgDelay.Float64
-			}
-			maxDelay := 0
-			if v, ok := t.MaxDelay.(int64); ok {
-				maxDelay = int(v)
-			} else if v, ok := t.MaxDelay.(float64); ok {
-				maxDelay = int(v)
-			}
+	} else {
+		fmt.Println("Most reliable trains (last 30 days):")
+		fmt.Fprintln(w, "Train\tRoute\tTrips\tOn-Time Rate\tAvg Delay")
+		fmt.Fprintln(w, "-----\t-----\t-----\t------------\t---------")
+	}
+	for _, t := range trains {
+		cat := ""
+		if t.Category != "" {
+			cat = t.Category + " "
+		}
+		if subCmd == "delayed" {
 			fmt.Fprintf(w, "%s%s\t%s → %s\t%d\t%.1f min\t%d min\n",
 				cat, t.TrainNumber, t.Origin, t.Destination,
-				t.TripCount, avgDelay, maxDelay)
+				t.TripCount, t.AvgDelay, t.MaxDelay)
+		} else {
+			fmt.Fprintf(w, "%s%s\t%s → %s\t%d\t%.1f%%\t%.1f min\n",
+				cat, t.TrainNumber, t.Origin, t.Destination,
+				t.TripCount, t.OnTimeRate, t.AvgDelay)
 		}
-		w.Flush()
+	}
+	w.Flush()
+}
 
-	case "reliable":
-		trains, err := queries.GetMostReliableTrains(ctx, sqlc.GetMostReliableTrainsParams{
-			FromDate:   from,
-			ToDate:     to,
-			LimitCount: 10,
-		})
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error querying: %v\n", err)
+func dbCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "error: db subcommand required (migrate, rollback or status)")
+		os.Exit(1)
+	}
+
+	db, _, err := openDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "migrate":
+		if err := db.Migrate(); err != nil {
+			fmt.Fprintf(os.Stderr, "error migrating: %v\n", err)
 			os.Exit(1)
 		}
+		fmt.Println("Database is up to date")
 
-		if len(trains) == 0 {
-			fmt.Println("No data found")
-			return
+	case "rollback":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = -1
+			} else if n, err := strconv.Atoi(args[1]); err == nil && n > 0 {
+				steps = n
+			} else {
+				fmt.Fprintf(os.Stderr, "error: invalid rollback steps %q\n", args[1])
+				os.Exit(1)
+			}
+		}
+		if err := db.Rollback(steps); err != nil {
+			fmt.Fprintf(os.Stderr, "error rolling back: %v\n", err)
+			os.Exit(1)
 		}
+		fmt.Println("Rollback complete")
 
-		fmt.Println("Most reliable trains (last 30 days):")
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading migrations: %v\n", err)
+			os.Exit(1)
+		}
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "Train\tRoute\tTrips\tOn-Time Rate\tAvg Delay")
-		fmt.Fprintln(w, "-----\t-----\t-----\t------------\t---------")
-		for _, t := range trains {
-			cat := ""
-			if t.TrainCategory.Valid {
-				cat = t.TrainCategory.String + " "
-			}
-			avgDelay := 0.0
-			if t.AvgDelay.Valid {
-				avgDelay = t.AvgDelay.Float64
+		fmt.Fprintln(w, "Version\tName\tStatus\tApplied At")
+		fmt.Fprintln(w, "-------\t----\t------\t----------")
+		for _, m := range status {
+			state := "pending"
+			appliedAt := "-"
+			if m.Applied {
+				state = "applied"
+				if !m.AppliedAt.IsZero() {
+					appliedAt = m.AppliedAt.Format("2006-01-02 15:04")
+				}
 			}
-			fmt.Fprintf(w, "%s%s\t%s → %s\t%d\t%.1f%%\t%.1f min\n",
-				cat, t.TrainNumber, t.Origin, t.Destination,
-				t.TripCount, float64(t.OnTimeRate), avgDelay)
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", m.Version, m.Name, state, appliedAt)
 		}
 		w.Flush()
 
 	default:
-		fmt.Fprintf(os.Stderr, "unknown subcommand: %s (use 'delayed' or 'reliable')\n", subCmd)
+		fmt.Fprintf(os.Stderr, "unknown subcommand: %s (use 'migrate', 'rollback' or 'status')\n", args[0])
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+// Output formats accepted by --output
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+	formatTSV   = "tsv"
+)
+
+// outputFormat selects how commands print their results, set by --output
+var outputFormat = formatTable
+
+func parseOutputFormat(s string) (string, error) {
+	switch s {
+	case formatTable, formatJSON, formatCSV, formatTSV:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (use table, json, csv or tsv)", s)
+}
+
+// machineOutput reports whether stdout is reserved for structured data
+func machineOutput() bool {
+	return outputFormat != formatTable
+}
+
+// infof prints an informational message, on stderr when stdout carries
+// structured data
+func infof(format string, args ...any) {
+	if machineOutput() {
+		fmt.Fprintf(os.Stderr, format, args...)
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// table is the flat form of a result used by the csv and tsv formats
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// emit writes v as JSON, or the table built by flat as CSV or TSV, and
+// reports whether it did; in table format the caller prints its own layout
+func emit(v any, flat func() table) bool {
+	switch outputFormat {
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case formatCSV, formatTSV:
+		w := csv.NewWriter(os.Stdout)
+		if outputFormat == formatTSV {
+			w.Comma = '\t'
+		}
+		t := flat()
+		w.Write(t.header)
+		w.WriteAll(t.rows)
+		if err := w.Error(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// tableOf flattens a slice of structs into a table whose columns are the
+// structs' JSON field names, so every format shares the same field names
+func tableOf[T any](items []T) table {
+	var zero T
+	t := table{header: fieldNames(reflect.TypeOf(zero), "")}
+	for _, item := range items {
+		t.rows = append(t.rows, fieldValues(reflect.ValueOf(item)))
+	}
+	return t
+}
+
+// optional turns a possibly nil result into zero or one table rows
+func optional[T any](v *T) []T {
+	if v == nil {
+		return nil
+	}
+	return []T{*v}
+}
+
+// boardEntry is one row of a station board in csv and tsv output
+type boardEntry struct {
+	Type          string             `json:"type"` // departure or arrival
+	TrainNumber   string             `json:"train_number"`
+	TrainCategory string             `json:"train_category"`
+	Origin        string             `json:"origin"`
+	Destination   string             `json:"destination"`
+	ScheduledTime time.Time          `json:"scheduled_time"`
+	ActualTime    time.Time          `json:"actual_time"`
+	Delay         int                `json:"delay"`
+	Platform      string             `json:"platform"`
+	Status        domain.TrainStatus `json:"status"`
+}
+
+// boardTable lists departures then arrivals in a single table
+func boardTable(st *domain.Station) table {
+	entries := make([]boardEntry, 0, len(st.Departures)+len(st.Arrivals))
+	for _, d := range st.Departures {
+		entries = append(entries, boardEntry{
+			Type:          "departure",
+			TrainNumber:   d.TrainNumber,
+			TrainCategory: d.TrainCategory,
+			Origin:        st.Name,
+			Destination:   d.Destination,
+			ScheduledTime: d.ScheduledTime,
+			ActualTime:    d.ActualTime,
+			Delay:         d.Delay,
+			Platform:      d.Platform,
+			Status:        d.Status,
+		})
+	}
+	for _, a := range st.Arrivals {
+		entries = append(entries, boardEntry{
+			Type:          "arrival",
+			TrainNumber:   a.TrainNumber,
+			TrainCategory: a.TrainCategory,
+			Origin:        a.Origin,
+			Destination:   st.Name,
+			ScheduledTime: a.ScheduledTime,
+			ActualTime:    a.ActualTime,
+			Delay:         a.Delay,
+			Platform:      a.Platform,
+			Status:        a.Status,
+		})
+	}
+	return tableOf(entries)
+}
+
+// journeyEntry is one row of a journey list in csv and tsv output
+type journeyEntry struct {
+	TrainNumber        string             `json:"train_number"`
+	TrainCategory      string             `json:"train_category"`
+	FromCode           string             `json:"from_code"`
+	FromName           string             `json:"from_name"`
+	ScheduledDeparture time.Time          `json:"scheduled_departure"`
+	ExpectedDeparture  time.Time          `json:"expected_departure"`
+	Platform           string             `json:"platform"`
+	ToCode             string             `json:"to_code"`
+	ToName             string             `json:"to_name"`
+	ScheduledArrival   time.Time          `json:"scheduled_arrival"`
+	ExpectedArrival    time.Time          `json:"expected_arrival"`
+	Delay              int                `json:"delay"`
+	Status             domain.TrainStatus `json:"status"`
+}
+
+// journeyTable flattens journeys to one row per train
+func journeyTable(journeys []domain.Journey) table {
+	entries := make([]journeyEntry, len(journeys))
+	for i, j := range journeys {
+		entries[i] = journeyEntry{
+			TrainNumber:        j.TrainNumber,
+			TrainCategory:      j.TrainCategory,
+			FromCode:           j.From.StationCode,
+			FromName:           j.From.StationName,
+			ScheduledDeparture: j.From.ScheduledDepart,
+			ExpectedDeparture:  j.From.ExpectedDeparture(),
+			Platform:           j.From.Platform,
+			ToCode:             j.To.StationCode,
+			ToName:             j.To.StationName,
+			ScheduledArrival:   j.To.ScheduledArrival,
+			ExpectedArrival:    j.To.ExpectedArrival(),
+			Delay:              j.Delay,
+			Status:             j.Status,
+		}
+	}
+	return tableOf(entries)
+}
+
+// prepend adds a leading column with the given value on every row
+func (t table) prepend(name string, value func(i int) string) table {
+	out := table{header: append([]string{name}, t.header...)}
+	for i, row := range t.rows {
+		out.rows = append(out.rows, append([]string{value(i)}, row...))
+	}
+	return out
+}
+
+// fieldNames lists the JSON names of a struct's scalar fields, flattening
+// nested structs as parent_child and skipping slices
+func fieldNames(t reflect.Type, prefix string) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonName(f)
+		if !ok || f.Type.Kind() == reflect.Slice {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) {
+			names = append(names, fieldNames(f.Type, prefix+name+"_")...)
+			continue
+		}
+		names = append(names, prefix+name)
+	}
+	return names
+}
+
+// fieldValues formats the fields named by fieldNames, in the same order
+func fieldValues(v reflect.Value) []string {
+	var values []string
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if _, ok := jsonName(f); !ok || f.Type.Kind() == reflect.Slice {
+			continue
+		}
+		fv := v.Field(i)
+		if t, ok := fv.Interface().(time.Time); ok {
+			if t.IsZero() {
+				values = append(values, "")
+			} else {
+				values = append(values, t.Format(time.RFC3339))
+			}
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.Struct:
+			values = append(values, fieldValues(fv)...)
+		case reflect.String:
+			values = append(values, fv.String())
+		case reflect.Bool:
+			values = append(values, strconv.FormatBool(fv.Bool()))
+		case reflect.Int, reflect.Int64:
+			values = append(values, strconv.FormatInt(fv.Int(), 10))
+		case reflect.Float64:
+			values = append(values, strconv.FormatFloat(fv.Float(), 'f', -1, 64))
+		default:
+			values = append(values, fmt.Sprint(fv.Interface()))
+		}
+	}
+	return values
+}
+
+func jsonName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
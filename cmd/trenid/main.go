@@ -1,43 +1,104 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
-	"github.com/emiliopalmerini/treni/internal/api/viaggiatreno"
+	"github.com/emiliopalmerini/treni/internal/alerts"
+	"github.com/emiliopalmerini/treni/internal/api/cache"
+	"github.com/emiliopalmerini/treni/internal/api/provider"
+	"github.com/emiliopalmerini/treni/internal/collector"
+	"github.com/emiliopalmerini/treni/internal/live"
+	"github.com/emiliopalmerini/treni/internal/punctuality"
 	"github.com/emiliopalmerini/treni/internal/service"
 	"github.com/emiliopalmerini/treni/internal/storage"
-	"github.com/emiliopalmerini/treni/internal/storage/sqlc"
 	"github.com/emiliopalmerini/treni/web/handlers"
+	"github.com/emiliopalmerini/treni/web/rest"
 )
 
+// How often live pages are refreshed from upstream, shared by all viewers
+const liveInterval = 30 * time.Second
+
 func main() {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	// Initialize API client
-	apiClient := viaggiatreno.New()
+	// Initialize API client (TRENI_PROVIDER selects the data source), cached
+	// so concurrent viewers share upstream requests
+	upstream, err := provider.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiClient := cache.New(upstream, cache.DefaultConfig)
 
 	// Initialize database (optional - works without it)
-	var queries *sqlc.Queries
+	var sqlDB *sql.DB
 	db, err := initDB()
 	if err != nil {
 		log.Printf("Warning: database not available: %v", err)
 	} else {
 		defer db.Close()
-		queries = sqlc.New(db.DB)
+		sqlDB = db.DB
 	}
 
 	// Initialize service and handlers
-	svc := service.New(apiClient, queries)
-	h := handlers.New(svc)
+	policy, err := punctuality.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load punctuality policy: %v", err)
+	}
+	svc := service.New(apiClient, sqlDB)
+	svc.SetPunctuality(policy)
+	h := handlers.New(svc, live.NewHub(liveInterval))
+
+	// Start background collector for the watchlist (requires a database)
+	if watchlist := collector.WatchlistFromEnv(); len(watchlist) > 0 {
+		if sqlDB == nil {
+			log.Printf("Warning: collector disabled, no database for watchlist %v", watchlist)
+		} else {
+			log.Printf("Collecting delays for %d trains", len(watchlist))
+			go collector.New(apiClient, svc, watchlist).Run(context.Background())
+		}
+	}
+
+	// Finalise delays recorded before the train arrived
+	if sqlDB != nil {
+		go collector.NewFinalizer(svc).Run(context.Background())
+	}
+
+	// Snapshot station boards (TRENI_BOARD_STATIONS, requires a database)
+	if stations := collector.BoardStationsFromEnv(); len(stations) > 0 {
+		if sqlDB == nil {
+			log.Printf("Warning: board recorder disabled, no database for stations %v", stations)
+		} else {
+			interval := collector.BoardIntervalFromEnv()
+			log.Printf("Snapshotting boards of %d stations every %s", len(stations), interval)
+			go collector.NewBoardRecorder(apiClient, svc, stations, interval).Run(context.Background())
+		}
+	}
+
+	// Start delay alerts (TRENI_ALERTS points to the rules file)
+	alertsCfg, err := alerts.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if alertsCfg != nil {
+		alerter, err := alerts.FromConfig(apiClient, alertsCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Evaluating %d alert rules", alerter.Rules())
+		go alerter.Run(context.Background())
+	}
 
 	// Setup router
 	r := chi.NewRouter()
@@ -48,6 +109,7 @@ func main() {
 	r.Get("/", h.Home)
 	r.Get("/train/{number}", h.Train)
 	r.Get("/station/{code}", h.Station)
+	r.Get("/journey", h.Journey)
 	r.Get("/analytics", h.Analytics)
 
 	// HTMX API endpoints
@@ -56,10 +118,18 @@ func main() {
 		r.Get("/train/{number}/status", h.TrainStatus)
 		r.Get("/station/{code}/departures", h.StationDepartures)
 		r.Get("/station/{code}/arrivals", h.StationArrivals)
+		r.Get("/station/{code}/events", h.StationEvents)
+		r.Get("/train/{number}/events", h.TrainEvents)
 		r.Get("/analytics/delayed", h.DelayedRankings)
 		r.Get("/analytics/reliable", h.ReliableRankings)
+
+		// JSON API
+		r.Mount("/v1", rest.New(svc).Routes())
 	})
 
+	// Cache metrics in the Prometheus text format
+	r.Handle("/metrics", apiClient)
+
 	// Static files
 	r.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
 
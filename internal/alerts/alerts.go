@@ -0,0 +1,244 @@
+// Package alerts evaluates user-defined rules against live train data and
+// notifies sinks (webhook, ntfy, email) when a watched train runs late, is
+// cancelled or changes platform.
+//
+// Rules and sinks are read from the JSON file named by TRENI_ALERTS:
+//
+//	{
+//	  "interval": "2m",
+//	  "sinks": {
+//	    "team": {"type": "webhook", "url": "https://example.com/hook"},
+//	    "phone": {"type": "ntfy", "url": "https://ntfy.sh/my-commute"},
+//	    "mail": {"type": "smtp", "host": "smtp.example.com", "from": "treni@example.com", "to": ["me@example.com"]}
+//	  },
+//	  "rules": [
+//	    {"name": "morning", "train": "2647", "stop": "S01520", "delay": 10,
+//	     "cancelled": true, "platform_change": true,
+//	     "window": {"from": "06:30", "until": "09:00", "days": ["mon", "tue", "wed", "thu", "fri"]},
+//	     "sinks": ["phone"]}
+//	  ]
+//	}
+//
+// Each incident is delivered once per sink: a train that stays late keeps
+// matching its rule, but only the first match of the service day notifies.
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+const defaultInterval = 2 * time.Minute
+
+// Rule days and hours are read in Italian time
+var rome = domain.Rome
+
+// Config is the content of the alerts file
+type Config struct {
+	// Interval between polls of each watched train, as a Go duration
+	Interval string                `json:"interval,omitempty"`
+	Sinks    map[string]SinkConfig `json:"sinks"`
+	Rules    []Rule                `json:"rules"`
+}
+
+// ConfigFromEnv loads the file named by TRENI_ALERTS, returning nil when
+// alerts are not configured
+func ConfigFromEnv() (*Config, error) {
+	path := os.Getenv("TRENI_ALERTS")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadConfig(path)
+}
+
+// LoadConfig reads and validates an alerts file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read alerts config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse alerts config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Alerter polls the trains named by its rules and notifies sinks
+type Alerter struct {
+	api      api.TrainClient
+	rules    []Rule
+	sinks    map[string]Sink
+	interval time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	fired map[string]time.Time // sink|event key -> service day
+}
+
+func New(api api.TrainClient, rules []Rule, sinks map[string]Sink) (*Alerter, error) {
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, err
+		}
+		for _, name := range rules[i].Sinks {
+			if _, ok := sinks[name]; !ok {
+				return nil, fmt.Errorf("rule %q: unknown sink %q", rules[i].Name, name)
+			}
+		}
+	}
+
+	return &Alerter{
+		api:      api,
+		rules:    rules,
+		sinks:    sinks,
+		interval: defaultInterval,
+		now:      time.Now,
+		fired:    make(map[string]time.Time),
+	}, nil
+}
+
+// FromConfig builds an alerter with the sinks and rules of cfg
+func FromConfig(api api.TrainClient, cfg *Config) (*Alerter, error) {
+	if len(cfg.Sinks) == 0 {
+		return nil, fmt.Errorf("alerts config has no sinks")
+	}
+	sinks := make(map[string]Sink, len(cfg.Sinks))
+	for name, sc := range cfg.Sinks {
+		sink, err := NewSink(sc)
+		if err != nil {
+			return nil, fmt.Errorf("sink %q: %w", name, err)
+		}
+		sinks[name] = sink
+	}
+
+	a, err := New(api, cfg.Rules, sinks)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d < 10*time.Second {
+			return nil, fmt.Errorf("invalid alerts interval %q (minimum 10s)", cfg.Interval)
+		}
+		a.interval = d
+	}
+	return a, nil
+}
+
+// Rules returns the number of configured rules
+func (a *Alerter) Rules() int {
+	return len(a.rules)
+}
+
+// Run checks the rules every interval and blocks until ctx is done
+func (a *Alerter) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		a.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check fetches every train with an active rule once and delivers the
+// events that have not fired yet
+func (a *Alerter) check(ctx context.Context) {
+	now := a.now()
+
+	byTrain := make(map[string][]*Rule)
+	for i := range a.rules {
+		r := &a.rules[i]
+		if r.active(now) {
+			byTrain[r.Train] = append(byTrain[r.Train], r)
+		}
+	}
+
+	trains := make([]string, 0, len(byTrain))
+	for t := range byTrain {
+		trains = append(trains, t)
+	}
+	sort.Strings(trains)
+
+	for _, t := range trains {
+		rules := byTrain[t]
+		reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		train, err := api.GetTrainRun(reqCtx, a.api, rules[0].ref)
+		cancel()
+		if err != nil {
+			log.Printf("alerts: get train %s: %v", t, err)
+			continue
+		}
+
+		for _, r := range rules {
+			for _, e := range r.evaluate(train, now) {
+				a.deliver(ctx, r, e)
+			}
+		}
+	}
+
+	a.forget(now)
+}
+
+// deliver sends e to every sink of the rule that has not received it yet.
+// A failed send is retried on the next check.
+func (a *Alerter) deliver(ctx context.Context, r *Rule, e Event) {
+	names := make([]string, 0, len(a.sinks))
+	for name := range a.sinks {
+		if r.wants(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := name + "|" + e.Key()
+		a.mu.Lock()
+		_, done := a.fired[key]
+		a.mu.Unlock()
+		if done {
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := a.sinks[name].Send(sendCtx, e)
+		cancel()
+		if err != nil {
+			log.Printf("alerts: send %q to %s: %v", e.Title(), name, err)
+			continue
+		}
+		log.Printf("alerts: sent %q to %s", e.Title(), name)
+
+		a.mu.Lock()
+		a.fired[key] = e.Date
+		a.mu.Unlock()
+	}
+}
+
+// forget drops incidents from service days that can no longer match
+func (a *Alerter) forget(now time.Time) {
+	cutoff := now.AddDate(0, 0, -2)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, day := range a.fired {
+		if day.Before(cutoff) {
+			delete(a.fired, key)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+type fakeClient struct {
+	train *domain.Train
+	calls int
+}
+
+func (f *fakeClient) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	f.calls++
+	return f.train, nil
+}
+
+func (f *fakeClient) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	return nil, nil
+}
+
+func (f *fakeClient) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	return nil, nil
+}
+
+type recordingSink struct {
+	events []Event
+	err    error
+}
+
+func (s *recordingSink) Send(ctx context.Context, e Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func testTrain() *domain.Train {
+	dep := time.Date(2025, 1, 20, 7, 10, 0, 0, rome)
+	return &domain.Train{
+		Number:        "2647",
+		Category:      "RV",
+		Origin:        "MILANO CENTRALE",
+		Destination:   "TIRANO",
+		DepartureTime: dep,
+		Delay:         3,
+		Status:        domain.TrainStatusOnTime,
+		Stops: []domain.Stop{
+			{StationCode: "S01700", StationName: "MILANO CENTRALE", ScheduledDepart: dep, Platform: "21", ScheduledPlatform: "21"},
+			{StationCode: "S01520", StationName: "LECCO", ScheduledArrival: dep.Add(40 * time.Minute), ScheduledDepart: dep.Add(42 * time.Minute), DepartureDelay: 3, Platform: "1", ScheduledPlatform: "1"},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2025, 1, 20, 7, 30, 0, 0, rome)
+
+	tests := []struct {
+		name  string
+		rule  Rule
+		edit  func(*domain.Train)
+		kinds []Kind
+	}{
+		{"on time", Rule{Train: "2647", Delay: 10, Cancelled: true}, nil, nil},
+		{"train delay", Rule{Train: "2647", Delay: 10}, func(tr *domain.Train) { tr.Delay = 12 }, []Kind{KindDelay}},
+		{"stop delay", Rule{Train: "2647", Stop: "S01520", Delay: 10}, func(tr *domain.Train) {
+			tr.Stops[1].ActualArrival = tr.Stops[1].ScheduledArrival.Add(15 * time.Minute)
+			tr.Stops[1].DepartureDelay = 15
+		}, []Kind{KindDelay}},
+		{"delay after the stop", Rule{Train: "2647", Stop: "S01520", Delay: 10}, func(tr *domain.Train) {
+			tr.Stops[1].ActualArrival = tr.Stops[1].ScheduledArrival.Add(3 * time.Minute)
+			tr.Delay = 15
+		}, nil},
+		{"stop still ahead", Rule{Train: "2647", Stop: "S01520", Delay: 10}, func(tr *domain.Train) {
+			tr.Stops[0].ActualDepart = tr.DepartureTime.Add(12 * time.Minute)
+			tr.Delay = 12
+		}, []Kind{KindDelay}},
+		{"cancelled", Rule{Train: "2647", Delay: 1, Cancelled: true}, func(tr *domain.Train) {
+			tr.Status = domain.TrainStatusCancelled
+			tr.Delay = 30
+		}, []Kind{KindCancelled}},
+		{"partially cancelled", Rule{Train: "2647", Cancelled: true}, func(tr *domain.Train) {
+			tr.Status = domain.TrainStatusPartiallyCancelled
+		}, []Kind{KindCancelled}},
+		{"stop cancelled", Rule{Train: "2647", Stop: "S01520", Delay: 1, Cancelled: true}, func(tr *domain.Train) {
+			tr.Status = domain.TrainStatusPartiallyCancelled
+			tr.Stops[1].Cancelled = true
+		}, []Kind{KindCancelled}},
+		{"cancelled elsewhere", Rule{Train: "2647", Stop: "S01700", Cancelled: true}, func(tr *domain.Train) {
+			tr.Status = domain.TrainStatusPartiallyCancelled
+			tr.Stops[1].Cancelled = true
+		}, nil},
+		{"scheduled platform only", Rule{Train: "2647", Stop: "S01520", PlatformChange: true}, func(tr *domain.Train) { tr.Stops[1].Platform = "3" }, nil},
+		{"platform change", Rule{Train: "2647", Stop: "S01520", PlatformChange: true}, func(tr *domain.Train) {
+			tr.Stops[1].Platform = "3"
+			tr.Stops[1].PlatformConfirmed = true
+		}, []Kind{KindPlatformChange}},
+		{"unknown stop", Rule{Train: "2647", Stop: "S99999", Delay: 1}, func(tr *domain.Train) { tr.Delay = 15 }, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			train := testTrain()
+			if tt.edit != nil {
+				tt.edit(train)
+			}
+
+			events := tt.rule.evaluate(train, now)
+			if len(events) != len(tt.kinds) {
+				t.Fatalf("got %d events %+v, want %v", len(events), events, tt.kinds)
+			}
+			for i, e := range events {
+				if e.Kind != tt.kinds[i] {
+					t.Errorf("event %d kind = %s, want %s", i, e.Kind, tt.kinds[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := &Window{From: "22:00", Until: "01:30", Days: []string{"mon", "Tuesday"}}
+	if err := w.parse(); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{time.Date(2025, 1, 20, 23, 0, 0, 0, rome), true},  // Monday
+		{time.Date(2025, 1, 21, 1, 0, 0, 0, rome), true},   // Tuesday
+		{time.Date(2025, 1, 21, 12, 0, 0, 0, rome), false}, // outside hours
+		{time.Date(2025, 1, 22, 23, 0, 0, 0, rome), false}, // Wednesday
+	}
+	for _, tt := range tests {
+		if got := w.contains(tt.t); got != tt.want {
+			t.Errorf("contains(%s) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestCheckFiresOncePerIncident(t *testing.T) {
+	client := &fakeClient{train: testTrain()}
+	phone, team := &recordingSink{}, &recordingSink{err: errors.New("down")}
+
+	a, err := New(client, []Rule{
+		{Name: "morning", Train: "2647", Delay: 10, Window: &Window{From: "06:00", Until: "10:00"}},
+		{Name: "lecco", Train: "2647", Stop: "S01520", PlatformChange: true, Sinks: []string{"phone"}},
+	}, map[string]Sink{"phone": phone, "team": team})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := time.Date(2025, 1, 20, 7, 30, 0, 0, rome)
+	a.now = func() time.Time { return now }
+
+	client.train.Delay = 12
+	a.check(context.Background())
+	a.check(context.Background())
+	if len(phone.events) != 1 || phone.events[0].Kind != KindDelay {
+		t.Fatalf("phone got %+v, want a single delay event", phone.events)
+	}
+	if client.calls != 2 {
+		t.Errorf("train fetched %d times, want once per check", client.calls)
+	}
+
+	// The failing sink receives the incident once it recovers
+	team.err = nil
+	a.check(context.Background())
+	if len(team.events) != 1 || len(phone.events) != 1 {
+		t.Errorf("after recovery team got %d events, phone %d", len(team.events), len(phone.events))
+	}
+
+	// A platform change fires again when the platform moves a second time
+	client.train.Stops[1].PlatformConfirmed = true
+	for _, p := range []string{"3", "3", "4"} {
+		client.train.Stops[1].Platform = p
+		a.check(context.Background())
+	}
+	if len(phone.events) != 3 {
+		t.Errorf("phone got %d events, want delay plus two platform changes", len(phone.events))
+	}
+
+	// Outside every window nothing is fetched
+	now = time.Date(2025, 1, 20, 11, 0, 0, 0, rome)
+	a.rules = a.rules[:1]
+	calls := client.calls
+	a.check(context.Background())
+	if client.calls != calls {
+		t.Error("train fetched outside the rule window")
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	sinks := map[string]Sink{"phone": &recordingSink{}}
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"no train", Rule{Delay: 5}},
+		{"no condition", Rule{Train: "2647"}},
+		{"platform without stop", Rule{Train: "2647", PlatformChange: true}},
+		{"bad window", Rule{Train: "2647", Delay: 5, Window: &Window{From: "7am", Until: "09:00"}}},
+		{"unknown sink", Rule{Train: "2647", Delay: 5, Sinks: []string{"pager"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&fakeClient{}, []Rule{tt.rule}, sinks); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+// Kind identifies what an alert is about
+type Kind string
+
+const (
+	KindDelay          Kind = "delay"
+	KindCancelled      Kind = "cancelled"
+	KindPlatformChange Kind = "platform_change"
+)
+
+// Rule describes when a train should raise an alert
+type Rule struct {
+	Name string `json:"name"`
+	// Train is a train number, or NUMBER/ORIGIN when several trains share it
+	Train string `json:"train"`
+	// Stop is the station code to watch; empty watches the train as a whole
+	Stop string `json:"stop,omitempty"`
+	// Delay fires once the delay reaches this many minutes; 0 disables it
+	Delay          int  `json:"delay,omitempty"`
+	Cancelled      bool `json:"cancelled,omitempty"`
+	PlatformChange bool `json:"platform_change,omitempty"`
+	// Window limits the rule to part of the day; nil means always
+	Window *Window `json:"window,omitempty"`
+	// Sinks names the sinks to notify; empty notifies all of them
+	Sinks []string `json:"sinks,omitempty"`
+
+	ref domain.TrainRef
+}
+
+// Window is a daily time range in Europe/Rome, optionally limited to some
+// days of the week
+type Window struct {
+	From  string   `json:"from"`  // HH:MM
+	Until string   `json:"until"` // HH:MM, may be earlier than From to span midnight
+	Days  []string `json:"days,omitempty"`
+
+	from, until int // minutes since midnight
+	days        map[time.Weekday]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (r *Rule) validate() error {
+	if r.Train == "" {
+		return fmt.Errorf("rule %q: train is required", r.Name)
+	}
+	if r.Name == "" {
+		r.Name = r.Train
+	}
+	ref, err := domain.ParseTrainRef(r.Train)
+	if err != nil {
+		return fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+	if !ref.Date.IsZero() {
+		return fmt.Errorf("rule %q: train must not include a date, rules apply every day", r.Name)
+	}
+	r.ref = ref
+	if r.Delay < 0 {
+		return fmt.Errorf("rule %q: delay must not be negative", r.Name)
+	}
+	if r.Delay == 0 && !r.Cancelled && !r.PlatformChange {
+		return fmt.Errorf("rule %q: set at least one of delay, cancelled or platform_change", r.Name)
+	}
+	if r.PlatformChange && r.Stop == "" {
+		return fmt.Errorf("rule %q: platform_change requires a stop", r.Name)
+	}
+	if r.Window != nil {
+		if err := r.Window.parse(); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func (w *Window) parse() error {
+	var err error
+	if w.from, err = parseClock(w.From); err != nil {
+		return fmt.Errorf("window from: %w", err)
+	}
+	if w.until, err = parseClock(w.Until); err != nil {
+		return fmt.Errorf("window until: %w", err)
+	}
+	if len(w.Days) > 0 {
+		w.days = make(map[time.Weekday]bool, len(w.Days))
+		for _, d := range w.Days {
+			wd, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+			if !ok {
+				return fmt.Errorf("unknown day %q", d)
+			}
+			w.days[wd] = true
+		}
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether t falls inside the window
+func (w *Window) contains(t time.Time) bool {
+	t = t.In(rome)
+	if w.days != nil && !w.days[t.Weekday()] {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if w.from <= w.until {
+		return m >= w.from && m <= w.until
+	}
+	return m >= w.from || m <= w.until
+}
+
+// active reports whether the rule applies at t
+func (r *Rule) active(t time.Time) bool {
+	return r.Window == nil || r.Window.contains(t)
+}
+
+// wants reports whether the rule delivers to the named sink
+func (r *Rule) wants(sink string) bool {
+	if len(r.Sinks) == 0 {
+		return true
+	}
+	for _, s := range r.Sinks {
+		if s == sink {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a single incident raised by a rule
+type Event struct {
+	Kind        Kind   `json:"kind"`
+	Rule        string `json:"rule"`
+	TrainNumber string `json:"train_number"`
+	Category    string `json:"category"`
+	Origin      string `json:"origin"`
+	Destination string `json:"destination"`
+	StationCode string `json:"station_code,omitempty"`
+	StationName string `json:"station_name,omitempty"`
+	Delay       int    `json:"delay"`
+	// Platform and ScheduledPlatform are set for platform changes
+	Platform          string `json:"platform,omitempty"`
+	ScheduledPlatform string `json:"scheduled_platform,omitempty"`
+	// Partial is set for a cancellation of part of the route only
+	Partial    bool      `json:"partial,omitempty"`
+	Date       time.Time `json:"date"` // service day
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// Key identifies the incident: the same key is never delivered twice
+func (e Event) Key() string {
+	key := strings.Join([]string{string(e.Kind), e.Rule, e.TrainNumber, e.StationCode, e.Date.Format("2006-01-02")}, "|")
+	if e.Kind == KindPlatformChange {
+		// Moving again to yet another platform is a new incident
+		key += "|" + e.Platform
+	}
+	if e.Partial {
+		// and so is cancelling the rest of a partly cancelled train
+		key += "|partial"
+	}
+	return key
+}
+
+// Title is a one-line summary of the event
+func (e Event) Title() string {
+	train := strings.TrimSpace(e.Category + " " + e.TrainNumber)
+	switch e.Kind {
+	case KindCancelled:
+		if e.Partial && e.StationName != "" {
+			return fmt.Sprintf("%s cancelled at %s", train, e.StationName)
+		}
+		if e.Partial {
+			return fmt.Sprintf("%s partially cancelled", train)
+		}
+		return fmt.Sprintf("%s cancelled", train)
+	case KindPlatformChange:
+		return fmt.Sprintf("%s platform change at %s", train, e.StationName)
+	default:
+		if e.StationName != "" {
+			return fmt.Sprintf("%s +%d min at %s", train, e.Delay, e.StationName)
+		}
+		return fmt.Sprintf("%s +%d min", train, e.Delay)
+	}
+}
+
+// Message describes the event in a few lines of plain text
+func (e Event) Message() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s → %s\n", strings.TrimSpace(e.Category+" "+e.TrainNumber), e.Origin, e.Destination)
+	switch e.Kind {
+	case KindCancelled:
+		switch {
+		case e.Partial && e.StationName != "":
+			fmt.Fprintf(&b, "The train no longer calls at %s.\n", e.StationName)
+		case e.Partial:
+			b.WriteString("The train has been cancelled on part of its route.\n")
+		default:
+			b.WriteString("The train has been cancelled.\n")
+		}
+	case KindPlatformChange:
+		fmt.Fprintf(&b, "Platform at %s changed from %s to %s.\n", e.StationName, e.ScheduledPlatform, e.Platform)
+	default:
+		if e.StationName != "" {
+			fmt.Fprintf(&b, "Running %d minutes late at %s.\n", e.Delay, e.StationName)
+		} else {
+			fmt.Fprintf(&b, "Running %d minutes late.\n", e.Delay)
+		}
+	}
+	fmt.Fprintf(&b, "Rule: %s", e.Rule)
+	return b.String()
+}
+
+// evaluate returns the events the rule raises for the train's current state
+func (r *Rule) evaluate(train *domain.Train, now time.Time) []Event {
+	base := Event{
+		Rule:        r.Name,
+		TrainNumber: train.Number,
+		Category:    train.Category,
+		Origin:      train.Origin,
+		Destination: train.Destination,
+		Delay:       train.Delay,
+		Date:        serviceDate(train, now),
+		DetectedAt:  now,
+	}
+
+	var stop *domain.Stop
+	if r.Stop != "" {
+		for i := range train.Stops {
+			if train.Stops[i].StationCode == r.Stop {
+				stop = &train.Stops[i]
+				break
+			}
+		}
+		if stop == nil {
+			return nil
+		}
+		base.StationCode = stop.StationCode
+		base.StationName = stop.StationName
+		base.Delay = stopDelay(train, stop)
+	}
+
+	// A partial cancellation matters to a rule watching the whole train, or
+	// one watching a stop the train no longer calls at
+	cancelled := train.Status == domain.TrainStatusCancelled
+	partial := !cancelled && (stop != nil && stop.Cancelled ||
+		stop == nil && train.Status == domain.TrainStatusPartiallyCancelled)
+
+	var events []Event
+	if r.Cancelled && (cancelled || partial) {
+		e := base
+		e.Kind = KindCancelled
+		e.Partial = partial
+		events = append(events, e)
+	}
+	if r.Delay > 0 && !cancelled && !(stop != nil && stop.Cancelled) && base.Delay >= r.Delay {
+		e := base
+		e.Kind = KindDelay
+		events = append(events, e)
+	}
+	if r.PlatformChange && stop != nil && stop.PlatformChanged() {
+		e := base
+		e.Kind = KindPlatformChange
+		e.Platform = stop.Platform
+		e.ScheduledPlatform = stop.ScheduledPlatform
+		events = append(events, e)
+	}
+	return events
+}
+
+// stopDelay is the delay that matters at a stop: departure where the train
+// departs, arrival at its destination. Providers report no delay at a stop
+// the train has not reached yet, so there the train's current delay stands
+// for the expected one.
+func stopDelay(train *domain.Train, s *domain.Stop) int {
+	if s.ActualArrival.IsZero() && s.ActualDepart.IsZero() {
+		return train.Delay
+	}
+	if !s.ScheduledDepart.IsZero() {
+		return s.DepartureDelay
+	}
+	return s.ArrivalDelay
+}
+
+// serviceDate is the day the train departed its origin
+func serviceDate(train *domain.Train, now time.Time) time.Time {
+	if day := train.ServiceDay(); !day.IsZero() {
+		return day
+	}
+	return domain.ServiceDay(now)
+}
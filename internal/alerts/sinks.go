@@ -0,0 +1,224 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sink delivers events to an external notification channel
+type Sink interface {
+	Send(ctx context.Context, e Event) error
+}
+
+// SinkConfig configures one sink; which fields apply depends on Type
+type SinkConfig struct {
+	Type string `json:"type"` // webhook, ntfy or smtp
+
+	// webhook and ntfy
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Token   string            `json:"token,omitempty"`
+
+	// smtp
+	Host     string   `json:"host,omitempty"`
+	Port     int      `json:"port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// NewSink builds the sink described by cfg
+func NewSink(cfg SinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook sink requires url")
+		}
+		return NewWebhook(cfg.URL, cfg.Headers), nil
+	case "ntfy":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("ntfy sink requires url")
+		}
+		return NewNtfy(cfg.URL, cfg.Token), nil
+	case "smtp":
+		if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("smtp sink requires host, from and to")
+		}
+		port := cfg.Port
+		if port == 0 {
+			port = 587
+		}
+		return NewSMTP(net.JoinHostPort(cfg.Host, strconv.Itoa(port)), cfg.Username, cfg.Password, cfg.From, cfg.To), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q (use webhook, ntfy or smtp)", cfg.Type)
+	}
+}
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Webhook posts each event as JSON to a URL
+type Webhook struct {
+	url     string
+	headers map[string]string
+}
+
+func NewWebhook(url string, headers map[string]string) *Webhook {
+	return &Webhook{url: url, headers: headers}
+}
+
+func (w *Webhook) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(struct {
+		Event
+		Title   string `json:"title"`
+		Message string `json:"message"`
+	}{e, e.Title(), e.Message()})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	return do(req)
+}
+
+// Ntfy publishes each event as a push notification to an ntfy topic URL
+type Ntfy struct {
+	url   string
+	token string
+}
+
+func NewNtfy(url, token string) *Ntfy {
+	return &Ntfy{url: url, token: token}
+}
+
+func (n *Ntfy) Send(ctx context.Context, e Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(e.Message()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", e.Title())
+	req.Header.Set("Tags", "train")
+	if e.Kind == KindCancelled {
+		req.Header.Set("Priority", "high")
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return do(req)
+}
+
+func do(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTP emails each event
+type SMTP struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTP returns a sink sending through the server at addr (host:port),
+// authenticating only when username is set
+func NewSMTP(addr, username, password, from string, to []string) *SMTP {
+	return &SMTP{addr: addr, username: username, password: password, from: from, to: to}
+}
+
+// Send delivers the event within ctx: the connection is bounded by its
+// deadline and dropped when it is cancelled, so a hung server cannot stall
+// the other sinks
+func (s *SMTP) Send(ctx context.Context, e Event) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(e)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s *SMTP) message(e Event) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	// Station names are not all ASCII, such as FORLÌ
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", e.Title()))
+	fmt.Fprintf(&b, "Date: %s\r\n", e.DetectedAt.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(e.Message(), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
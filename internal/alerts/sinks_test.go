@@ -0,0 +1,161 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEvent() Event {
+	return Event{
+		Kind:        KindDelay,
+		Rule:        "morning",
+		TrainNumber: "2647",
+		Category:    "RV",
+		Origin:      "MILANO CENTRALE",
+		Destination: "TIRANO",
+		StationCode: "S01520",
+		StationName: "LECCO",
+		Delay:       12,
+		Date:        time.Date(2025, 1, 20, 0, 0, 0, 0, rome),
+		DetectedAt:  time.Date(2025, 1, 20, 7, 30, 0, 0, rome),
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var got map[string]any
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("X-Token")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	sink, err := NewSink(SinkConfig{Type: "webhook", URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}})
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	if err := sink.Send(context.Background(), testEvent()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if auth != "secret" {
+		t.Errorf("header X-Token = %q", auth)
+	}
+	if got["kind"] != "delay" || got["train_number"] != "2647" || got["title"] != "RV 2647 +12 min at LECCO" {
+		t.Errorf("unexpected payload: %v", got)
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	var title, authz, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title = r.Header.Get("Title")
+		authz = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer srv.Close()
+
+	if err := NewNtfy(srv.URL+"/commute", "tk").Send(context.Background(), testEvent()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if title != "RV 2647 +12 min at LECCO" || authz != "Bearer tk" {
+		t.Errorf("title = %q, authorization = %q", title, authz)
+	}
+	if !strings.Contains(body, "Running 12 minutes late at LECCO") {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestSinkErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.URL, nil).Send(context.Background(), testEvent()); err == nil {
+		t.Error("expected an error for a 500 response")
+	}
+}
+
+func TestSMTPMessage(t *testing.T) {
+	s := NewSMTP("smtp.example.com:587", "", "", "treni@example.com", []string{"a@example.com", "b@example.com"})
+	msg := string(s.message(testEvent()))
+
+	for _, want := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: RV 2647 +12 min at LECCO\r\n",
+		"\r\n\r\nRV 2647 MILANO CENTRALE → TIRANO\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSMTPMessageEncodesSubject(t *testing.T) {
+	s := NewSMTP("smtp.example.com:587", "", "", "treni@example.com", []string{"a@example.com"})
+	e := testEvent()
+	e.StationName = "FORLÌ"
+	msg := string(s.message(e))
+
+	for _, want := range []string{
+		"Subject: =?utf-8?q?RV_2647_+12_min_at_FORL=C3=8C?=\r\n",
+		"MIME-Version: 1.0\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSMTPHonoursContext(t *testing.T) {
+	// A server that accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	s := NewSMTP(ln.Addr().String(), "", "", "treni@example.com", []string{"a@example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := s.Send(ctx, testEvent()); err == nil {
+		t.Fatal("Send should fail against a silent server")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %s, want it bounded by the context", elapsed)
+	}
+}
+
+func TestNewSinkValidates(t *testing.T) {
+	for _, cfg := range []SinkConfig{
+		{Type: "webhook"},
+		{Type: "ntfy"},
+		{Type: "smtp", Host: "smtp.example.com"},
+		{Type: "pager"},
+	} {
+		if _, err := NewSink(cfg); err == nil {
+			t.Errorf("NewSink(%+v) should fail", cfg)
+		}
+	}
+}
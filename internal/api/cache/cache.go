@@ -0,0 +1,375 @@
+// Package cache provides an api.TrainClient decorator that keeps recent
+// upstream responses in memory.
+//
+// Each endpoint has its own TTL. Concurrent lookups of the same key share a
+// single upstream request, and when a refresh fails the expired value is
+// served for up to MaxStale instead of the error. Callers always receive
+// their own copy, so they may modify results freely.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+// Upstream requests outlive the caller that started them, since other
+// callers may be waiting on the result
+const fetchTimeout = 30 * time.Second
+
+// maxEntries bounds each endpoint; beyond it, entries too old to be served
+// even as stale are dropped, then the oldest until a tenth of the room is
+// free again
+const maxEntries = 5000
+
+// Config sets how long each endpoint's responses stay fresh
+type Config struct {
+	Train   time.Duration
+	Station time.Duration
+	Search  time.Duration
+	Details time.Duration
+	// Find is how long the runs sharing a train number are kept
+	Find time.Duration
+	// MaxStale is how long past its TTL a value may be served when the
+	// upstream fails; 0 disables stale responses
+	MaxStale time.Duration
+}
+
+// DefaultConfig suits live boards: trains and stations move every minute or
+// so, while names and metadata rarely change
+var DefaultConfig = Config{
+	Train:    30 * time.Second,
+	Station:  30 * time.Second,
+	Search:   24 * time.Hour,
+	Details:  7 * 24 * time.Hour,
+	Find:     10 * time.Minute,
+	MaxStale: 10 * time.Minute,
+}
+
+// Client caches the responses of another client
+type Client struct {
+	next api.TrainClient
+
+	trains   *endpoint[*domain.Train]
+	stations *endpoint[*domain.Station]
+	searches *endpoint[[]domain.Station]
+	details  *endpoint[*domain.Station]
+	finds    *endpoint[[]domain.TrainRef]
+}
+
+func New(next api.TrainClient, cfg Config) *Client {
+	now := time.Now
+	return &Client{
+		next:     next,
+		trains:   newEndpoint("train", cfg.Train, cfg.MaxStale, cloneTrain, now),
+		stations: newEndpoint("station", cfg.Station, cfg.MaxStale, cloneStation, now),
+		searches: newEndpoint("search", cfg.Search, cfg.MaxStale, cloneStations, now),
+		details:  newEndpoint("details", cfg.Details, cfg.MaxStale, cloneStation, now),
+		finds:    newEndpoint("find", cfg.Find, cfg.MaxStale, cloneRefs, now),
+	}
+}
+
+func (c *Client) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	return c.trains.get(ctx, trainNumber, func(ctx context.Context) (*domain.Train, error) {
+		return c.next.GetTrain(ctx, trainNumber)
+	})
+}
+
+func (c *Client) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	return c.stations.get(ctx, stationCode, func(ctx context.Context) (*domain.Station, error) {
+		return c.next.GetStation(ctx, stationCode)
+	})
+}
+
+// GetStationAt implements api.StationBoard when the wrapped client does.
+// Boards share the station cache, keyed by code and minute.
+func (c *Client) GetStationAt(ctx context.Context, stationCode string, at time.Time) (*domain.Station, error) {
+	key := stationCode + "@" + at.UTC().Format("2006-01-02T15:04")
+	return c.stations.get(ctx, key, func(ctx context.Context) (*domain.Station, error) {
+		return api.GetStationAt(ctx, c.next, stationCode, at)
+	})
+}
+
+func (c *Client) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	return c.searches.get(ctx, query, func(ctx context.Context) ([]domain.Station, error) {
+		return c.next.SearchStation(ctx, query)
+	})
+}
+
+// GetStationDetails implements api.StationDirectory when the wrapped client does
+func (c *Client) GetStationDetails(ctx context.Context, stationCode string) (*domain.Station, error) {
+	dir, ok := c.next.(api.StationDirectory)
+	if !ok {
+		return nil, errors.New("station details not supported by provider")
+	}
+	return c.details.get(ctx, stationCode, func(ctx context.Context) (*domain.Station, error) {
+		return dir.GetStationDetails(ctx, stationCode)
+	})
+}
+
+// FindTrains implements api.TrainFinder for any wrapped client
+func (c *Client) FindTrains(ctx context.Context, trainNumber string) ([]domain.TrainRef, error) {
+	return c.finds.get(ctx, trainNumber, func(ctx context.Context) ([]domain.TrainRef, error) {
+		return api.FindTrains(ctx, c.next, trainNumber)
+	})
+}
+
+// GetTrainRun implements api.TrainFinder. Runs share the train cache, keyed
+// by the full ref.
+func (c *Client) GetTrainRun(ctx context.Context, ref domain.TrainRef) (*domain.Train, error) {
+	return c.trains.get(ctx, "run:"+ref.String(), func(ctx context.Context) (*domain.Train, error) {
+		return api.GetTrainRun(ctx, c.next, ref)
+	})
+}
+
+// Stats is a snapshot of one endpoint's counters
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Coalesced int64 `json:"coalesced"` // waited on another caller's request
+	Stale     int64 `json:"stale"`     // served expired after an upstream error
+	Errors    int64 `json:"errors"`    // upstream errors
+	Entries   int   `json:"entries"`
+}
+
+// Stats returns the counters of every endpoint by name
+func (c *Client) Stats() map[string]Stats {
+	return map[string]Stats{
+		c.trains.name:   c.trains.snapshot(),
+		c.stations.name: c.stations.snapshot(),
+		c.searches.name: c.searches.snapshot(),
+		c.details.name:  c.details.snapshot(),
+		c.finds.name:    c.finds.snapshot(),
+	}
+}
+
+// ServeHTTP writes the counters in the Prometheus text format
+func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WriteMetrics(w, c.Stats())
+}
+
+// WriteMetrics writes stats in the Prometheus text format
+func WriteMetrics(w io.Writer, stats map[string]Stats) {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP treni_cache_requests_total Cache lookups by endpoint and result.")
+	fmt.Fprintln(w, "# TYPE treni_cache_requests_total counter")
+	for _, name := range names {
+		s := stats[name]
+		for _, r := range []struct {
+			result string
+			n      int64
+		}{{"hit", s.Hits}, {"miss", s.Misses}, {"coalesced", s.Coalesced}, {"stale", s.Stale}} {
+			fmt.Fprintf(w, "treni_cache_requests_total{endpoint=%q,result=%q} %d\n", name, r.result, r.n)
+		}
+	}
+	fmt.Fprintln(w, "# HELP treni_cache_upstream_errors_total Failed upstream requests by endpoint.")
+	fmt.Fprintln(w, "# TYPE treni_cache_upstream_errors_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "treni_cache_upstream_errors_total{endpoint=%q} %d\n", name, stats[name].Errors)
+	}
+	fmt.Fprintln(w, "# HELP treni_cache_entries Cached responses by endpoint.")
+	fmt.Fprintln(w, "# TYPE treni_cache_entries gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "treni_cache_entries{endpoint=%q} %d\n", name, stats[name].Entries)
+	}
+}
+
+type entry[T any] struct {
+	value   T
+	fetched time.Time
+}
+
+// call is an upstream request shared by every caller asking for its key
+type call[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+type endpoint[T any] struct {
+	name     string
+	ttl      time.Duration
+	maxStale time.Duration
+	clone    func(T) T
+	now      func() time.Time
+	max      int
+
+	mu      sync.Mutex
+	entries map[string]entry[T]
+	calls   map[string]*call[T]
+
+	hits, misses, coalesced, stale, errors atomic.Int64
+}
+
+func newEndpoint[T any](name string, ttl, maxStale time.Duration, clone func(T) T, now func() time.Time) *endpoint[T] {
+	return &endpoint[T]{
+		name:     name,
+		ttl:      ttl,
+		maxStale: maxStale,
+		clone:    clone,
+		now:      now,
+		max:      maxEntries,
+		entries:  make(map[string]entry[T]),
+		calls:    make(map[string]*call[T]),
+	}
+}
+
+func (e *endpoint[T]) get(ctx context.Context, key string, fetch func(context.Context) (T, error)) (T, error) {
+	var zero T
+	now := e.now()
+
+	e.mu.Lock()
+	cached, ok := e.entries[key]
+	if ok && now.Sub(cached.fetched) < e.ttl {
+		e.mu.Unlock()
+		e.hits.Add(1)
+		return e.clone(cached.value), nil
+	}
+	c, inFlight := e.calls[key]
+	if inFlight {
+		e.coalesced.Add(1)
+	} else {
+		e.misses.Add(1)
+		c = &call[T]{done: make(chan struct{})}
+		e.calls[key] = c
+		go e.fetch(ctx, key, c, fetch)
+	}
+	e.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case <-c.done:
+	}
+
+	if c.err != nil {
+		if ok && e.servesStale(cached, now, c.err) {
+			e.stale.Add(1)
+			return e.clone(cached.value), nil
+		}
+		return zero, c.err
+	}
+	return e.clone(c.value), nil
+}
+
+func (e *endpoint[T]) fetch(ctx context.Context, key string, c *call[T], fetch func(context.Context) (T, error)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+	defer cancel()
+
+	c.value, c.err = fetch(ctx)
+
+	e.mu.Lock()
+	delete(e.calls, key)
+	if c.err == nil {
+		e.entries[key] = entry[T]{value: c.value, fetched: e.now()}
+		if len(e.entries) > e.max {
+			e.evict()
+		}
+	} else {
+		e.errors.Add(1)
+	}
+	e.mu.Unlock()
+
+	close(c.done)
+}
+
+// servesStale reports whether an expired entry may stand in for a failed
+// refresh. A train or station that no longer exists, or a number that now
+// matches several trains, is not a failure.
+func (e *endpoint[T]) servesStale(cached entry[T], now time.Time, err error) bool {
+	var ambiguous *api.AmbiguousTrainError
+	if errors.Is(err, api.ErrNotFound) || errors.As(err, &ambiguous) {
+		return false
+	}
+	return now.Sub(cached.fetched) < e.ttl+e.maxStale
+}
+
+// evict drops entries that can no longer be served, then the oldest ones
+// while the endpoint is still over its bound; callers hold mu
+func (e *endpoint[T]) evict() {
+	now := e.now()
+	for key, ent := range e.entries {
+		if now.Sub(ent.fetched) >= e.ttl+e.maxStale {
+			delete(e.entries, key)
+		}
+	}
+	if len(e.entries) <= e.max {
+		return
+	}
+
+	// Leaving some room spares a sort on every insert of a full endpoint
+	keys := make([]string, 0, len(e.entries))
+	for key := range e.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return e.entries[keys[i]].fetched.Before(e.entries[keys[j]].fetched)
+	})
+	for _, key := range keys[:len(keys)-e.max*9/10] {
+		delete(e.entries, key)
+	}
+}
+
+func (e *endpoint[T]) snapshot() Stats {
+	e.mu.Lock()
+	n := len(e.entries)
+	e.mu.Unlock()
+
+	return Stats{
+		Hits:      e.hits.Load(),
+		Misses:    e.misses.Load(),
+		Coalesced: e.coalesced.Load(),
+		Stale:     e.stale.Load(),
+		Errors:    e.errors.Load(),
+		Entries:   n,
+	}
+}
+
+func cloneTrain(t *domain.Train) *domain.Train {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.Stops = append([]domain.Stop(nil), t.Stops...)
+	return &c
+}
+
+func cloneStation(s *domain.Station) *domain.Station {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Arrivals = append([]domain.Arrival(nil), s.Arrivals...)
+	c.Departures = append([]domain.Departure(nil), s.Departures...)
+	return &c
+}
+
+func cloneStations(s []domain.Station) []domain.Station {
+	if s == nil {
+		return nil
+	}
+	c := make([]domain.Station, len(s))
+	for i := range s {
+		c[i] = *cloneStation(&s[i])
+	}
+	return c
+}
+
+func cloneRefs(r []domain.TrainRef) []domain.TrainRef {
+	return append([]domain.TrainRef(nil), r...)
+}
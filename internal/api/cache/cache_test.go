@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+type fakeClient struct {
+	calls   atomic.Int32
+	err     error
+	release chan struct{} // when set, GetTrain blocks until closed
+}
+
+func (f *fakeClient) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &domain.Train{Number: trainNumber, Delay: int(f.calls.Load()), Stops: []domain.Stop{{StationCode: "S01700"}}}, nil
+}
+
+func (f *fakeClient) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	f.calls.Add(1)
+	return &domain.Station{Code: stationCode, Departures: []domain.Departure{{TrainNumber: "9311"}}}, nil
+}
+
+func (f *fakeClient) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	f.calls.Add(1)
+	return []domain.Station{{Code: "S01700", Name: "MILANO CENTRALE"}}, nil
+}
+
+// newTestClient returns a cache whose clock is advanced by the returned func
+func newTestClient(next api.TrainClient) (*Client, func(time.Duration)) {
+	c := New(next, DefaultConfig)
+	now := time.Date(2025, 1, 20, 8, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	c.trains.now, c.stations.now, c.searches.now, c.details.now, c.finds.now = clock, clock, clock, clock, clock
+	return c, func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+}
+
+func TestTTL(t *testing.T) {
+	next := &fakeClient{}
+	c, advance := newTestClient(next)
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := c.GetTrain(ctx, "9311"); err != nil {
+			t.Fatalf("GetTrain failed: %v", err)
+		}
+	}
+	if next.calls.Load() != 1 {
+		t.Fatalf("upstream called %d times, want 1", next.calls.Load())
+	}
+
+	advance(DefaultConfig.Train)
+	train, _ := c.GetTrain(ctx, "9311")
+	if next.calls.Load() != 2 || train.Delay != 2 {
+		t.Errorf("expired entry not refreshed: calls=%d delay=%d", next.calls.Load(), train.Delay)
+	}
+
+	// Search results live much longer than boards
+	c.SearchStation(ctx, "milano")
+	advance(time.Hour)
+	c.SearchStation(ctx, "milano")
+	if next.calls.Load() != 3 {
+		t.Errorf("search not cached: calls=%d", next.calls.Load())
+	}
+
+	s := c.Stats()["train"]
+	if s.Hits != 2 || s.Misses != 2 || s.Entries != 1 {
+		t.Errorf("unexpected train stats: %+v", s)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	next := &fakeClient{release: make(chan struct{})}
+	c, _ := newTestClient(next)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetTrain(context.Background(), "9311"); err != nil {
+				t.Errorf("GetTrain failed: %v", err)
+			}
+		}()
+	}
+
+	// Wait until every caller is queued behind the first request
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if s := c.Stats()["train"]; s.Misses+s.Coalesced == 20 {
+			break
+		}
+	}
+	close(next.release)
+	wg.Wait()
+
+	if next.calls.Load() != 1 {
+		t.Errorf("upstream called %d times, want 1", next.calls.Load())
+	}
+	if s := c.Stats()["train"]; s.Misses != 1 || s.Coalesced != 19 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestStaleOnError(t *testing.T) {
+	next := &fakeClient{}
+	c, advance := newTestClient(next)
+	ctx := context.Background()
+
+	c.GetTrain(ctx, "9311")
+	next.err = errors.New("unexpected status: 503")
+
+	advance(DefaultConfig.Train + time.Minute)
+	train, err := c.GetTrain(ctx, "9311")
+	if err != nil || train.Delay != 1 {
+		t.Fatalf("expected the stale train, got %+v, %v", train, err)
+	}
+
+	advance(DefaultConfig.MaxStale)
+	if _, err := c.GetTrain(ctx, "9311"); err == nil {
+		t.Error("values past MaxStale should not be served")
+	}
+
+	s := c.Stats()["train"]
+	if s.Stale != 1 || s.Errors != 2 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestNotFoundIsNotServedStale(t *testing.T) {
+	next := &fakeClient{}
+	c, advance := newTestClient(next)
+
+	c.GetTrain(context.Background(), "9311")
+	next.err = fmt.Errorf("train 9311: %w", api.ErrNotFound)
+	advance(DefaultConfig.Train)
+
+	if _, err := c.GetTrain(context.Background(), "9311"); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestCallersGetCopies(t *testing.T) {
+	c, _ := newTestClient(&fakeClient{})
+	ctx := context.Background()
+
+	st, _ := c.GetStation(ctx, "S01700")
+	st.Name = "changed"
+	st.Departures[0].TrainNumber = "changed"
+
+	st, _ = c.GetStation(ctx, "S01700")
+	if st.Name != "" || st.Departures[0].TrainNumber != "9311" {
+		t.Errorf("cached station was modified: %+v", st)
+	}
+}
+
+func TestEvictsOldestOverBound(t *testing.T) {
+	next := &fakeClient{}
+	c, advance := newTestClient(next)
+	c.trains.max = 10
+	ctx := context.Background()
+
+	// Every entry is still fresh, yet the bound holds
+	for i := range 11 {
+		c.GetTrain(ctx, fmt.Sprint(i))
+		advance(time.Second)
+	}
+	if n := c.Stats()["train"].Entries; n != 9 {
+		t.Fatalf("entries = %d, want 9", n)
+	}
+
+	c.GetTrain(ctx, "10")
+	if next.calls.Load() != 11 {
+		t.Errorf("newest entry evicted: calls=%d", next.calls.Load())
+	}
+	c.GetTrain(ctx, "0")
+	if next.calls.Load() != 12 {
+		t.Errorf("oldest entry kept: calls=%d", next.calls.Load())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	c, _ := newTestClient(&fakeClient{})
+	c.GetTrain(context.Background(), "9311")
+	c.GetTrain(context.Background(), "9311")
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`treni_cache_requests_total{endpoint="train",result="hit"} 1`,
+		`treni_cache_requests_total{endpoint="train",result="miss"} 1`,
+		`treni_cache_entries{endpoint="train"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -2,12 +2,117 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/emiliopalmerini/treni/internal/domain"
 )
 
+var (
+	// ErrNotFound is wrapped by clients when the train or station does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrUpstreamDown is wrapped when the provider cannot be reached, keeps
+	// failing, or is being rested by a circuit breaker
+	ErrUpstreamDown = errors.New("upstream unavailable")
+	// ErrParse is wrapped when a provider response cannot be decoded
+	ErrParse = errors.New("unexpected upstream response")
+)
+
+// StatusError is returned for an unexpected HTTP status. It matches
+// ErrNotFound for 404 and ErrUpstreamDown for 429 and 5xx.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d", e.Code)
+}
+
+func (e *StatusError) Unwrap() error {
+	switch {
+	case e.Code == http.StatusNotFound:
+		return ErrNotFound
+	case e.Code == http.StatusTooManyRequests || e.Code >= 500:
+		return ErrUpstreamDown
+	default:
+		return nil
+	}
+}
+
+// AmbiguousTrainError is returned when a train number matches several runs
+// and the caller has to pick one of the candidates
+type AmbiguousTrainError struct {
+	Number     string
+	Candidates []domain.TrainRef
+}
+
+func (e *AmbiguousTrainError) Error() string {
+	return fmt.Sprintf("train %s: %d trains share this number, specify the origin", e.Number, len(e.Candidates))
+}
+
 type TrainClient interface {
 	GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error)
 	GetStation(ctx context.Context, stationCode string) (*domain.Station, error)
 	SearchStation(ctx context.Context, query string) ([]domain.Station, error)
 }
+
+// StationDirectory is implemented by clients that can look up a station's
+// full metadata (name, region, coordinates) from its code
+type StationDirectory interface {
+	GetStationDetails(ctx context.Context, stationCode string) (*domain.Station, error)
+}
+
+// StationBoard is implemented by clients that can show a station's board as
+// it stands at another time than now
+type StationBoard interface {
+	// GetStationAt returns the arrivals and departures around at
+	GetStationAt(ctx context.Context, stationCode string, at time.Time) (*domain.Station, error)
+}
+
+// GetStationAt returns the station board at the given time, or the current
+// board when at is zero
+func GetStationAt(ctx context.Context, client TrainClient, stationCode string, at time.Time) (*domain.Station, error) {
+	if at.IsZero() {
+		return client.GetStation(ctx, stationCode)
+	}
+	b, ok := client.(StationBoard)
+	if !ok {
+		return nil, errors.New("station boards at a given time not supported by provider")
+	}
+	return b.GetStationAt(ctx, stationCode, at)
+}
+
+// TrainFinder is implemented by clients that can tell apart trains sharing a
+// number. Their GetTrain returns an *AmbiguousTrainError when it matches more
+// than one run.
+type TrainFinder interface {
+	// FindTrains lists the runs carrying the train number
+	FindTrains(ctx context.Context, trainNumber string) ([]domain.TrainRef, error)
+	// GetTrainRun fetches the run identified by ref. An empty OriginCode
+	// matches any origin and a zero Date means today.
+	GetTrainRun(ctx context.Context, ref domain.TrainRef) (*domain.Train, error)
+}
+
+// FindTrains lists the runs carrying a train number. Clients that are not
+// TrainFinders know a single run per number, which is looked up directly.
+func FindTrains(ctx context.Context, client TrainClient, trainNumber string) ([]domain.TrainRef, error) {
+	if f, ok := client.(TrainFinder); ok {
+		return f.FindTrains(ctx, trainNumber)
+	}
+	train, err := client.GetTrain(ctx, trainNumber)
+	if err != nil {
+		return nil, err
+	}
+	return []domain.TrainRef{train.Ref()}, nil
+}
+
+// GetTrainRun fetches the run identified by ref, falling back to a lookup by
+// number for clients that are not TrainFinders
+func GetTrainRun(ctx context.Context, client TrainClient, ref domain.TrainRef) (*domain.Train, error) {
+	if f, ok := client.(TrainFinder); ok {
+		return f.GetTrainRun(ctx, ref)
+	}
+	return client.GetTrain(ctx, ref.Number)
+}
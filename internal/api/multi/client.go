@@ -0,0 +1,275 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+// Provider is a named TrainClient. Providers earlier in the list given to New
+// have higher priority.
+type Provider struct {
+	Name   string
+	Client api.TrainClient
+}
+
+// Client queries several providers at once. The highest priority provider that
+// answers supplies the result; the others fill in what it is missing.
+type Client struct {
+	providers []Provider
+}
+
+func New(providers ...Provider) *Client {
+	return &Client{providers: providers}
+}
+
+type trainResult struct {
+	train *domain.Train
+	err   error
+}
+
+func (c *Client) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	return c.getTrain(func(client api.TrainClient) (*domain.Train, error) {
+		return client.GetTrain(ctx, trainNumber)
+	})
+}
+
+// GetTrainRun asks every provider for the run; those that cannot tell runs
+// apart look the number up
+func (c *Client) GetTrainRun(ctx context.Context, ref domain.TrainRef) (*domain.Train, error) {
+	return c.getTrain(func(client api.TrainClient) (*domain.Train, error) {
+		return api.GetTrainRun(ctx, client, ref)
+	})
+}
+
+// FindTrains returns the runs known to the highest priority provider that
+// finds any
+func (c *Client) FindTrains(ctx context.Context, trainNumber string) ([]domain.TrainRef, error) {
+	var errs []error
+	for _, p := range c.providers {
+		refs, err := api.FindTrains(ctx, p.Client, trainNumber)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		if len(refs) > 0 {
+			return refs, nil
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// getTrain fetches a train from every provider at once and merges the answers
+func (c *Client) getTrain(fetch func(api.TrainClient) (*domain.Train, error)) (*domain.Train, error) {
+	results := make([]trainResult, len(c.providers))
+
+	var wg sync.WaitGroup
+	for i, p := range c.providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+			train, err := fetch(p.Client)
+			results[i] = trainResult{train: train, err: err}
+		}(i, p)
+	}
+	wg.Wait()
+
+	var primary *domain.Train
+	var errs []error
+	for i, r := range results {
+		name := c.providers[i].Name
+		// The other providers' answer may well be a different train
+		var ambiguous *api.AmbiguousTrainError
+		if errors.As(r.err, &ambiguous) {
+			return nil, ambiguous
+		}
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, r.err))
+			continue
+		}
+		if primary == nil {
+			primary = tagTrain(r.train, name)
+			continue
+		}
+		mergeTrain(primary, r.train, name)
+	}
+
+	if primary == nil {
+		return nil, errors.Join(errs...)
+	}
+	return primary, nil
+}
+
+func (c *Client) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	var errs []error
+	for _, p := range c.providers {
+		station, err := p.Client.GetStation(ctx, stationCode)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		if station.Source == "" {
+			station.Source = p.Name
+		}
+		return station, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// GetStationAt asks each provider that can show a board at another time, in
+// priority order
+func (c *Client) GetStationAt(ctx context.Context, stationCode string, at time.Time) (*domain.Station, error) {
+	var errs []error
+	for _, p := range c.providers {
+		if _, ok := p.Client.(api.StationBoard); !ok {
+			continue
+		}
+		station, err := api.GetStationAt(ctx, p.Client, stationCode, at)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		if station.Source == "" {
+			station.Source = p.Name
+		}
+		return station, nil
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no provider has station boards at a given time")
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *Client) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	var stations []domain.Station
+	var errs []error
+	seen := make(map[string]bool)
+	answered := false
+
+	for _, p := range c.providers {
+		results, err := p.Client.SearchStation(ctx, query)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		answered = true
+		for _, s := range results {
+			if seen[s.Code] {
+				continue
+			}
+			seen[s.Code] = true
+			stations = append(stations, s)
+		}
+	}
+
+	if !answered {
+		return nil, errors.Join(errs...)
+	}
+	return stations, nil
+}
+
+// GetStationDetails asks each provider that has a station directory, in
+// priority order
+func (c *Client) GetStationDetails(ctx context.Context, stationCode string) (*domain.Station, error) {
+	var errs []error
+	for _, p := range c.providers {
+		dir, ok := p.Client.(api.StationDirectory)
+		if !ok {
+			continue
+		}
+		station, err := dir.GetStationDetails(ctx, stationCode)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		return station, nil
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no provider has a station directory")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// tagTrain fills in any Source fields the provider left empty
+func tagTrain(train *domain.Train, name string) *domain.Train {
+	if train.Source == "" {
+		train.Source = name
+	}
+	for i := range train.Stops {
+		if train.Stops[i].Source == "" {
+			train.Stops[i].Source = name
+		}
+		if train.Stops[i].PlatformSource == "" && train.Stops[i].Platform != "" {
+			train.Stops[i].PlatformSource = name
+		}
+	}
+	return train
+}
+
+// mergeTrain fills fields missing from primary with data from a lower
+// priority provider, recording that provider as their source
+func mergeTrain(primary, other *domain.Train, name string) {
+	if primary.Status == domain.TrainStatusUnknown && other.Status != domain.TrainStatusUnknown {
+		primary.Status = other.Status
+	}
+	if primary.LastUpdate.IsZero() {
+		primary.LastUpdate = other.LastUpdate
+	}
+	if primary.LastStation == "" {
+		primary.LastStation = other.LastStation
+	}
+	if len(primary.Stops) == 0 && len(other.Stops) > 0 {
+		primary.Stops = tagTrain(&domain.Train{Stops: other.Stops}, name).Stops
+		return
+	}
+
+	byStation := make(map[string]domain.Stop, len(other.Stops))
+	for _, s := range other.Stops {
+		byStation[stopKey(s)] = s
+	}
+
+	for i := range primary.Stops {
+		s, ok := byStation[stopKey(primary.Stops[i])]
+		if !ok {
+			continue
+		}
+		mergeStop(&primary.Stops[i], s, name)
+	}
+}
+
+func mergeStop(stop *domain.Stop, other domain.Stop, name string) {
+	// A confirmed platform beats a scheduled one
+	if other.Platform != "" && (stop.Platform == "" || (!stop.PlatformConfirmed && other.PlatformConfirmed)) {
+		stop.Platform = other.Platform
+		stop.PlatformConfirmed = other.PlatformConfirmed
+		stop.PlatformSource = name
+	}
+	if stop.ScheduledPlatform == "" {
+		stop.ScheduledPlatform = other.ScheduledPlatform
+	}
+
+	// Take actual times only when the primary has not detected the train here
+	if stop.ActualArrival.IsZero() && stop.ActualDepart.IsZero() &&
+		(!other.ActualArrival.IsZero() || !other.ActualDepart.IsZero()) {
+		stop.ActualArrival = other.ActualArrival
+		stop.ActualDepart = other.ActualDepart
+		stop.ArrivalDelay = other.ArrivalDelay
+		stop.DepartureDelay = other.DepartureDelay
+		stop.Source = name
+	}
+}
+
+// stopKey matches stops across providers by station code, falling back to
+// the station name when a provider does not publish codes
+func stopKey(s domain.Stop) string {
+	if s.StationCode != "" {
+		return s.StationCode
+	}
+	return strings.ToUpper(strings.TrimSpace(s.StationName))
+}
@@ -0,0 +1,135 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+type fakeClient struct {
+	train    *domain.Train
+	station  *domain.Station
+	stations []domain.Station
+	err      error
+}
+
+func (f *fakeClient) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.train, nil
+}
+
+func (f *fakeClient) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.station, nil
+}
+
+func (f *fakeClient) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.stations, nil
+}
+
+func TestGetTrainFallback(t *testing.T) {
+	c := New(
+		Provider{Name: "first", Client: &fakeClient{err: errors.New("upstream down")}},
+		Provider{Name: "second", Client: &fakeClient{train: &domain.Train{Number: "10911", Delay: 3}}},
+	)
+
+	train, err := c.GetTrain(context.Background(), "10911")
+	if err != nil {
+		t.Fatalf("GetTrain failed: %v", err)
+	}
+	if train.Source != "second" {
+		t.Errorf("source = %q, want second", train.Source)
+	}
+	if train.Delay != 3 {
+		t.Errorf("delay = %d, want 3", train.Delay)
+	}
+}
+
+func TestGetTrainAllFail(t *testing.T) {
+	c := New(
+		Provider{Name: "first", Client: &fakeClient{err: errors.New("boom")}},
+		Provider{Name: "second", Client: &fakeClient{err: errors.New("bang")}},
+	)
+
+	if _, err := c.GetTrain(context.Background(), "10911"); err == nil {
+		t.Fatal("expected error when every provider fails")
+	}
+}
+
+func TestGetTrainMergesStops(t *testing.T) {
+	arrival := time.Date(2025, 1, 18, 8, 10, 0, 0, time.UTC)
+
+	primary := &domain.Train{
+		Number: "10911",
+		Source: "first",
+		Stops: []domain.Stop{
+			{StationCode: "S01062", Platform: "2", PlatformConfirmed: true, Source: "first", PlatformSource: "first"},
+			{StationCode: "S01700", Platform: "3", Source: "first", PlatformSource: "first"},
+		},
+	}
+	secondary := &domain.Train{
+		Number: "10911",
+		Source: "second",
+		Stops: []domain.Stop{
+			{StationCode: "S01062", Platform: "5", PlatformConfirmed: true},
+			{StationCode: "S01700", Platform: "4", PlatformConfirmed: true, ActualArrival: arrival, ArrivalDelay: 6},
+		},
+	}
+
+	c := New(
+		Provider{Name: "first", Client: &fakeClient{train: primary}},
+		Provider{Name: "second", Client: &fakeClient{train: secondary}},
+	)
+
+	train, err := c.GetTrain(context.Background(), "10911")
+	if err != nil {
+		t.Fatalf("GetTrain failed: %v", err)
+	}
+	if train.Source != "first" {
+		t.Errorf("source = %q, want first", train.Source)
+	}
+
+	origin := train.Stops[0]
+	if origin.Platform != "2" || origin.PlatformSource != "first" {
+		t.Errorf("confirmed platform should not be replaced: %+v", origin)
+	}
+
+	dest := train.Stops[1]
+	if dest.Platform != "4" || !dest.PlatformConfirmed || dest.PlatformSource != "second" {
+		t.Errorf("expected confirmed platform from second: %+v", dest)
+	}
+	if !dest.ActualArrival.Equal(arrival) || dest.ArrivalDelay != 6 || dest.Source != "second" {
+		t.Errorf("expected actual arrival from second: %+v", dest)
+	}
+}
+
+func TestSearchStationMergesResults(t *testing.T) {
+	c := New(
+		Provider{Name: "first", Client: &fakeClient{stations: []domain.Station{{Code: "S01700", Name: "Milano Centrale"}}}},
+		Provider{Name: "second", Client: &fakeClient{stations: []domain.Station{
+			{Code: "S01700", Name: "MILANO CENTRALE"},
+			{Code: "S01645", Name: "MILANO PORTA GARIBALDI"},
+		}}},
+	)
+
+	stations, err := c.SearchStation(context.Background(), "Milano")
+	if err != nil {
+		t.Fatalf("SearchStation failed: %v", err)
+	}
+	if len(stations) != 2 {
+		t.Fatalf("got %d stations, want 2", len(stations))
+	}
+	if stations[0].Name != "Milano Centrale" {
+		t.Errorf("higher priority provider should win, got %q", stations[0].Name)
+	}
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/api/multi"
+	"github.com/emiliopalmerini/treni/internal/api/trenord"
+	"github.com/emiliopalmerini/treni/internal/api/viaggiatreno"
+)
+
+// Supported provider names
+const (
+	ViaggiaTreno = viaggiatreno.Name
+	Trenord      = trenord.Name
+)
+
+// Default is used when no provider is configured
+const Default = ViaggiaTreno
+
+// New returns the client for the named provider. A comma-separated list such
+// as "viaggiatreno,trenord" builds a client that queries every provider, in
+// that priority order, and falls back when one fails.
+func New(spec string) (api.TrainClient, error) {
+	names := parseNames(spec)
+	if len(names) == 0 {
+		names = []string{Default}
+	}
+
+	providers := make([]multi.Provider, len(names))
+	for i, name := range names {
+		client, err := newSingle(name)
+		if err != nil {
+			return nil, err
+		}
+		providers[i] = multi.Provider{Name: name, Client: client}
+	}
+
+	if len(providers) == 1 {
+		return providers[0].Client, nil
+	}
+	return multi.New(providers...), nil
+}
+
+// FromEnv returns the client selected by TRENI_PROVIDER
+func FromEnv() (api.TrainClient, error) {
+	return New(os.Getenv("TRENI_PROVIDER"))
+}
+
+func newSingle(name string) (api.TrainClient, error) {
+	switch name {
+	case ViaggiaTreno:
+		return viaggiatreno.New(), nil
+	case Trenord:
+		return trenord.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q (use %s or %s)", name, ViaggiaTreno, Trenord)
+	}
+}
+
+func parseNames(spec string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
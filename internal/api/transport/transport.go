@@ -0,0 +1,307 @@
+// Package transport makes resilient GET requests to a provider: calls are
+// rate limited, transient failures are retried with exponential backoff and
+// jitter, and a circuit breaker stops calling a provider that keeps failing.
+//
+// Errors wrap the api sentinels: api.ErrNotFound for 404, and
+// api.ErrUpstreamDown for network errors, timeouts, 429, 5xx and an open
+// circuit.
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+)
+
+// Options configures a Client. Zero values disable the matching feature.
+type Options struct {
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts after a transient failure
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; it doubles after
+	// each attempt up to MaxDelay, and a random part is subtracted as jitter
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// RateLimit is the sustained number of requests per second, with bursts
+	// of up to Burst requests
+	RateLimit float64
+	Burst     int
+	// After BreakerThreshold consecutive transient failures, requests fail
+	// immediately for BreakerCooldown before one trial request is let through
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// DefaultOptions are polite to a public, unauthenticated API
+var DefaultOptions = Options{
+	Timeout:          15 * time.Second,
+	MaxRetries:       3,
+	BaseDelay:        500 * time.Millisecond,
+	MaxDelay:         8 * time.Second,
+	RateLimit:        5,
+	Burst:            10,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+type Client struct {
+	httpClient *http.Client
+	opts       Options
+	limiter    *limiter
+	breaker    *breaker
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+func New(opts Options) *Client {
+	c := &Client{
+		httpClient: &http.Client{Timeout: opts.Timeout},
+		opts:       opts,
+		sleep:      sleep,
+	}
+	if opts.RateLimit > 0 {
+		c.limiter = newLimiter(opts.RateLimit, max(opts.Burst, 1), time.Now)
+	}
+	if opts.BreakerThreshold > 0 {
+		c.breaker = newBreaker(opts.BreakerThreshold, opts.BreakerCooldown, time.Now)
+	}
+	return c
+}
+
+// Get fetches url and returns the body of a 200 response
+func (c *Client) Get(ctx context.Context, url string) ([]byte, error) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		var body []byte
+		body, err = c.attempt(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+		if errors.Is(err, errCircuitOpen) || !transient(err) || attempt >= c.opts.MaxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+		if serr := c.sleep(ctx, c.backoff(attempt)); serr != nil {
+			return nil, err
+		}
+	}
+}
+
+var errCircuitOpen = fmt.Errorf("%w: circuit breaker open", api.ErrUpstreamDown)
+
+func (c *Client) attempt(ctx context.Context, url string) ([]byte, error) {
+	if c.breaker != nil && !c.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+	if c.limiter != nil {
+		if err := c.limiter.wait(ctx, c.sleep); err != nil {
+			c.abort()
+			return nil, err
+		}
+	}
+
+	body, err := c.do(ctx, url)
+	if ctx.Err() != nil {
+		// The caller gave up; that says nothing about the provider
+		c.abort()
+	} else if c.breaker != nil {
+		c.breaker.record(!transient(err))
+	}
+	return body, err
+}
+
+func (c *Client) abort() {
+	if c.breaker != nil {
+		c.breaker.abort()
+	}
+}
+
+func (c *Client) do(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %w", api.ErrUpstreamDown, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, &api.StatusError{Code: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read body: %w", api.ErrUpstreamDown, err)
+	}
+	return body, nil
+}
+
+// transient reports whether err may go away by itself
+func transient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, api.ErrUpstreamDown) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// backoff is the delay before retry number attempt+1: exponential, capped,
+// with up to half of it removed at random
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.opts.BaseDelay << attempt
+	if d <= 0 || (c.opts.MaxDelay > 0 && d > c.opts.MaxDelay) {
+		d = c.opts.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d - rand.N(d/2+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limiter is a token bucket. Waiting callers reserve their token up front,
+// so they are served in arrival order.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newLimiter(rate float64, burst int, now func() time.Time) *limiter {
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: now(), now: now}
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel returns an unused token
+func (l *limiter) cancel() {
+	l.mu.Lock()
+	l.tokens = min(l.burst, l.tokens+1)
+	l.mu.Unlock()
+}
+
+func (l *limiter) wait(ctx context.Context, sleep func(context.Context, time.Duration) error) error {
+	d := l.reserve()
+	if d == 0 {
+		return nil
+	}
+	if err := sleep(ctx, d); err != nil {
+		l.cancel()
+		return err
+	}
+	return nil
+}
+
+type breakerState int
+
+const (
+	closed breakerState = iota
+	open
+	halfOpen
+)
+
+// breaker opens after threshold consecutive failures and lets a single trial
+// request through once cooldown has passed
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration, now func() time.Time) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: now}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case open:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = halfOpen
+		return true
+	case halfOpen:
+		// A trial request is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// abort ends a trial request without a verdict, so the next caller can try
+func (b *breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == halfOpen {
+		b.state = open
+	}
+}
+
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		b.state = closed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == halfOpen || b.failures >= b.threshold {
+		b.state = open
+		b.openedAt = b.now()
+	}
+}
@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+)
+
+// newTestClient returns a client that records its sleeps instead of waiting
+func newTestClient(opts Options) (*Client, *[]time.Duration) {
+	c := New(opts)
+	var mu sync.Mutex
+	var slept []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		mu.Lock()
+		slept = append(slept, d)
+		mu.Unlock()
+		return ctx.Err()
+	}
+	return c, &slept
+}
+
+// statusServer answers with the given statuses in turn, then 200
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetriesTransientFailures(t *testing.T) {
+	srv, calls := statusServer(t, http.StatusBadGateway, http.StatusTooManyRequests)
+	c, slept := newTestClient(Options{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+
+	body, err := c.Get(context.Background(), srv.URL)
+	if err != nil || string(body) != "ok" {
+		t.Fatalf("Get = %q, %v", body, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("server called %d times, want 3", calls.Load())
+	}
+
+	// Each backoff doubles, minus at most half as jitter
+	if len(*slept) != 2 {
+		t.Fatalf("slept %d times, want 2", len(*slept))
+	}
+	for i, d := range *slept {
+		hi := 100 * time.Millisecond << i
+		if d < hi/2 || d > hi {
+			t.Errorf("backoff %d = %v, want between %v and %v", i, d, hi/2, hi)
+		}
+	}
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	srv, calls := statusServer(t, 500, 500, 500, 500, 500)
+	c, _ := newTestClient(Options{MaxRetries: 2})
+
+	_, err := c.Get(context.Background(), srv.URL)
+	if !errors.Is(err, api.ErrUpstreamDown) {
+		t.Errorf("got %v, want ErrUpstreamDown", err)
+	}
+	var status *api.StatusError
+	if !errors.As(err, &status) || status.Code != 500 {
+		t.Errorf("got %v, want a StatusError with code 500", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("server called %d times, want 3", calls.Load())
+	}
+}
+
+func TestDoesNotRetryNotFound(t *testing.T) {
+	srv, calls := statusServer(t, http.StatusNotFound)
+	c, _ := newTestClient(Options{MaxRetries: 3})
+
+	_, err := c.Get(context.Background(), srv.URL)
+	if !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+	if errors.Is(err, api.ErrUpstreamDown) {
+		t.Error("a 404 is not an outage")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server called %d times, want 1", calls.Load())
+	}
+}
+
+func TestNetworkErrorIsUpstreamDown(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	c, _ := newTestClient(Options{})
+	if _, err := c.Get(context.Background(), url); !errors.Is(err, api.ErrUpstreamDown) {
+		t.Errorf("got %v, want ErrUpstreamDown", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 20, 8, 0, 0, 0, time.UTC)
+	b := newBreaker(3, 30*time.Second, func() time.Time { return now })
+
+	for range 2 {
+		b.allow()
+		b.record(false)
+	}
+	b.allow()
+	b.record(true)
+	if b.failures != 0 {
+		t.Fatal("a success should reset the failure count")
+	}
+
+	for range 3 {
+		b.allow()
+		b.record(false)
+	}
+	if b.allow() {
+		t.Fatal("breaker should be open after 3 consecutive failures")
+	}
+
+	now = now.Add(30 * time.Second)
+	if !b.allow() {
+		t.Fatal("breaker should let a trial request through after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("only one trial request at a time")
+	}
+	b.record(false)
+	if b.allow() {
+		t.Fatal("a failed trial should reopen the breaker")
+	}
+
+	now = now.Add(30 * time.Second)
+	b.allow()
+	b.abort()
+	if !b.allow() {
+		t.Fatal("an aborted trial should let the next caller try")
+	}
+	b.record(true)
+	if !b.allow() || !b.allow() {
+		t.Error("a successful trial should close the breaker")
+	}
+}
+
+func TestOpenBreakerFailsFast(t *testing.T) {
+	srv, calls := statusServer(t, 503, 503, 503, 503)
+	c, _ := newTestClient(Options{MaxRetries: 5, BreakerThreshold: 2, BreakerCooldown: time.Minute})
+
+	_, err := c.Get(context.Background(), srv.URL)
+	if !errors.Is(err, api.ErrUpstreamDown) {
+		t.Errorf("got %v, want ErrUpstreamDown", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("server called %d times, want 2 before the breaker opened", calls.Load())
+	}
+
+	if _, err := c.Get(context.Background(), srv.URL); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("got %v, want the open circuit error", err)
+	}
+	if calls.Load() != 2 {
+		t.Error("an open breaker should not reach the server")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 20, 8, 0, 0, 0, time.UTC)
+	l := newLimiter(2, 2, func() time.Time { return now })
+
+	if l.reserve() != 0 || l.reserve() != 0 {
+		t.Fatal("the burst should be served immediately")
+	}
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Errorf("third request waits %v, want 500ms", d)
+	}
+	if d := l.reserve(); d != time.Second {
+		t.Errorf("fourth request waits %v, want 1s", d)
+	}
+
+	l.cancel()
+	l.cancel()
+	now = now.Add(time.Second)
+	if l.reserve() != 0 || l.reserve() != 0 {
+		t.Error("tokens should refill over time")
+	}
+}
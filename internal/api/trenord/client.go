@@ -2,35 +2,365 @@ package trenord
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/emiliopalmerini/treni/internal/api"
 	"github.com/emiliopalmerini/treni/internal/domain"
 )
 
 const baseURL = "https://app.trenord.it/api"
 
+// Name identifies this provider in domain Source fields and the database
+const Name = "trenord"
+
+// Trenord publishes times as HH:MM in Italian local time
+var rome = domain.Rome
+
 type Client struct {
 	httpClient *http.Client
+	baseURL    string
+	now        func() time.Time
 }
 
 func New() *Client {
 	return &Client{
-		httpClient: &http.Client{},
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    baseURL,
+		now:        time.Now,
 	}
 }
 
-func (c *Client) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
-	// TODO: implement
-	return nil, fmt.Errorf("not implemented")
+func (c *Client) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	endpoint := fmt.Sprintf("%s/station/search?q=%s", c.baseURL, url.QueryEscape(query))
+
+	body, err := c.doRequest(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("search station: %w", err)
+	}
+
+	var results []stationSearchResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, fmt.Errorf("parse station search: %w: %w", api.ErrParse, err)
+	}
+
+	stations := make([]domain.Station, len(results))
+	for i, r := range results {
+		stations[i] = domain.Station{
+			Code:      r.StationID,
+			Name:      r.Name,
+			City:      r.City,
+			Region:    r.Region,
+			Latitude:  r.Latitude,
+			Longitude: r.Longitude,
+		}
+	}
+	return stations, nil
 }
 
 func (c *Client) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
-	// TODO: implement
-	return nil, fmt.Errorf("not implemented")
+	return c.board(ctx, stationCode, c.now())
 }
 
-func (c *Client) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
-	// TODO: implement
-	return nil, fmt.Errorf("not implemented")
+// GetStationAt implements api.StationBoard. Trenord boards cover a whole
+// day, so the trains leaving or arriving before at are dropped.
+func (c *Client) GetStationAt(ctx context.Context, stationCode string, at time.Time) (*domain.Station, error) {
+	station, err := c.board(ctx, stationCode, at)
+	if err != nil {
+		return nil, err
+	}
+
+	departures := station.Departures[:0]
+	for _, d := range station.Departures {
+		if !d.ScheduledTime.Before(at) {
+			departures = append(departures, d)
+		}
+	}
+	station.Departures = departures
+
+	arrivals := station.Arrivals[:0]
+	for _, a := range station.Arrivals {
+		if !a.ScheduledTime.Before(at) {
+			arrivals = append(arrivals, a)
+		}
+	}
+	station.Arrivals = arrivals
+
+	return station, nil
+}
+
+// board fetches the station board for the day of date
+func (c *Client) board(ctx context.Context, stationCode string, date time.Time) (*domain.Station, error) {
+	date = date.In(rome)
+	endpoint := fmt.Sprintf("%s/station/%s/board?date=%s",
+		c.baseURL, url.PathEscape(stationCode), formatDate(date))
+
+	body, err := c.doRequest(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("get station: %w", err)
+	}
+
+	var result boardResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse station: %w: %w", api.ErrParse, err)
+	}
+
+	day := parseDate(result.Date, date)
+	station := &domain.Station{
+		Code:   stationCode,
+		Name:   result.Station.Name,
+		Source: Name,
+	}
+	if station.Name == "" {
+		station.Name = stationCode
+	}
+
+	// Boards list the day's trains in order, so like a journey they roll over
+	// to the next day past midnight
+	departures := newClock(day)
+	station.Departures = make([]domain.Departure, len(result.Departures))
+	for i, d := range result.Departures {
+		scheduled := departures.next(d.Time)
+		station.Departures[i] = domain.Departure{
+			TrainNumber:   d.TrainName,
+			TrainCategory: d.Category,
+			Destination:   d.Destination.Name,
+			ScheduledTime: scheduled,
+			ActualTime:    sameDayAs(parseClock(day, d.ActualTime), scheduled),
+			Delay:         d.Delay,
+			Platform:      d.Platform,
+			Status:        mapTrainStatus(d.Status),
+		}
+	}
+
+	arrivals := newClock(day)
+	station.Arrivals = make([]domain.Arrival, len(result.Arrivals))
+	for i, a := range result.Arrivals {
+		scheduled := arrivals.next(a.Time)
+		station.Arrivals[i] = domain.Arrival{
+			TrainNumber:   a.TrainName,
+			TrainCategory: a.Category,
+			Origin:        a.Origin.Name,
+			ScheduledTime: scheduled,
+			ActualTime:    sameDayAs(parseClock(day, a.ActualTime), scheduled),
+			Delay:         a.Delay,
+			Platform:      a.Platform,
+			Status:        mapTrainStatus(a.Status),
+		}
+	}
+
+	return station, nil
+}
+
+func (c *Client) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	return c.GetTrainRun(ctx, domain.TrainRef{Number: trainNumber})
+}
+
+// FindTrains implements api.TrainFinder. Trenord numbers are unique per day,
+// so the single run is the one GetTrain finds.
+func (c *Client) FindTrains(ctx context.Context, trainNumber string) ([]domain.TrainRef, error) {
+	train, err := c.GetTrain(ctx, trainNumber)
+	if err != nil {
+		return nil, err
+	}
+	return []domain.TrainRef{train.Ref()}, nil
+}
+
+// GetTrainRun implements api.TrainFinder. The origin is ignored, since it
+// takes no part in identifying a Trenord train.
+func (c *Client) GetTrainRun(ctx context.Context, ref domain.TrainRef) (*domain.Train, error) {
+	trainNumber := ref.Number
+	date := c.now().In(rome)
+	if !ref.Date.IsZero() {
+		y, m, d := ref.Date.Date()
+		date = time.Date(y, m, d, 0, 0, 0, 0, rome)
+	}
+	endpoint := fmt.Sprintf("%s/train/%s?date=%s",
+		c.baseURL, url.PathEscape(trainNumber), formatDate(date))
+
+	body, err := c.doRequest(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("get train: %w", err)
+	}
+
+	var result trainResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse train: %w: %w", api.ErrParse, err)
+	}
+	if result.TrainName == "" {
+		return nil, fmt.Errorf("train %s: %w", trainNumber, api.ErrNotFound)
+	}
+
+	day := parseDate(result.Date, date)
+	clock := newClock(day)
+
+	train := &domain.Train{
+		Number:        result.TrainName,
+		Category:      result.Category,
+		Origin:        result.DepartureStation.Name,
+		Destination:   result.ArrivalStation.Name,
+		DepartureTime: clock.next(result.DepartureTime),
+		Delay:         result.Delay,
+		Source:        Name,
+	}
+
+	train.Stops = make([]domain.Stop, len(result.Stops))
+	for i, s := range result.Stops {
+		stop := domain.Stop{
+			StationCode:       s.Station.StationID,
+			StationName:       s.Station.Name,
+			ScheduledArrival:  clock.next(s.ArrivalTime),
+			ActualArrival:     parseClock(day, s.ActualArrivalTime),
+			ScheduledDepart:   clock.next(s.DepartureTime),
+			ActualDepart:      parseClock(day, s.ActualDepartureTime),
+			ArrivalDelay:      s.ArrivalDelay,
+			DepartureDelay:    s.DepartureDelay,
+			Platform:          s.Platform,
+			PlatformConfirmed: s.ActualPlatform != "",
+			ScheduledPlatform: s.Platform,
+			Source:            Name,
+			PlatformSource:    Name,
+		}
+		if s.ActualPlatform != "" {
+			stop.Platform = s.ActualPlatform
+		}
+		// Actual times are close to the scheduled ones, so they share its day
+		stop.ActualArrival = sameDayAs(stop.ActualArrival, stop.ScheduledArrival)
+		stop.ActualDepart = sameDayAs(stop.ActualDepart, stop.ScheduledDepart)
+		train.Stops[i] = stop
+	}
+
+	train.ArrivalTime = clock.next(result.ArrivalTime)
+	train.LastUpdate = parseClock(day, result.LastUpdate)
+	train.Status = trainStatus(result.Status, train)
+
+	return train, nil
+}
+
+func (c *Client) doRequest(ctx context.Context, endpoint string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %w", api.ErrUpstreamDown, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &api.StatusError{Code: resp.StatusCode}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+// parseDate parses a YYYYMMDD service date, falling back to the requested day
+func parseDate(s string, fallback time.Time) time.Time {
+	day, err := time.ParseInLocation("20060102", s, rome)
+	if err != nil {
+		y, m, d := fallback.In(rome).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, rome)
+	}
+	return day
+}
+
+// parseClock combines an HH:MM string with the given service day
+func parseClock(day time.Time, hhmm string) time.Time {
+	if strings.TrimSpace(hhmm) == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(hhmm))
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, rome)
+}
+
+// sameDayAs moves t forward one day when it would otherwise fall long before
+// ref, which happens when the actual time crosses midnight
+func sameDayAs(t, ref time.Time) time.Time {
+	if t.IsZero() || ref.IsZero() {
+		return t
+	}
+	t = time.Date(ref.Year(), ref.Month(), ref.Day(), t.Hour(), t.Minute(), 0, 0, rome)
+	if ref.Sub(t) > 12*time.Hour {
+		return t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// clock turns the successive HH:MM times of a journey into full timestamps,
+// rolling over to the next day when a time goes backwards
+type clock struct {
+	day  time.Time
+	last time.Time
+}
+
+func newClock(day time.Time) *clock {
+	return &clock{day: day}
+}
+
+func (c *clock) next(hhmm string) time.Time {
+	t := parseClock(c.day, hhmm)
+	if t.IsZero() {
+		return t
+	}
+	if !c.last.IsZero() && t.Before(c.last) {
+		c.day = c.day.AddDate(0, 0, 1)
+		t = t.AddDate(0, 0, 1)
+	}
+	c.last = t
+	return t
+}
+
+func mapTrainStatus(status string) domain.TrainStatus {
+	switch strings.ToUpper(strings.TrimSpace(status)) {
+	case "REGOLARE", "IN ORARIO":
+		return domain.TrainStatusOnTime
+	case "RITARDO", "IN RITARDO":
+		return domain.TrainStatusDelayed
+	case "SOPPRESSO", "CANCELLATO":
+		return domain.TrainStatusCancelled
+	case "PARZIALMENTE SOPPRESSO":
+		return domain.TrainStatusPartiallyCancelled
+	case "DEVIATO", "VARIAZIONE DI PERCORSO":
+		return domain.TrainStatusRerouted
+	default:
+		return domain.TrainStatusUnknown
+	}
+}
+
+// boardStatus is the status of a board entry: the reported one, unless the
+// delay says otherwise
+func boardStatus(status string, delay int) domain.TrainStatus {
+	s := mapTrainStatus(status)
+	if (s == domain.TrainStatusOnTime || s == domain.TrainStatusUnknown) && delay > domain.OnTimeThreshold {
+		return domain.TrainStatusDelayed
+	}
+	return s
+}
+
+// trainStatus keeps a reported disruption, and otherwise works out how far
+// the train has got
+func trainStatus(status string, train *domain.Train) domain.TrainStatus {
+	s := mapTrainStatus(status)
+	if s.Disrupted() {
+		return s
+	}
+	return domain.ProgressStatus(train.Departed(), train.Arrived(), train.Delay)
 }
@@ -0,0 +1,226 @@
+package trenord
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+// newTestClient serves the fixture in testdata for each request path
+func newTestClient(t *testing.T, fixtures map[string]string) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Errorf("read fixture: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := New()
+	c.baseURL = srv.URL
+	c.now = func() time.Time { return time.Date(2025, 1, 18, 22, 0, 0, 0, rome) }
+	return c
+}
+
+func TestSearchStation(t *testing.T) {
+	c := newTestClient(t, map[string]string{"/station/search": "search.json"})
+
+	stations, err := c.SearchStation(context.Background(), "Milano")
+	if err != nil {
+		t.Fatalf("SearchStation failed: %v", err)
+	}
+
+	if len(stations) != 2 {
+		t.Fatalf("got %d stations, want 2", len(stations))
+	}
+	s := stations[0]
+	if s.Code != "S01700" || s.Name != "MILANO CENTRALE" || s.Region != "Lombardia" {
+		t.Errorf("unexpected station: %+v", s)
+	}
+	if s.Latitude == 0 || s.Longitude == 0 {
+		t.Error("expected coordinates")
+	}
+}
+
+func TestGetTrain(t *testing.T) {
+	c := newTestClient(t, map[string]string{"/train/2658": "train.json"})
+
+	train, err := c.GetTrain(context.Background(), "2658")
+	if err != nil {
+		t.Fatalf("GetTrain failed: %v", err)
+	}
+
+	if train.Number != "2658" || train.Category != "RV" {
+		t.Errorf("unexpected train: %s %s", train.Category, train.Number)
+	}
+	if train.Origin != "MILANO CENTRALE" || train.Destination != "TIRANO" {
+		t.Errorf("unexpected route: %s → %s", train.Origin, train.Destination)
+	}
+	if train.Status != domain.TrainStatusDelayed {
+		t.Errorf("status = %s, want delayed", train.Status)
+	}
+	if train.Delay != 7 {
+		t.Errorf("delay = %d, want 7", train.Delay)
+	}
+
+	wantDep := time.Date(2025, 1, 18, 22, 20, 0, 0, rome)
+	if !train.DepartureTime.Equal(wantDep) {
+		t.Errorf("departure = %v, want %v", train.DepartureTime, wantDep)
+	}
+	// Arrival crosses midnight
+	wantArr := time.Date(2025, 1, 19, 0, 45, 0, 0, rome)
+	if !train.ArrivalTime.Equal(wantArr) {
+		t.Errorf("arrival = %v, want %v", train.ArrivalTime, wantArr)
+	}
+
+	if len(train.Stops) != 3 {
+		t.Fatalf("got %d stops, want 3", len(train.Stops))
+	}
+	origin := train.Stops[0]
+	if origin.Platform != "21" || !origin.PlatformConfirmed || origin.ScheduledPlatform != "22" {
+		t.Errorf("origin platform = %q (scheduled %q) confirmed=%v, want 21 (22) confirmed",
+			origin.Platform, origin.ScheduledPlatform, origin.PlatformConfirmed)
+	}
+	if !origin.ScheduledArrival.IsZero() {
+		t.Error("origin should have no scheduled arrival")
+	}
+	lecco := train.Stops[1]
+	if lecco.ArrivalDelay != 5 || lecco.Platform != "1" || lecco.PlatformConfirmed {
+		t.Errorf("unexpected intermediate stop: %+v", lecco)
+	}
+	if got := train.Stops[2].ScheduledArrival; !got.Equal(wantArr) {
+		t.Errorf("last stop arrival = %v, want %v", got, wantArr)
+	}
+}
+
+func TestGetTrainNotFound(t *testing.T) {
+	c := newTestClient(t, nil)
+
+	if _, err := c.GetTrain(context.Background(), "99999"); err == nil {
+		t.Fatal("expected error for unknown train")
+	}
+}
+
+func TestGetTrainRunDate(t *testing.T) {
+	var gotDate string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotDate = r.URL.Query().Get("date")
+		body, _ := os.ReadFile(filepath.Join("testdata", "train.json"))
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	c := New()
+	c.baseURL = srv.URL
+	c.now = func() time.Time { return time.Date(2025, 1, 18, 22, 0, 0, 0, rome) }
+
+	ref := domain.TrainRef{Number: "2658", Date: time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)}
+	if _, err := c.GetTrainRun(context.Background(), ref); err != nil {
+		t.Fatalf("GetTrainRun failed: %v", err)
+	}
+	if gotDate != "20250117" {
+		t.Errorf("requested date %q, want 20250117", gotDate)
+	}
+
+	if _, err := c.GetTrain(context.Background(), "2658"); err != nil {
+		t.Fatalf("GetTrain failed: %v", err)
+	}
+	if gotDate != "20250118" {
+		t.Errorf("requested date %q, want today (20250118)", gotDate)
+	}
+}
+
+func TestGetStation(t *testing.T) {
+	c := newTestClient(t, map[string]string{"/station/S01700/board": "board.json"})
+
+	station, err := c.GetStation(context.Background(), "S01700")
+	if err != nil {
+		t.Fatalf("GetStation failed: %v", err)
+	}
+
+	if station.Code != "S01700" || station.Name != "MILANO CENTRALE" {
+		t.Errorf("unexpected station: %s %s", station.Code, station.Name)
+	}
+	if len(station.Departures) != 2 || len(station.Arrivals) != 2 {
+		t.Fatalf("got %d departures and %d arrivals, want 2 and 2",
+			len(station.Departures), len(station.Arrivals))
+	}
+
+	d := station.Departures[0]
+	if d.TrainNumber != "2658" || d.Destination != "TIRANO" || d.Delay != 2 || d.Platform != "21" {
+		t.Errorf("unexpected departure: %+v", d)
+	}
+	if want := time.Date(2025, 1, 18, 22, 20, 0, 0, rome); !d.ScheduledTime.Equal(want) {
+		t.Errorf("departure time = %v, want %v", d.ScheduledTime, want)
+	}
+
+	// Past midnight the board runs into the next day
+	late := station.Departures[1]
+	if want := time.Date(2025, 1, 19, 0, 15, 0, 0, rome); !late.ScheduledTime.Equal(want) {
+		t.Errorf("departure time = %v, want %v", late.ScheduledTime, want)
+	}
+	if want := time.Date(2025, 1, 19, 0, 17, 0, 0, rome); !late.ActualTime.Equal(want) {
+		t.Errorf("actual time = %v, want %v", late.ActualTime, want)
+	}
+
+	if got := station.Arrivals[1].Status; got != domain.TrainStatusCancelled {
+		t.Errorf("arrival status = %s, want cancelled", got)
+	}
+}
+
+func TestGetStationAt(t *testing.T) {
+	c := newTestClient(t, map[string]string{"/station/S01700/board": "board.json"})
+
+	// In UTC, to check the cut-off is not read in the server's timezone
+	at := time.Date(2025, 1, 18, 21, 0, 0, 0, time.UTC)
+	station, err := c.GetStationAt(context.Background(), "S01700", at)
+	if err != nil {
+		t.Fatalf("GetStationAt failed: %v", err)
+	}
+	// The 00:15 departure is after the cut-off, on the next day
+	if len(station.Departures) != 2 || len(station.Arrivals) != 1 {
+		t.Fatalf("got %d departures and %d arrivals, want 2 and 1",
+			len(station.Departures), len(station.Arrivals))
+	}
+	if station.Arrivals[0].TrainNumber != "2647" {
+		t.Errorf("arrival = %s, want 2647 (22:05), the 21:55 has already arrived", station.Arrivals[0].TrainNumber)
+	}
+}
+
+func TestMapTrainStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   domain.TrainStatus
+	}{
+		{"REGOLARE", domain.TrainStatusOnTime},
+		{"in ritardo", domain.TrainStatusDelayed},
+		{"SOPPRESSO", domain.TrainStatusCancelled},
+		{"PARZIALMENTE SOPPRESSO", domain.TrainStatusPartiallyCancelled},
+		{"DEVIATO", domain.TrainStatusRerouted},
+		{"", domain.TrainStatusUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := mapTrainStatus(tt.status); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
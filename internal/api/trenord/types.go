@@ -0,0 +1,60 @@
+package trenord
+
+type stationRef struct {
+	StationID string `json:"station_id"`
+	Name      string `json:"station_ori_name"`
+}
+
+type stationSearchResult struct {
+	StationID string  `json:"station_id"`
+	Name      string  `json:"name"`
+	City      string  `json:"city"`
+	Region    string  `json:"region"`
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+type trainResult struct {
+	TrainName        string       `json:"train_name"`
+	Category         string       `json:"train_category"`
+	Date             string       `json:"date"` // YYYYMMDD
+	DepartureStation stationRef   `json:"departure_station"`
+	ArrivalStation   stationRef   `json:"arrival_station"`
+	DepartureTime    string       `json:"dep_time"` // HH:MM
+	ArrivalTime      string       `json:"arr_time"` // HH:MM
+	Delay            int          `json:"delay"`
+	Status           string       `json:"status"`
+	LastUpdate       string       `json:"last_update"` // HH:MM
+	Stops            []stopResult `json:"pass_list"`
+}
+
+type stopResult struct {
+	Station             stationRef `json:"station"`
+	ArrivalTime         string     `json:"arr_time"`
+	DepartureTime       string     `json:"dep_time"`
+	ActualArrivalTime   string     `json:"actual_arr_time"`
+	ActualDepartureTime string     `json:"actual_dep_time"`
+	ArrivalDelay        int        `json:"arr_delay"`
+	DepartureDelay      int        `json:"dep_delay"`
+	Platform            string     `json:"platform"`
+	ActualPlatform      string     `json:"actual_platform"`
+}
+
+type boardResult struct {
+	Station    stationRef   `json:"station"`
+	Date       string       `json:"date"` // YYYYMMDD
+	Departures []boardEntry `json:"departures"`
+	Arrivals   []boardEntry `json:"arrivals"`
+}
+
+type boardEntry struct {
+	TrainName   string     `json:"train_name"`
+	Category    string     `json:"train_category"`
+	Origin      stationRef `json:"origin"`
+	Destination stationRef `json:"destination"`
+	Time        string     `json:"time"`        // HH:MM
+	ActualTime  string     `json:"actual_time"` // HH:MM
+	Delay       int        `json:"delay"`
+	Platform    string     `json:"platform"`
+	Status      string     `json:"status"`
+}
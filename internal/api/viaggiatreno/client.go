@@ -4,27 +4,40 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/api/transport"
 	"github.com/emiliopalmerini/treni/internal/domain"
 )
 
 const baseURL = "http://www.viaggiatreno.it/infomobilita/resteasy/viaggiatreno"
 
+// Name identifies this provider in domain Source fields and the database
+const Name = "viaggiatreno"
+
+// Departure days are calendar days in Italy
+var rome = domain.Rome
+
 type Client struct {
-	httpClient *http.Client
-	baseURL    string
+	http    *transport.Client
+	baseURL string
 }
 
+// New returns a client using transport.DefaultOptions
 func New() *Client {
+	return NewWithOptions(transport.DefaultOptions)
+}
+
+// NewWithOptions returns a client with custom retry, rate limiting and
+// circuit breaker settings
+func NewWithOptions(opts transport.Options) *Client {
 	return &Client{
-		httpClient: &http.Client{Timeout: 30 * time.Second},
-		baseURL:    baseURL,
+		http:    transport.New(opts),
+		baseURL: baseURL,
 	}
 }
 
@@ -38,7 +51,7 @@ func (c *Client) SearchStation(ctx context.Context, query string) ([]domain.Stat
 
 	var results []stationSearchResult
 	if err := json.Unmarshal(body, &results); err != nil {
-		return nil, fmt.Errorf("parse station search: %w", err)
+		return nil, fmt.Errorf("parse station search: %w: %w", api.ErrParse, err)
 	}
 
 	stations := make([]domain.Station, len(results))
@@ -51,7 +64,8 @@ func (c *Client) SearchStation(ctx context.Context, query string) ([]domain.Stat
 	return stations, nil
 }
 
-// Major station names (API doesn't provide a code->name lookup)
+// Major station names, so GetStation has a name without the two extra
+// requests GetStationDetails needs
 var stationNames = map[string]string{
 	"S01700": "Milano Centrale",
 	"S01645": "Milano Porta Garibaldi",
@@ -95,13 +109,76 @@ func (c *Client) GetStationRegion(ctx context.Context, stationCode string) (int,
 
 	region, err := strconv.Atoi(strings.TrimSpace(string(body)))
 	if err != nil {
-		return 0, fmt.Errorf("parse region: %w", err)
+		return 0, fmt.Errorf("parse region: %w: %w", api.ErrParse, err)
 	}
 	return region, nil
 }
 
-func (c *Client) GetDepartures(ctx context.Context, stationCode string) ([]domain.Departure, error) {
-	timestamp := formatTimestamp(time.Now())
+// Region names for the codes returned by the regione endpoint
+var regionNames = map[int]string{
+	1:  "Lombardia",
+	2:  "Liguria",
+	3:  "Piemonte",
+	4:  "Valle d'Aosta",
+	5:  "Lazio",
+	6:  "Umbria",
+	7:  "Molise",
+	8:  "Emilia Romagna",
+	9:  "Trentino-Alto Adige",
+	10: "Friuli-Venezia Giulia",
+	11: "Marche",
+	12: "Veneto",
+	13: "Toscana",
+	14: "Sicilia",
+	15: "Basilicata",
+	16: "Puglia",
+	17: "Calabria",
+	18: "Campania",
+	19: "Abruzzo",
+	20: "Sardegna",
+	21: "Trentino-Alto Adige",
+	22: "Trentino-Alto Adige",
+}
+
+// GetStationDetails looks up the station's region and then its name, city and
+// coordinates. It costs two requests, so callers should cache the result.
+func (c *Client) GetStationDetails(ctx context.Context, stationCode string) (*domain.Station, error) {
+	region, err := c.GetStationRegion(ctx, stationCode)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/dettaglioStazione/%s/%d", c.baseURL, url.PathEscape(stationCode), region)
+
+	body, err := c.doRequest(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("get station details: %w", err)
+	}
+
+	var result stationDetailResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse station details: %w: %w", api.ErrParse, err)
+	}
+
+	name := result.Localita.NomeLungo
+	if name == "" {
+		name = stationCode
+	}
+
+	return &domain.Station{
+		Code:      stationCode,
+		Name:      name,
+		City:      result.NomeCitta,
+		Region:    regionNames[region],
+		Latitude:  result.Lat,
+		Longitude: result.Lon,
+		Source:    Name,
+	}, nil
+}
+
+// GetDepartures returns the departures around at
+func (c *Client) GetDepartures(ctx context.Context, stationCode string, at time.Time) ([]domain.Departure, error) {
+	timestamp := formatTimestamp(at)
 	endpoint := fmt.Sprintf("%s/partenze/%s/%s", c.baseURL, url.PathEscape(stationCode), url.PathEscape(timestamp))
 
 	body, err := c.doRequest(ctx, endpoint)
@@ -111,7 +188,7 @@ func (c *Client) GetDepartures(ctx context.Context, stationCode string) ([]domai
 
 	var results []departureResult
 	if err := json.Unmarshal(body, &results); err != nil {
-		return nil, fmt.Errorf("parse departures: %w", err)
+		return nil, fmt.Errorf("parse departures: %w: %w", api.ErrParse, err)
 	}
 
 	departures := make([]domain.Departure, len(results))
@@ -119,18 +196,26 @@ func (c *Client) GetDepartures(ctx context.Context, stationCode string) ([]domai
 		departures[i] = domain.Departure{
 			TrainNumber:   strconv.Itoa(r.NumeroTreno),
 			TrainCategory: r.CategoriaDescrizione,
+			OriginCode:    r.CodOrigine,
 			Destination:   r.Destinazione,
 			ScheduledTime: parseMillisTimestamp(r.OrarioPartenza),
 			Delay:         r.Ritardo,
 			Platform:      r.BinarioProgrammatoPartenzaDescrizione,
-			Status:        mapTrainStatus(r.Provvedimento),
+			Status:        boardStatus(r.Provvedimento, r.Ritardo),
+
+			ScheduledPlatform: r.BinarioProgrammatoPartenzaDescrizione,
+			OriginDeparture:   parseMillisTimestamp(r.DataPartenzaTreno),
+		}
+		if r.BinarioEffettivoPartenzaDescrizione != "" {
+			departures[i].Platform = r.BinarioEffettivoPartenzaDescrizione
 		}
 	}
 	return departures, nil
 }
 
-func (c *Client) GetArrivals(ctx context.Context, stationCode string) ([]domain.Arrival, error) {
-	timestamp := formatTimestamp(time.Now())
+// GetArrivals returns the arrivals around at
+func (c *Client) GetArrivals(ctx context.Context, stationCode string, at time.Time) ([]domain.Arrival, error) {
+	timestamp := formatTimestamp(at)
 	endpoint := fmt.Sprintf("%s/arrivi/%s/%s", c.baseURL, url.PathEscape(stationCode), url.PathEscape(timestamp))
 
 	body, err := c.doRequest(ctx, endpoint)
@@ -140,7 +225,7 @@ func (c *Client) GetArrivals(ctx context.Context, stationCode string) ([]domain.
 
 	var results []arrivalResult
 	if err := json.Unmarshal(body, &results); err != nil {
-		return nil, fmt.Errorf("parse arrivals: %w", err)
+		return nil, fmt.Errorf("parse arrivals: %w: %w", api.ErrParse, err)
 	}
 
 	arrivals := make([]domain.Arrival, len(results))
@@ -149,16 +234,28 @@ func (c *Client) GetArrivals(ctx context.Context, stationCode string) ([]domain.
 			TrainNumber:   strconv.Itoa(r.NumeroTreno),
 			TrainCategory: r.CategoriaDescrizione,
 			Origin:        r.Origine,
+			OriginCode:    r.CodOrigine,
 			ScheduledTime: parseMillisTimestamp(r.OrarioArrivo),
 			Delay:         r.Ritardo,
 			Platform:      r.BinarioProgrammatoArrivoDescrizione,
-			Status:        mapTrainStatus(r.Provvedimento),
+			Status:        boardStatus(r.Provvedimento, r.Ritardo),
+
+			ScheduledPlatform: r.BinarioProgrammatoArrivoDescrizione,
+			OriginDeparture:   parseMillisTimestamp(r.DataPartenzaTreno),
+		}
+		if r.BinarioEffettivoArrivoDescrizione != "" {
+			arrivals[i].Platform = r.BinarioEffettivoArrivoDescrizione
 		}
 	}
 	return arrivals, nil
 }
 
 func (c *Client) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	return c.GetStationAt(ctx, stationCode, time.Now())
+}
+
+// GetStationAt implements api.StationBoard
+func (c *Client) GetStationAt(ctx context.Context, stationCode string, at time.Time) (*domain.Station, error) {
 	// Get station info first
 	info, err := c.GetStationInfo(ctx, stationCode)
 	if err != nil {
@@ -166,66 +263,103 @@ func (c *Client) GetStation(ctx context.Context, stationCode string) (*domain.St
 		info = &domain.Station{Code: stationCode}
 	}
 
-	arrivals, err := c.GetArrivals(ctx, stationCode)
+	arrivals, err := c.GetArrivals(ctx, stationCode, at)
 	if err != nil {
 		return nil, err
 	}
 
-	departures, err := c.GetDepartures(ctx, stationCode)
+	departures, err := c.GetDepartures(ctx, stationCode, at)
 	if err != nil {
 		return nil, err
 	}
 
 	info.Arrivals = arrivals
 	info.Departures = departures
+	info.Source = Name
 
 	return info, nil
 }
 
-func (c *Client) FindTrainOrigin(ctx context.Context, trainNumber string) (string, int64, error) {
+// FindTrains lists the runs carrying trainNumber today, one per origin
+func (c *Client) FindTrains(ctx context.Context, trainNumber string) ([]domain.TrainRef, error) {
 	endpoint := fmt.Sprintf("%s/cercaNumeroTrenoTrenoAutocomplete/%s", c.baseURL, url.PathEscape(trainNumber))
 
 	body, err := c.doRequest(ctx, endpoint)
 	if err != nil {
-		return "", 0, fmt.Errorf("find train origin: %w", err)
+		return nil, fmt.Errorf("find train: %w", err)
 	}
 
-	// Response format: "trainNumber - StationName|trainNumber-stationCode-timestamp\n"
-	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
-	if len(lines) == 0 || lines[0] == "" {
-		return "", 0, fmt.Errorf("train not found: %s", trainNumber)
+	// One line per run: "trainNumber - StationName|trainNumber-stationCode-timestamp"
+	var refs []domain.TrainRef
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		ref, err := parseTrainCandidate(line)
+		if err != nil {
+			return nil, fmt.Errorf("find train: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("train %s: %w", trainNumber, api.ErrNotFound)
 	}
+	return refs, nil
+}
 
-	// Parse first result: "trainNumber - StationName|trainNumber-stationCode-timestamp"
-	parts := strings.Split(lines[0], "|")
-	if len(parts) < 2 {
-		return "", 0, fmt.Errorf("invalid train response format")
+// parseTrainCandidate parses one autocomplete line
+func parseTrainCandidate(line string) (domain.TrainRef, error) {
+	label, data, ok := strings.Cut(line, "|")
+	if !ok {
+		return domain.TrainRef{}, fmt.Errorf("%w: %q", api.ErrParse, line)
 	}
 
-	// Parse "trainNumber-stationCode-timestamp"
-	dataParts := strings.Split(parts[1], "-")
+	// data is "trainNumber-stationCode-timestamp"
+	dataParts := strings.Split(data, "-")
 	if len(dataParts) < 3 {
-		return "", 0, fmt.Errorf("invalid train data format")
+		return domain.TrainRef{}, fmt.Errorf("%w: %q", api.ErrParse, data)
+	}
+	timestamp, err := strconv.ParseInt(dataParts[2], 10, 64)
+	if err != nil {
+		return domain.TrainRef{}, fmt.Errorf("%w: %q", api.ErrParse, data)
 	}
 
-	stationCode := dataParts[1]
-	timestamp, _ := strconv.ParseInt(dataParts[2], 10, 64)
-
-	return stationCode, timestamp, nil
+	_, origin, _ := strings.Cut(label, " - ")
+	return domain.TrainRef{
+		Number:     dataParts[0],
+		OriginCode: dataParts[1],
+		Origin:     strings.TrimSpace(origin),
+		Date:       time.UnixMilli(timestamp).In(rome),
+	}, nil
 }
 
+// GetTrain fetches today's run of trainNumber. It returns an
+// *api.AmbiguousTrainError when several trains share the number.
 func (c *Client) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
-	// First find the origin station and departure timestamp
-	originCode, departureTimestamp, err := c.FindTrainOrigin(ctx, trainNumber)
-	if err != nil {
-		return nil, err
+	return c.GetTrainRun(ctx, domain.TrainRef{Number: trainNumber})
+}
+
+// GetTrainRun fetches the run identified by ref, looking up whatever part of
+// it is missing
+func (c *Client) GetTrainRun(ctx context.Context, ref domain.TrainRef) (*domain.Train, error) {
+	if ref.OriginCode == "" || ref.Date.IsZero() {
+		run, err := c.findRun(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		ref.OriginCode = run.OriginCode
+		if ref.Date.IsZero() {
+			ref.Date = run.Date
+		}
 	}
 
+	y, m, d := ref.Date.Date()
 	endpoint := fmt.Sprintf("%s/andamentoTreno/%s/%s/%d",
 		c.baseURL,
-		url.PathEscape(originCode),
-		url.PathEscape(trainNumber),
-		departureTimestamp,
+		url.PathEscape(ref.OriginCode),
+		url.PathEscape(ref.Number),
+		time.Date(y, m, d, 0, 0, 0, 0, rome).UnixMilli(),
 	)
 
 	body, err := c.doRequest(ctx, endpoint)
@@ -233,25 +367,45 @@ func (c *Client) GetTrain(ctx context.Context, trainNumber string) (*domain.Trai
 		return nil, fmt.Errorf("get train: %w", err)
 	}
 
+	// A run that does not exist comes back as an empty body
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil, fmt.Errorf("train %s: %w", ref, api.ErrNotFound)
+	}
+
 	var result trainResult
 	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("parse train: %w", err)
+		return nil, fmt.Errorf("parse train: %w: %w", api.ErrParse, err)
 	}
 
 	train := &domain.Train{
 		Number:        strconv.Itoa(result.NumeroTreno),
 		Category:      result.Categoria,
 		Origin:        result.Origine,
+		OriginCode:    result.IDOrigine,
 		Destination:   result.Destinazione,
 		DepartureTime: parseMillisTimestamp(result.OrarioPartenza),
 		ArrivalTime:   parseMillisTimestamp(result.OrarioArrivo),
 		Delay:         result.Ritardo,
-		Status:        mapTrainStatus(result.Provvedimento),
 		LastUpdate:    parseMillisTimestamp(result.OraUltimoRilevamento),
+		Source:        Name,
+	}
+	// Before departure the last detection is reported as "--"
+	if s := strings.TrimSpace(result.StazioneUltimoRilevamento); s != "--" {
+		train.LastStation = s
+	}
+
+	if train.OriginCode == "" {
+		train.OriginCode = ref.OriginCode
 	}
 
 	train.Stops = make([]domain.Stop, len(result.Fermate))
 	for i, f := range result.Fermate {
+		// Stops the train only arrives at, such as the terminus, give their
+		// platforms in the arrival fields alone
+		scheduled, actual := f.BinarioProgrammatoPartenzaDescrizione, f.BinarioEffettivoPartenzaDescrizione
+		if scheduled == "" && actual == "" {
+			scheduled, actual = f.BinarioProgrammatoArrivoDescrizione, f.BinarioEffettivoArrivoDescrizione
+		}
 		train.Stops[i] = domain.Stop{
 			StationCode:       f.ID,
 			StationName:       f.Stazione,
@@ -261,57 +415,121 @@ func (c *Client) GetTrain(ctx context.Context, trainNumber string) (*domain.Trai
 			ActualDepart:      parseMillisTimestamp(f.PartenzaReale),
 			ArrivalDelay:      f.RitardoArrivo,
 			DepartureDelay:    f.RitardoPartenza,
-			Platform:          f.BinarioProgrammatoPartenzaDescrizione,
-			PlatformConfirmed: f.BinarioEffettivoPartenzaDescrizione != "",
+			Platform:          scheduled,
+			PlatformConfirmed: actual != "",
+			ScheduledPlatform: scheduled,
+			Source:            Name,
+			PlatformSource:    Name,
 		}
-		if f.BinarioEffettivoPartenzaDescrizione != "" {
-			train.Stops[i].Platform = f.BinarioEffettivoPartenzaDescrizione
+		if actual != "" {
+			train.Stops[i].Platform = actual
 		}
+		train.Stops[i].Cancelled = f.ActualFermataType == stopCancelled
 	}
+	train.Status = trainStatus(result, train)
 
 	return train, nil
 }
 
-func (c *Client) doRequest(ctx context.Context, endpoint string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+// findRun picks the single autocomplete candidate matching ref's origin
+func (c *Client) findRun(ctx context.Context, ref domain.TrainRef) (domain.TrainRef, error) {
+	candidates, err := c.FindTrains(ctx, ref.Number)
 	if err != nil {
-		return nil, err
+		return domain.TrainRef{}, err
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+	var matches []domain.TrainRef
+	for _, cand := range candidates {
+		if ref.OriginCode == "" || strings.EqualFold(cand.OriginCode, ref.OriginCode) {
+			matches = append(matches, cand)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	switch len(matches) {
+	case 0:
+		return domain.TrainRef{}, fmt.Errorf("train %s from %s: %w", ref.Number, ref.OriginCode, api.ErrNotFound)
+	case 1:
+		return matches[0], nil
+	default:
+		return domain.TrainRef{}, &api.AmbiguousTrainError{Number: ref.Number, Candidates: matches}
 	}
+}
 
-	return io.ReadAll(resp.Body)
+func (c *Client) doRequest(ctx context.Context, endpoint string) ([]byte, error) {
+	return c.http.Get(ctx, endpoint)
 }
 
+// formatTimestamp formats t in Rome, the way the boards expect it:
+// "Mon Jan 02 2006 15:04:05 GMT+0100"
 func formatTimestamp(t time.Time) string {
-	// Format: "Mon Jan 02 2006 15:04:05 GMT+0100"
-	return t.Format("Mon Jan 02 2006 15:04:05 GMT-0700")
+	return t.In(rome).Format("Mon Jan 02 2006 15:04:05 GMT-0700")
 }
 
+// parseMillisTimestamp reads a Unix time in milliseconds as Italian time
 func parseMillisTimestamp(ms int64) time.Time {
 	if ms == 0 {
 		return time.Time{}
 	}
-	return time.UnixMilli(ms)
+	return time.UnixMilli(ms).In(rome)
 }
 
-func mapTrainStatus(provvedimento int) domain.TrainStatus {
+// provvedimento codes
+const (
+	provvedimentoCancelled          = 1
+	provvedimentoPartiallyCancelled = 2
+	provvedimentoRerouted           = 3
+)
+
+// actualFermataType of a stop the train no longer calls at
+const stopCancelled = 3
+
+// disruption maps a provvedimento code to the disruption it announces, or
+// to "" for a train running as planned
+func disruption(provvedimento int) domain.TrainStatus {
 	switch provvedimento {
-	case 0:
-		return domain.TrainStatusOnTime
-	case 1:
-		return domain.TrainStatusCancelled
-	case 2:
+	case provvedimentoCancelled:
 		return domain.TrainStatusCancelled
+	case provvedimentoPartiallyCancelled:
+		return domain.TrainStatusPartiallyCancelled
+	case provvedimentoRerouted:
+		return domain.TrainStatusRerouted
 	default:
-		return domain.TrainStatusUnknown
+		return ""
+	}
+}
+
+// boardStatus is the status of a departure or arrival board entry
+func boardStatus(provvedimento, delay int) domain.TrainStatus {
+	if s := disruption(provvedimento); s != "" {
+		return s
 	}
+	if delay > domain.OnTimeThreshold {
+		return domain.TrainStatusDelayed
+	}
+	return domain.TrainStatusOnTime
+}
+
+// trainStatus works out a train's status from its disruption codes, then its
+// cancelled stops, then how far it has got
+func trainStatus(r trainResult, train *domain.Train) domain.TrainStatus {
+	switch r.TipoTreno {
+	case "ST":
+		return domain.TrainStatusCancelled
+	case "PP", "SI", "SF":
+		return domain.TrainStatusPartiallyCancelled
+	case "DV":
+		return domain.TrainStatusRerouted
+	}
+	if s := disruption(r.Provvedimento); s != "" {
+		return s
+	}
+	for _, stop := range train.Stops {
+		if stop.Cancelled {
+			return domain.TrainStatusPartiallyCancelled
+		}
+	}
+
+	departed := r.OraUltimoRilevamento != 0 || train.Departed()
+	arrived := r.Arrivato || train.Arrived()
+	return domain.ProgressStatus(departed, arrived, train.Delay)
 }
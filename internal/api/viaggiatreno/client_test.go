@@ -2,10 +2,155 @@ package viaggiatreno
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/api/transport"
+	"github.com/emiliopalmerini/treni/internal/domain"
 )
 
+// Midnight of 2025-01-20 in Rome, as the autocomplete endpoint returns it
+const jan20 = "1737327600000"
+
+// newFakeServer answers the autocomplete endpoint with two trains numbered
+// 2345 and records the andamentoTreno paths it is asked for
+func newFakeServer(t *testing.T) (*Client, *[]string) {
+	t.Helper()
+	var runs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/cercaNumeroTrenoTrenoAutocomplete/2345"):
+			w.Write([]byte("2345 - MILANO CENTRALE|2345-S01700-" + jan20 + "\n" +
+				"2345 - TORINO PORTA NUOVA|2345-S00219-" + jan20 + "\n"))
+		case strings.HasPrefix(r.URL.Path, "/cercaNumeroTrenoTrenoAutocomplete/"):
+			w.Write(nil)
+		case strings.HasPrefix(r.URL.Path, "/andamentoTreno/"):
+			runs = append(runs, r.URL.Path)
+			w.Write([]byte(`{"numeroTreno": 2345, "origine": "TORINO PORTA NUOVA", "idOrigine": "S00219", "stazioneUltimoRilevamento": "--"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewWithOptions(transport.Options{})
+	c.baseURL = srv.URL
+	return c, &runs
+}
+
+func TestFindTrains(t *testing.T) {
+	c, _ := newFakeServer(t)
+
+	refs, err := c.FindTrains(context.Background(), "2345")
+	if err != nil {
+		t.Fatalf("FindTrains failed: %v", err)
+	}
+	if len(refs) != 2 {
+		t.Fatalf("got %d candidates, want 2", len(refs))
+	}
+	if refs[1].OriginCode != "S00219" || refs[1].Origin != "TORINO PORTA NUOVA" {
+		t.Errorf("unexpected candidate: %+v", refs[1])
+	}
+	if got := refs[1].Date.Format(time.DateOnly); got != "2025-01-20" {
+		t.Errorf("date = %s, want 2025-01-20", got)
+	}
+
+	if _, err := c.FindTrains(context.Background(), "1"); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetTrainAmbiguous(t *testing.T) {
+	c, runs := newFakeServer(t)
+
+	_, err := c.GetTrain(context.Background(), "2345")
+	var ambiguous *api.AmbiguousTrainError
+	if !errors.As(err, &ambiguous) || len(ambiguous.Candidates) != 2 {
+		t.Fatalf("got %v, want an AmbiguousTrainError with 2 candidates", err)
+	}
+	if len(*runs) != 0 {
+		t.Error("no run should be fetched for an ambiguous number")
+	}
+
+	train, err := c.GetTrainRun(context.Background(), domain.TrainRef{Number: "2345", OriginCode: "s00219"})
+	if err != nil {
+		t.Fatalf("GetTrainRun failed: %v", err)
+	}
+	if train.OriginCode != "S00219" {
+		t.Errorf("origin code = %q, want S00219", train.OriginCode)
+	}
+	if train.LastStation != "" {
+		t.Errorf("last station = %q, want none before departure", train.LastStation)
+	}
+	if want := "/andamentoTreno/S00219/2345/" + jan20; (*runs)[0] != want {
+		t.Errorf("fetched %s, want %s", (*runs)[0], want)
+	}
+
+	if _, err := c.GetTrainRun(context.Background(), domain.TrainRef{Number: "2345", OriginCode: "S09999"}); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound for an unknown origin", err)
+	}
+}
+
+func TestGetTrainRunDate(t *testing.T) {
+	c, runs := newFakeServer(t)
+
+	// The day before the autocomplete run, midnight in Rome
+	yesterday := time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)
+	ref := domain.TrainRef{Number: "2345", OriginCode: "S00219", Date: yesterday}
+	if _, err := c.GetTrainRun(context.Background(), ref); err != nil {
+		t.Fatalf("GetTrainRun failed: %v", err)
+	}
+	if want := "/andamentoTreno/S00219/2345/1737241200000"; (*runs)[0] != want {
+		t.Errorf("fetched %s, want %s", (*runs)[0], want)
+	}
+}
+
+func TestGetTrainRunPlatforms(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/cercaNumeroTrenoTrenoAutocomplete/2647"):
+			w.Write([]byte("2647 - MILANO CENTRALE|2647-S01700-" + jan20 + "\n"))
+		case strings.HasPrefix(r.URL.Path, "/andamentoTreno/S01700/2647/"):
+			body, err := os.ReadFile(filepath.Join("testdata", "train.json"))
+			if err != nil {
+				t.Errorf("read fixture: %v", err)
+			}
+			w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c := NewWithOptions(transport.Options{})
+	c.baseURL = srv.URL
+
+	train, err := c.GetTrainRun(context.Background(), domain.TrainRef{Number: "2647", OriginCode: "S01700"})
+	if err != nil {
+		t.Fatalf("GetTrainRun failed: %v", err)
+	}
+	if len(train.Stops) != 3 {
+		t.Fatalf("got %d stops, want 3", len(train.Stops))
+	}
+
+	if s := train.Stops[0]; s.Platform != "21" || !s.PlatformConfirmed || s.PlatformChanged() {
+		t.Errorf("origin = %+v, want platform 21 as timetabled", s)
+	}
+	if s := train.Stops[1]; s.Platform != "3" || s.PlatformConfirmed {
+		t.Errorf("Monza = %+v, want timetabled platform 3, unconfirmed", s)
+	}
+	// The terminus gives arrival platforms only: moved from 2 to 4
+	if s := train.Stops[2]; s.Platform != "4" || s.ScheduledPlatform != "2" || !s.PlatformConfirmed || !s.PlatformChanged() {
+		t.Errorf("terminus = %+v, want a change from platform 2 to 4", s)
+	}
+}
+
 func TestIntegrationSearchStation(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -64,7 +209,7 @@ func TestIntegrationGetDepartures(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	departures, err := client.GetDepartures(ctx, "S08409")
+	departures, err := client.GetDepartures(ctx, "S08409", time.Now())
 	if err != nil {
 		t.Fatalf("GetDepartures failed: %v", err)
 	}
@@ -91,7 +236,7 @@ func TestIntegrationGetArrivals(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	arrivals, err := client.GetArrivals(ctx, "S08409")
+	arrivals, err := client.GetArrivals(ctx, "S08409", time.Now())
 	if err != nil {
 		t.Fatalf("GetArrivals failed: %v", err)
 	}
@@ -110,14 +255,19 @@ func TestIntegrationGetArrivals(t *testing.T) {
 }
 
 func TestFormatTimestamp(t *testing.T) {
-	loc, _ := time.LoadLocation("Europe/Rome")
-	tm := time.Date(2025, 1, 18, 14, 30, 0, 0, loc)
-
-	result := formatTimestamp(tm)
+	tests := []struct {
+		in   time.Time
+		want string
+	}{
+		{time.Date(2025, 1, 18, 14, 30, 0, 0, rome), "Sat Jan 18 2025 14:30:00 GMT+0100"},
+		// Whatever zone the caller uses, the board is asked for in Rome
+		{time.Date(2025, 7, 1, 16, 30, 0, 0, time.UTC), "Tue Jul 01 2025 18:30:00 GMT+0200"},
+	}
 
-	// Should produce something like "Sat Jan 18 2025 14:30:00 GMT+0100"
-	if result == "" {
-		t.Error("expected non-empty timestamp")
+	for _, tt := range tests {
+		if got := formatTimestamp(tt.in); got != tt.want {
+			t.Errorf("formatTimestamp(%v) = %q, want %q", tt.in, got, tt.want)
+		}
 	}
 }
 
@@ -128,7 +278,7 @@ func TestParseMillisTimestamp(t *testing.T) {
 		wantZero bool
 	}{
 		{"zero", 0, true},
-		{"valid", 1705582200000, false}, // 2024-01-18 14:30:00 UTC
+		{"valid", 1705582200000, false}, // 2024-01-18 13:50 in Rome
 	}
 
 	for _, tt := range tests {
@@ -140,26 +290,74 @@ func TestParseMillisTimestamp(t *testing.T) {
 			if !tt.wantZero && result.IsZero() {
 				t.Error("expected non-zero time")
 			}
+			// Shown in Italian time whatever the host's timezone
+			if !tt.wantZero && result.Location() != rome {
+				t.Errorf("location = %v, want Europe/Rome", result.Location())
+			}
 		})
 	}
 }
 
-func TestMapTrainStatus(t *testing.T) {
+func TestBoardStatus(t *testing.T) {
 	tests := []struct {
 		provvedimento int
-		want          string
+		delay         int
+		want          domain.TrainStatus
 	}{
-		{0, "on_time"},
-		{1, "cancelled"},
-		{2, "cancelled"},
-		{99, "unknown"},
+		{0, 0, domain.TrainStatusOnTime},
+		{0, 5, domain.TrainStatusOnTime},
+		{0, 40, domain.TrainStatusDelayed},
+		{1, 0, domain.TrainStatusCancelled},
+		{2, 10, domain.TrainStatusPartiallyCancelled},
+		{3, 0, domain.TrainStatusRerouted},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.want, func(t *testing.T) {
-			result := mapTrainStatus(tt.provvedimento)
-			if string(result) != tt.want {
-				t.Errorf("got %s, want %s", result, tt.want)
+		t.Run(string(tt.want), func(t *testing.T) {
+			if got := boardStatus(tt.provvedimento, tt.delay); got != tt.want {
+				t.Errorf("boardStatus(%d, %d) = %s, want %s", tt.provvedimento, tt.delay, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrainStatus(t *testing.T) {
+	dep := time.Date(2025, 1, 20, 7, 0, 0, 0, rome)
+	stops := func(departed, arrived, cancelled bool) []domain.Stop {
+		s := []domain.Stop{{ScheduledDepart: dep}, {}, {ScheduledArrival: dep.Add(3 * time.Hour)}}
+		if departed {
+			s[0].ActualDepart = dep
+		}
+		if arrived {
+			s[2].ActualArrival = dep.Add(3 * time.Hour)
+		}
+		s[1].Cancelled = cancelled
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		result trainResult
+		delay  int
+		stops  []domain.Stop
+		want   domain.TrainStatus
+	}{
+		{"not departed", trainResult{TipoTreno: "PG"}, 0, stops(false, false, false), domain.TrainStatusNotDeparted},
+		{"running", trainResult{TipoTreno: "PG"}, 3, stops(true, false, false), domain.TrainStatusRunning},
+		{"late", trainResult{TipoTreno: "PG"}, 40, stops(true, false, false), domain.TrainStatusDelayed},
+		{"detected without stop times", trainResult{OraUltimoRilevamento: 1737353400000}, 0, stops(false, false, false), domain.TrainStatusRunning},
+		{"arrived late", trainResult{Arrivato: true}, 40, stops(true, true, false), domain.TrainStatusArrived},
+		{"cancelled", trainResult{TipoTreno: "ST", Provvedimento: 1}, 0, stops(false, false, false), domain.TrainStatusCancelled},
+		{"short-formed", trainResult{TipoTreno: "SF"}, 0, stops(true, false, false), domain.TrainStatusPartiallyCancelled},
+		{"cancelled stop", trainResult{TipoTreno: "PG"}, 0, stops(true, false, true), domain.TrainStatusPartiallyCancelled},
+		{"rerouted", trainResult{TipoTreno: "DV"}, 10, stops(true, false, false), domain.TrainStatusRerouted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			train := &domain.Train{Delay: tt.delay, Stops: tt.stops}
+			if got := trainStatus(tt.result, train); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
 			}
 		})
 	}
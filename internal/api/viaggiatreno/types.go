@@ -10,36 +10,44 @@ type stationSearchResult struct {
 type departureResult struct {
 	NumeroTreno                           int    `json:"numeroTreno"`
 	CategoriaDescrizione                  string `json:"categoriaDescrizione"`
+	CodOrigine                            string `json:"codOrigine"`
 	Destinazione                          string `json:"destinazione"`
 	OrarioPartenza                        int64  `json:"orarioPartenza"`
 	Ritardo                               int    `json:"ritardo"`
 	BinarioProgrammatoPartenzaDescrizione string `json:"binarioProgrammatoPartenzaDescrizione"`
 	BinarioEffettivoPartenzaDescrizione   string `json:"binarioEffettivoPartenzaDescrizione"`
 	Provvedimento                         int    `json:"provvedimento"`
+	DataPartenzaTreno                     int64  `json:"dataPartenzaTreno"` // midnight of the day the train leaves its origin
 }
 
 type arrivalResult struct {
 	NumeroTreno                         int    `json:"numeroTreno"`
 	CategoriaDescrizione                string `json:"categoriaDescrizione"`
 	Origine                             string `json:"origine"`
+	CodOrigine                          string `json:"codOrigine"`
 	OrarioArrivo                        int64  `json:"orarioArrivo"`
 	Ritardo                             int    `json:"ritardo"`
 	BinarioProgrammatoArrivoDescrizione string `json:"binarioProgrammatoArrivoDescrizione"`
 	BinarioEffettivoArrivoDescrizione   string `json:"binarioEffettivoArrivoDescrizione"`
 	Provvedimento                       int    `json:"provvedimento"`
+	DataPartenzaTreno                   int64  `json:"dataPartenzaTreno"` // midnight of the day the train leaves its origin
 }
 
 type trainResult struct {
-	NumeroTreno          int          `json:"numeroTreno"`
-	Categoria            string       `json:"categoria"`
-	Origine              string       `json:"origine"`
-	Destinazione         string       `json:"destinazione"`
-	OrarioPartenza       int64        `json:"orarioPartenza"`
-	OrarioArrivo         int64        `json:"orarioArrivo"`
-	Ritardo              int          `json:"ritardo"`
-	Provvedimento        int          `json:"provvedimento"`
-	OraUltimoRilevamento int64        `json:"oraUltimoRilevamento"`
-	Fermate              []stopResult `json:"fermate"`
+	NumeroTreno               int          `json:"numeroTreno"`
+	Categoria                 string       `json:"categoria"`
+	Origine                   string       `json:"origine"`
+	IDOrigine                 string       `json:"idOrigine"`
+	Destinazione              string       `json:"destinazione"`
+	OrarioPartenza            int64        `json:"orarioPartenza"`
+	OrarioArrivo              int64        `json:"orarioArrivo"`
+	Ritardo                   int          `json:"ritardo"`
+	Provvedimento             int          `json:"provvedimento"`
+	TipoTreno                 string       `json:"tipoTreno"` // PG=as planned, ST=cancelled, PP/SI/SF=partially cancelled, DV=rerouted
+	Arrivato                  bool         `json:"arrivato"`
+	OraUltimoRilevamento      int64        `json:"oraUltimoRilevamento"`
+	StazioneUltimoRilevamento string       `json:"stazioneUltimoRilevamento"`
+	Fermate                   []stopResult `json:"fermate"`
 }
 
 type stopResult struct {
@@ -53,5 +61,20 @@ type stopResult struct {
 	RitardoPartenza                       int    `json:"ritardoPartenza"`
 	BinarioProgrammatoPartenzaDescrizione string `json:"binarioProgrammatoPartenzaDescrizione"`
 	BinarioEffettivoPartenzaDescrizione   string `json:"binarioEffettivoPartenzaDescrizione"`
-	TipoFermata                           string `json:"tipoFermata"` // P=origin, A=destination, F=intermediate
+	BinarioProgrammatoArrivoDescrizione   string `json:"binarioProgrammatoArrivoDescrizione"`
+	BinarioEffettivoArrivoDescrizione     string `json:"binarioEffettivoArrivoDescrizione"`
+	TipoFermata                           string `json:"tipoFermata"`       // P=origin, A=destination, F=intermediate
+	ActualFermataType                     int    `json:"actualFermataType"` // 3=stop cancelled
+}
+
+type stationDetailResult struct {
+	CodiceStazione string  `json:"codiceStazione"`
+	CodReg         int     `json:"codReg"`
+	Lat            float64 `json:"lat"`
+	Lon            float64 `json:"lon"`
+	NomeCitta      string  `json:"nomeCitta"`
+	Localita       struct {
+		NomeLungo string `json:"nomeLungo"`
+		NomeBreve string `json:"nomeBreve"`
+	} `json:"localita"`
 }
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/service"
+)
+
+// How often station boards are snapshotted. Boards list the trains of the
+// next hour or so, so every train shows up on a few snapshots.
+const defaultBoardInterval = 15 * time.Minute
+
+// BoardRecorder periodically snapshots the departure and arrival boards of a
+// set of stations, recording every train passing through them
+type BoardRecorder struct {
+	api      api.TrainClient
+	svc      *service.Service
+	stations []string
+
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewBoardRecorder snapshots the stations every interval, or every 15
+// minutes when interval is zero
+func NewBoardRecorder(api api.TrainClient, svc *service.Service, stations []string, interval time.Duration) *BoardRecorder {
+	if interval <= 0 {
+		interval = defaultBoardInterval
+	}
+	return &BoardRecorder{
+		api:      api,
+		svc:      svc,
+		stations: stations,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// BoardStationsFromEnv reads the comma-separated station codes in
+// TRENI_BOARD_STATIONS
+func BoardStationsFromEnv() []string {
+	return ParseWatchlist(os.Getenv("TRENI_BOARD_STATIONS"))
+}
+
+// BoardIntervalFromEnv reads TRENI_BOARD_INTERVAL as a duration such as 10m,
+// falling back to the default when it is unset or malformed
+func BoardIntervalFromEnv() time.Duration {
+	s := os.Getenv("TRENI_BOARD_INTERVAL")
+	if s == "" {
+		return defaultBoardInterval
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Printf("board recorder: invalid TRENI_BOARD_INTERVAL %q, using %s", s, defaultBoardInterval)
+		return defaultBoardInterval
+	}
+	return d
+}
+
+// Run snapshots every station right away, then once per interval, and
+// blocks until ctx is done
+func (r *BoardRecorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.snapshotAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshotAll records the boards of every station at once
+func (r *BoardRecorder) snapshotAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, code := range r.stations {
+		wg.Add(1)
+		go func(code string) {
+			defer wg.Done()
+			if err := r.snapshot(ctx, code); err != nil {
+				log.Printf("board recorder: station %s: %v", code, err)
+			}
+		}(code)
+	}
+	wg.Wait()
+}
+
+func (r *BoardRecorder) snapshot(ctx context.Context, code string) error {
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	station, err := r.api.GetStation(reqCtx, code)
+	if err != nil {
+		return err
+	}
+	return r.svc.RecordBoard(reqCtx, station, r.now())
+}
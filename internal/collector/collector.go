@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/service"
+)
+
+const (
+	// How long after the expected arrival we wait before capturing, so the
+	// last detection has reached ViaggiaTreno
+	defaultGrace = 15 * time.Minute
+	// Used after an upstream error or when the train has not reached its
+	// destination yet
+	defaultRetryInterval = 10 * time.Minute
+	// How long past the expected arrival we keep waiting for the final stop
+	// to be detected before recording whatever delay we have
+	defaultMaxWait = 3 * time.Hour
+	// How often a running train's delay is observed, to build its timeline
+	defaultObserveInterval = 5 * time.Minute
+)
+
+// Collector periodically records the final delay of every train in its
+// watchlist, once per day, shortly after each train's arrival. While a train
+// runs its delay is observed every few minutes.
+type Collector struct {
+	api       api.TrainClient
+	svc       *service.Service
+	watchlist []string
+
+	grace         time.Duration
+	retryInterval time.Duration
+	maxWait       time.Duration
+	now           func() time.Time
+
+	observeInterval time.Duration
+}
+
+func New(api api.TrainClient, svc *service.Service, watchlist []string) *Collector {
+	return &Collector{
+		api:           api,
+		svc:           svc,
+		watchlist:     watchlist,
+		grace:         defaultGrace,
+		retryInterval: defaultRetryInterval,
+		maxWait:       defaultMaxWait,
+		now:           time.Now,
+
+		observeInterval: defaultObserveInterval,
+	}
+}
+
+// WatchlistFromEnv reads the comma-separated trains in TRENI_WATCHLIST
+func WatchlistFromEnv() []string {
+	return ParseWatchlist(os.Getenv("TRENI_WATCHLIST"))
+}
+
+// ParseWatchlist splits a comma or whitespace separated list of trains,
+// dropping empty entries and duplicates. A train is a number, or NUMBER/ORIGIN
+// when several trains share the number.
+func ParseWatchlist(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t'
+	})
+
+	seen := make(map[string]bool, len(fields))
+	var trains []string
+	for _, f := range fields {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		trains = append(trains, f)
+	}
+	return trains
+}
+
+// Run schedules every train in the watchlist and blocks until ctx is done
+func (c *Collector) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, entry := range c.watchlist {
+		ref, err := domain.ParseTrainRef(entry)
+		if err != nil || !ref.Date.IsZero() {
+			log.Printf("collector: skipping %q: want NUMBER or NUMBER/ORIGIN", entry)
+			continue
+		}
+		wg.Add(1)
+		go func(ref domain.TrainRef) {
+			defer wg.Done()
+			c.watch(ctx, ref)
+		}(ref)
+	}
+	wg.Wait()
+}
+
+func (c *Collector) watch(ctx context.Context, ref domain.TrainRef) {
+	next := c.now()
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		next = c.poll(ctx, ref)
+		log.Printf("collector: train %s next check at %s", ref, next.Format(time.DateTime))
+	}
+}
+
+// poll fetches the train, records it if its final delay is known, or observes
+// it while it runs, and returns when the train should be checked next
+func (c *Collector) poll(ctx context.Context, ref domain.TrainRef) time.Time {
+	now := c.now()
+
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	train, err := api.GetTrainRun(reqCtx, c.api, ref)
+	if err != nil {
+		log.Printf("collector: get train %s: %v", ref, err)
+		return now.Add(c.retryInterval)
+	}
+
+	due := c.captureTime(train)
+	if due.IsZero() {
+		return now.Add(c.retryInterval)
+	}
+	if dep := train.DepartureTime; !dep.IsZero() && now.Before(dep) {
+		return dep
+	}
+	if now.Before(due) {
+		c.observe(reqCtx, train, now)
+		if next := now.Add(c.observeInterval); next.Before(due) {
+			return next
+		}
+		return due
+	}
+	if train.Completeness() != domain.CompletenessArrived && now.Before(due.Add(c.maxWait)) {
+		c.observe(reqCtx, train, now)
+		return now.Add(c.retryInterval)
+	}
+
+	if err := c.record(reqCtx, train); err != nil {
+		log.Printf("collector: record train %s: %v", ref, err)
+		return now.Add(c.retryInterval)
+	}
+	log.Printf("collector: recorded %s %s delay %+d min", train.Category, train.Number, train.Delay)
+
+	// Tomorrow's run is expected at about the same time
+	return due.Add(24 * time.Hour)
+}
+
+// captureTime is the moment the train's final delay should be known:
+// scheduled arrival plus current delay plus a grace period
+func (c *Collector) captureTime(train *domain.Train) time.Time {
+	if train.ArrivalTime.IsZero() {
+		return time.Time{}
+	}
+	delay := time.Duration(max(train.Delay, 0)) * time.Minute
+	return train.ArrivalTime.Add(delay + c.grace)
+}
+
+// observe adds the train's current delay to its run's timeline. A failure
+// is only logged: the final record does not depend on it.
+func (c *Collector) observe(ctx context.Context, train *domain.Train, now time.Time) {
+	if err := c.svc.ObserveTrain(ctx, train, c.serviceDay(train), now); err != nil {
+		log.Printf("collector: observe train %s: %v", train.Number, err)
+	}
+}
+
+// record files the train under its service day, so a run crossing midnight
+// or leaving just after it is not credited to the wrong day
+func (c *Collector) record(ctx context.Context, train *domain.Train) error {
+	return c.svc.RecordTrain(ctx, train, c.serviceDay(train))
+}
+
+func (c *Collector) serviceDay(train *domain.Train) time.Time {
+	if date := train.ServiceDay(); !date.IsZero() {
+		return date
+	}
+	return domain.ServiceDay(c.now())
+}
@@ -0,0 +1,320 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/service"
+	"github.com/emiliopalmerini/treni/internal/storage"
+	"github.com/emiliopalmerini/treni/internal/storage/sqlc"
+)
+
+type fakeClient struct {
+	train   *domain.Train
+	station *domain.Station
+}
+
+func (f *fakeClient) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	return f.train, nil
+}
+
+func (f *fakeClient) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	return f.station, nil
+}
+
+func (f *fakeClient) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	return nil, nil
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := storage.NewLocal(filepath.Join(t.TempDir(), "treni.db"))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db.DB
+}
+
+func TestParseWatchlist(t *testing.T) {
+	got := ParseWatchlist(" 9311, 2015,,9311\n10911 ")
+	want := []string{"9311", "2015", "10911"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	departure := time.Date(2025, 1, 18, 7, 0, 0, 0, time.UTC)
+	arrival := time.Date(2025, 1, 18, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		arrived     bool
+		wantNext    time.Time
+		wantRecord  bool
+		wantObserve bool
+	}{
+		{"before departure", departure.Add(-time.Hour), false, departure, false, false},
+		{"running", arrival.Add(-time.Hour), false, arrival.Add(-55 * time.Minute), false, true},
+		{"about to arrive", arrival.Add(18 * time.Minute), false, arrival.Add(20 * time.Minute), false, true},
+		{"not yet arrived", arrival.Add(30 * time.Minute), false, arrival.Add(40 * time.Minute), false, true},
+		{"arrived", arrival.Add(30 * time.Minute), true, arrival.Add(24*time.Hour + 20*time.Minute), true, true},
+		{"gave up waiting", arrival.Add(4 * time.Hour), false, arrival.Add(24*time.Hour + 20*time.Minute), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last := domain.Stop{StationCode: "S01700", ScheduledArrival: arrival}
+			if tt.arrived {
+				last.ActualArrival = arrival.Add(5 * time.Minute)
+			}
+			train := &domain.Train{
+				Number:        "9311",
+				Category:      "FR",
+				Origin:        "ROMA TERMINI",
+				Destination:   "MILANO CENTRALE",
+				DepartureTime: departure,
+				ArrivalTime:   arrival,
+				Delay:         5,
+				Status:        domain.TrainStatusOnTime,
+				Stops:         []domain.Stop{last},
+			}
+
+			db := newTestDB(t)
+			queries := sqlc.New(db)
+			client := &fakeClient{train: train}
+			c := New(client, service.New(client, db), []string{"9311"})
+			c.now = func() time.Time { return tt.now }
+
+			next := c.poll(context.Background(), domain.TrainRef{Number: "9311"})
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("next = %v, want %v", next, tt.wantNext)
+			}
+
+			records, err := queries.GetDelayRecordsByTrain(context.Background(), sqlc.GetDelayRecordsByTrainParams{TrainNumber: "9311"})
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if got := len(records) == 1; got != tt.wantRecord {
+				t.Fatalf("recorded = %v, want %v", got, tt.wantRecord)
+			}
+			if tt.wantRecord && records[0].Delay != 5 {
+				t.Errorf("delay = %d, want 5", records[0].Delay)
+			}
+
+			stops, err := queries.GetStopRecordsByTrainAndStation(context.Background(), sqlc.GetStopRecordsByTrainAndStationParams{
+				TrainNumber: "9311",
+				StationCode: "S01700",
+			})
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if got := len(stops) == 1; got != tt.wantRecord {
+				t.Errorf("stop recorded = %v, want %v", got, tt.wantRecord)
+			}
+
+			observations, err := queries.GetDelayObservations(context.Background(), sqlc.GetDelayObservationsParams{
+				TrainNumber: "9311",
+				Date:        time.Date(2025, 1, 18, 0, 0, 0, 0, time.UTC),
+			})
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if got := len(observations) == 1; got != tt.wantObserve {
+				t.Errorf("observed = %v, want %v", got, tt.wantObserve)
+			}
+		})
+	}
+}
+
+func TestRecordServiceDay(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		departure time.Time
+		want      string
+	}{
+		// 23:20 UTC, as a provider may report it, is already the 19th in Rome
+		{"just after midnight", time.Date(2025, 1, 18, 23, 20, 0, 0, time.UTC), "2025-01-19"},
+		{"crossing midnight", time.Date(2025, 1, 18, 23, 50, 0, 0, rome), "2025-01-18"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			train := &domain.Train{
+				Number:        "1911",
+				Origin:        "ROMA TERMINI",
+				Destination:   "PALERMO CENTRALE",
+				DepartureTime: tt.departure,
+				ArrivalTime:   tt.departure.Add(12 * time.Hour),
+			}
+
+			db := newTestDB(t)
+			queries := sqlc.New(db)
+			client := &fakeClient{train: train}
+			c := New(client, service.New(client, db), nil)
+
+			if err := c.record(context.Background(), train); err != nil {
+				t.Fatalf("record failed: %v", err)
+			}
+			records, err := queries.GetDelayRecordsByTrain(context.Background(), sqlc.GetDelayRecordsByTrainParams{TrainNumber: "1911"})
+			if err != nil || len(records) != 1 {
+				t.Fatalf("got %d records, %v", len(records), err)
+			}
+			if got := records[0].Date.UTC().Format(time.DateOnly); got != tt.want {
+				t.Errorf("recorded on %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoardRecorder(t *testing.T) {
+	ctx := context.Background()
+	dep := time.Date(2025, 1, 18, 7, 0, 0, 0, domain.Rome)
+	board := func(delay int) *domain.Station {
+		return &domain.Station{
+			Code:   "S08409",
+			Name:   "ROMA TERMINI",
+			Source: "test",
+			Departures: []domain.Departure{{
+				TrainNumber:   "9311",
+				TrainCategory: "FR",
+				OriginCode:    "S08409",
+				Destination:   "MILANO CENTRALE",
+				ScheduledTime: dep,
+				Delay:         delay,
+				Platform:      "5",
+				Status:        domain.TrainStatusOnTime,
+			}},
+		}
+	}
+
+	db := newTestDB(t)
+	client := &fakeClient{station: board(2)}
+	svc := service.New(client, db)
+	r := NewBoardRecorder(client, svc, []string{"S08409"}, 0)
+	r.now = func() time.Time { return dep.Add(-10 * time.Minute) }
+
+	// A later snapshot of the same board replaces the first one
+	r.snapshotAll(ctx)
+	client.station = board(18)
+	r.snapshotAll(ctx)
+
+	history, err := svc.GetDelayHistory(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil {
+		t.Fatalf("GetDelayHistory failed: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d runs, want 1 observed run", len(history))
+	}
+	if h := history[0]; !h.Observed || h.Delay != 18 || h.Destination != "MILANO CENTRALE" || h.Date.Format(time.DateOnly) != "2025-01-18" {
+		t.Errorf("unexpected observed run: %+v", h)
+	}
+
+	// Seen at its origin only, the run is provisional
+	stats, err := svc.GetTrainStats(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil || stats == nil {
+		t.Fatalf("GetTrainStats failed: %v", err)
+	}
+	if stats.TotalTrips != 0 || stats.ProvisionalTrips != 1 {
+		t.Errorf("stats = %+v, want the observed run provisional", stats)
+	}
+
+	// The arrival board of its destination gives the final delay
+	client.station = &domain.Station{
+		Code:   "S01700",
+		Name:   "MILANO CENTRALE",
+		Source: "test",
+		Arrivals: []domain.Arrival{{
+			TrainNumber:   "9311",
+			TrainCategory: "FR",
+			OriginCode:    "S08409",
+			Origin:        "ROMA TERMINI",
+			ScheduledTime: dep.Add(3 * time.Hour),
+			Delay:         20,
+			Status:        domain.TrainStatusDelayed,
+		}},
+	}
+	r.snapshotAll(ctx)
+	stats, err = svc.GetTrainStats(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil || stats == nil {
+		t.Fatalf("GetTrainStats failed: %v", err)
+	}
+	if stats.TotalTrips != 1 || stats.DelayedTrips != 1 || stats.MaxDelay != 20 || stats.ProvisionalTrips != 0 {
+		t.Errorf("stats = %+v, want the observed run counted as delayed", stats)
+	}
+
+	// A delay record for the day takes over from the observations
+	train := &domain.Train{Number: "9311", OriginCode: "S08409", Origin: "ROMA TERMINI", Destination: "MILANO CENTRALE", Delay: 3, Source: "test"}
+	if err := svc.RecordTrain(ctx, train, domain.ServiceDay(dep)); err != nil {
+		t.Fatalf("RecordTrain failed: %v", err)
+	}
+	history, err = svc.GetDelayHistory(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil {
+		t.Fatalf("GetDelayHistory failed: %v", err)
+	}
+	if len(history) != 1 || history[0].Observed || history[0].Delay != 3 {
+		t.Errorf("got %+v, want only the recorded run", history)
+	}
+}
+
+func TestBoardRecorderArrivalsOnly(t *testing.T) {
+	ctx := context.Background()
+	arr := time.Date(2025, 1, 18, 10, 0, 0, 0, domain.Rome)
+
+	db := newTestDB(t)
+	client := &fakeClient{station: &domain.Station{
+		Code:   "S01700",
+		Name:   "MILANO CENTRALE",
+		Source: "test",
+		Arrivals: []domain.Arrival{{
+			TrainNumber:   "9311",
+			TrainCategory: "FR",
+			OriginCode:    "S08409",
+			Origin:        "ROMA TERMINI",
+			ScheduledTime: arr,
+			Delay:         20,
+			Status:        domain.TrainStatusDelayed,
+		}},
+	}}
+	svc := service.New(client, db)
+	r := NewBoardRecorder(client, svc, []string{"S01700"}, 0)
+	r.now = func() time.Time { return arr.Add(-10 * time.Minute) }
+	r.snapshotAll(ctx)
+
+	// Seen only where it arrives, the run ends there
+	history, err := svc.GetDelayHistory(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil {
+		t.Fatalf("GetDelayHistory failed: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d runs, want 1 observed run", len(history))
+	}
+	if h := history[0]; h.Destination != "MILANO CENTRALE" || h.Completeness != domain.CompletenessArrived {
+		t.Errorf("unexpected observed run: %+v", h)
+	}
+
+	stats, err := svc.GetTrainStats(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil || stats == nil {
+		t.Fatalf("GetTrainStats failed: %v", err)
+	}
+	if stats.TotalTrips != 1 || stats.DelayedTrips != 1 || stats.ProvisionalTrips != 0 {
+		t.Errorf("stats = %+v, want the observed run counted as delayed", stats)
+	}
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/service"
+)
+
+// How far back provisional records are polled again. Providers only know
+// the runs of the last day or so.
+const finalizeWindow = 48 * time.Hour
+
+// Finalizer periodically polls again the runs recorded before they arrived,
+// replacing their provisional delay with the final one once the arrival is
+// seen
+type Finalizer struct {
+	svc      *service.Service
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewFinalizer(svc *service.Service) *Finalizer {
+	return &Finalizer{
+		svc:      svc,
+		interval: defaultRetryInterval,
+		now:      time.Now,
+	}
+}
+
+// Run finalises what it can right away, then once per interval, and blocks
+// until ctx is done
+func (f *Finalizer) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		f.finalize(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *Finalizer) finalize(ctx context.Context) {
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	since := domain.ServiceDay(f.now().Add(-finalizeWindow))
+	n, err := f.svc.FinalizeRecords(reqCtx, since)
+	if err != nil {
+		log.Printf("finalizer: %v", err)
+	}
+	if n > 0 {
+		log.Printf("finalizer: finalised %d records", n)
+	}
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"math"
+	"strconv"
+)
+
+// DelayHistogramBounds are the upper bounds, in minutes, of the delay
+// histogram buckets; a last bucket holds every delay above the highest. The
+// first bucket also holds early trips.
+var DelayHistogramBounds = []int{5, 15, 30, 60}
+
+// DelayBucket counts the trips whose delay was over Min and up to Max
+// minutes. Max is zero for the last, open-ended bucket.
+type DelayBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max,omitempty"`
+	Trips int `json:"trips"`
+}
+
+// Label names the bucket by its bounds, such as 5-15 or 60+
+func (b DelayBucket) Label() string {
+	if b.Max == 0 {
+		return strconv.Itoa(b.Min) + "+"
+	}
+	return strconv.Itoa(b.Min) + "-" + strconv.Itoa(b.Max)
+}
+
+// SetDistribution fills the percentiles, standard deviation and histogram
+// from the delays of the trips that ran, sorted in ascending order
+func (s *TrainStats) SetDistribution(delays []int) {
+	s.P50Delay = percentile(delays, 50)
+	s.P80Delay = percentile(delays, 80)
+	s.P95Delay = percentile(delays, 95)
+	s.DelayStdDev = stdDev(delays)
+	s.Histogram = histogram(delays)
+}
+
+// percentile is the nearest-rank p-th percentile of sorted delays: the
+// smallest delay at least p percent of the trips did not exceed
+func percentile(sorted []int, p int) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// stdDev is the population standard deviation of the delays
+func stdDev(delays []int) float64 {
+	if len(delays) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, d := range delays {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(delays))
+
+	var squares float64
+	for _, d := range delays {
+		squares += (float64(d) - mean) * (float64(d) - mean)
+	}
+	return math.Sqrt(squares / float64(len(delays)))
+}
+
+func histogram(delays []int) []DelayBucket {
+	buckets := make([]DelayBucket, len(DelayHistogramBounds)+1)
+	lower := 0
+	for i, bound := range DelayHistogramBounds {
+		buckets[i] = DelayBucket{Min: lower, Max: bound}
+		lower = bound
+	}
+	buckets[len(buckets)-1] = DelayBucket{Min: lower}
+
+	for _, d := range delays {
+		i := 0
+		for i < len(DelayHistogramBounds) && d > DelayHistogramBounds[i] {
+			i++
+		}
+		buckets[i].Trips++
+	}
+	return buckets
+}
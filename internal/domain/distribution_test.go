@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSetDistribution(t *testing.T) {
+	// Mostly on time, with a weekly disaster
+	var stats TrainStats
+	stats.SetDistribution([]int{-1, 0, 1, 2, 3, 4, 5, 6, 12, 16, 31, 60, 61, 90})
+
+	if stats.P50Delay != 5 || stats.P80Delay != 60 || stats.P95Delay != 90 {
+		t.Errorf("percentiles = %d/%d/%d, want 5/60/90", stats.P50Delay, stats.P80Delay, stats.P95Delay)
+	}
+
+	want := map[string]int{"0-5": 7, "5-15": 2, "15-30": 1, "30-60": 2, "60+": 2}
+	if len(stats.Histogram) != len(want) {
+		t.Fatalf("got %d buckets, want %d", len(stats.Histogram), len(want))
+	}
+	for _, b := range stats.Histogram {
+		if b.Trips != want[b.Label()] {
+			t.Errorf("bucket %s has %d trips, want %d", b.Label(), b.Trips, want[b.Label()])
+		}
+	}
+
+	stats.SetDistribution([]int{4, 4, 4, 4})
+	if stats.DelayStdDev != 0 || stats.P95Delay != 4 {
+		t.Errorf("steady train: stddev %.1f, p95 %d, want 0 and 4", stats.DelayStdDev, stats.P95Delay)
+	}
+	stats.SetDistribution([]int{0, 10})
+	if math.Abs(stats.DelayStdDev-5) > 1e-9 {
+		t.Errorf("stddev = %f, want 5", stats.DelayStdDev)
+	}
+}
@@ -3,31 +3,115 @@ package domain
 import "time"
 
 type DelayRecord struct {
-	ID            int64
-	TrainNumber   string
-	TrainCategory string
-	Origin        string
-	Destination   string
-	Date          time.Time
-	Delay         int
-	Cancelled     bool
-	Source        string
-	RecordedAt    time.Time
+	ID            int64     `json:"id"`
+	TrainNumber   string    `json:"train_number"`
+	OriginCode    string    `json:"origin_code"`
+	TrainCategory string    `json:"train_category"`
+	Origin        string    `json:"origin"`
+	Destination   string    `json:"destination"`
+	Date          time.Time `json:"date,omitzero"`
+	Delay         int       `json:"delay"`
+	Cancelled     bool      `json:"cancelled"`
+	Source        string    `json:"source"`
+	RecordedAt    time.Time `json:"recorded_at,omitzero"`
+	// Status is the train's status when recorded; empty for older records
+	Status TrainStatus `json:"status,omitempty"`
+	// Observed is set for runs known only from station board snapshots,
+	// whose delay is the one last seen on a board
+	Observed bool `json:"observed,omitempty"`
+	// Completeness tells a final record from one taken before the train
+	// reached its destination
+	Completeness Completeness `json:"completeness,omitempty"`
+}
+
+// DelayObservation is a train run's delay as seen by one poll during the
+// journey
+type DelayObservation struct {
+	ObservedAt  time.Time   `json:"observed_at"`
+	Delay       int         `json:"delay"`
+	LastStation string      `json:"last_station,omitempty"`
+	Status      TrainStatus `json:"status,omitempty"`
+	Source      string      `json:"source,omitempty"`
 }
 
 type TrainStats struct {
-	TrainNumber    string
-	TotalTrips     int
-	OnTimeTrips    int
-	DelayedTrips   int
-	CancelledTrips int
-	AverageDelay   float64
-	MaxDelay       int
-	OnTimeRate     float64
-	Period         StatsPeriod
+	TrainNumber    string `json:"train_number"`
+	TotalTrips     int    `json:"total_trips"`
+	OnTimeTrips    int    `json:"on_time_trips"`
+	DelayedTrips   int    `json:"delayed_trips"`
+	CancelledTrips int    `json:"cancelled_trips"`
+	// PartiallyCancelledTrips ran on part of their route; they also count
+	// as on time or delayed
+	PartiallyCancelledTrips int         `json:"partially_cancelled_trips"`
+	ReroutedTrips           int         `json:"rerouted_trips"`
+	AverageDelay            float64     `json:"average_delay"`
+	MaxDelay                int         `json:"max_delay"`
+	OnTimeRate              float64     `json:"on_time_rate"`
+	Period                  StatsPeriod `json:"period"`
+	// ProvisionalTrips were recorded before the train arrived; they are
+	// left out of every other figure until finalised
+	ProvisionalTrips int `json:"provisional_trips"`
+	// OnTimeThreshold is the delay, in minutes, up to which a trip counts as
+	// on time, from the punctuality policy
+	OnTimeThreshold int `json:"on_time_threshold"`
+
+	// How the delays of the trips that ran are spread, in minutes; see
+	// SetDistribution
+	P50Delay    int           `json:"p50_delay"`
+	P80Delay    int           `json:"p80_delay"`
+	P95Delay    int           `json:"p95_delay"`
+	DelayStdDev float64       `json:"delay_stddev"`
+	Histogram   []DelayBucket `json:"histogram"`
 }
 
 type StatsPeriod struct {
-	From time.Time
-	To   time.Time
+	From time.Time `json:"from,omitzero"`
+	To   time.Time `json:"to,omitzero"`
+}
+
+type StopRecord struct {
+	ID                int64     `json:"id"`
+	TrainNumber       string    `json:"train_number"`
+	OriginCode        string    `json:"origin_code"`
+	Date              time.Time `json:"date,omitzero"`
+	StationCode       string    `json:"station_code"`
+	StationName       string    `json:"station_name"`
+	StopIndex         int       `json:"stop_index"`
+	ScheduledArrival  time.Time `json:"scheduled_arrival,omitzero"`
+	ActualArrival     time.Time `json:"actual_arrival,omitzero"`
+	ScheduledDepart   time.Time `json:"scheduled_departure,omitzero"`
+	ActualDepart      time.Time `json:"actual_departure,omitzero"`
+	ArrivalDelay      int       `json:"arrival_delay"`
+	DepartureDelay    int       `json:"departure_delay"`
+	Platform          string    `json:"platform"`
+	PlatformConfirmed bool      `json:"platform_confirmed"`
+	ScheduledPlatform string    `json:"scheduled_platform,omitempty"`
+	Source            string    `json:"source"`
+	RecordedAt        time.Time `json:"recorded_at,omitzero"`
+	// StopSource and PlatformSource are the providers that supplied the
+	// stop's times and its platform, which may differ from the run's Source
+	// when providers were merged. Empty on records from before they were kept.
+	StopSource     string `json:"stop_source,omitempty"`
+	PlatformSource string `json:"platform_source,omitempty"`
+}
+
+type StopStats struct {
+	TrainNumber           string  `json:"train_number"`
+	StationCode           string  `json:"station_code"`
+	TotalStops            int     `json:"total_stops"`
+	OnTimeStops           int     `json:"on_time_stops"`
+	AverageArrivalDelay   float64 `json:"average_arrival_delay"`
+	MaxArrivalDelay       int     `json:"max_arrival_delay"`
+	AverageDepartureDelay float64 `json:"average_departure_delay"`
+	OnTimeRate            float64 `json:"on_time_rate"`
+}
+
+// PlatformUsage is how often a train left from, or arrived at, a platform
+// of a station over its recorded runs
+type PlatformUsage struct {
+	Platform string `json:"platform"`
+	Uses     int    `json:"uses"`
+	// Changes counts the uses that replaced another timetabled platform
+	Changes int     `json:"changes"`
+	Share   float64 `json:"share"` // 0-1 of the runs with a known platform
 }
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// Journey is a direct train between two stations
+type Journey struct {
+	TrainNumber   string `json:"train_number"`
+	TrainCategory string `json:"train_category"`
+	// Origin and Destination are the train's own terminals
+	Origin      string      `json:"origin"`
+	OriginCode  string      `json:"origin_code,omitempty"`
+	Destination string      `json:"destination"`
+	Delay       int         `json:"delay"`
+	Status      TrainStatus `json:"status"`
+	// From is the stop where the passenger boards, To where they alight
+	From Stop `json:"from"`
+	To   Stop `json:"to"`
+}
+
+// ExpectedDeparture is the actual departure when known, otherwise the
+// scheduled one shifted by the current delay
+func (s Stop) ExpectedDeparture() time.Time {
+	if !s.ActualDepart.IsZero() || s.ScheduledDepart.IsZero() {
+		return s.ActualDepart
+	}
+	return s.ScheduledDepart.Add(time.Duration(s.DepartureDelay) * time.Minute)
+}
+
+// ExpectedArrival is the actual arrival when known, otherwise the scheduled
+// one shifted by the current delay
+func (s Stop) ExpectedArrival() time.Time {
+	if !s.ActualArrival.IsZero() || s.ScheduledArrival.IsZero() {
+		return s.ActualArrival
+	}
+	return s.ScheduledArrival.Add(time.Duration(s.ArrivalDelay) * time.Minute)
+}
@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// Position is where a train is along its route at a given moment
+type Position struct {
+	// LastStation is where the train was last detected, empty before it
+	// leaves its origin. It may be a station the train passes without
+	// stopping.
+	LastStation string    `json:"last_station,omitempty"`
+	LastSeen    time.Time `json:"last_seen,omitzero"`
+	// LastStop is the index in Stops of the last stop reached, -1 before
+	// departure
+	LastStop int `json:"last_stop"`
+	// NextStop is the index in Stops of the next stop to call at, -1 once
+	// the train has arrived
+	NextStop int `json:"next_stop"`
+	// Progress is the share of the scheduled journey covered, 0 to 100
+	Progress int `json:"progress"`
+	// Remaining are the expected times at the stops still to come
+	Remaining []Estimate `json:"remaining"`
+}
+
+// Estimate is the expected time of a train at one of its next stops: the
+// scheduled time shifted by the train's current delay
+type Estimate struct {
+	// Stop is the index of the stop in Stops
+	Stop        int       `json:"stop"`
+	StationCode string    `json:"station_code,omitempty"`
+	StationName string    `json:"station_name"`
+	Arrival     time.Time `json:"arrival,omitzero"`
+	Departure   time.Time `json:"departure,omitzero"`
+}
+
+// Arrived reports whether the position is at the end of the journey
+func (p Position) Arrived() bool {
+	return p.NextStop < 0 && p.LastStop >= 0
+}
+
+// Position works out where the train is at now from the actual times of its
+// stops and the last station it was detected at
+func (t *Train) Position(now time.Time) Position {
+	pos := Position{LastStop: -1, NextStop: -1, LastSeen: t.LastUpdate}
+
+	for i, s := range t.Stops {
+		if !s.Cancelled && (!s.ActualArrival.IsZero() || !s.ActualDepart.IsZero()) {
+			pos.LastStop = i
+		}
+	}
+	// The provider may have detected the train at a stop that has no actual
+	// times yet
+	if t.LastStation != "" {
+		for i := pos.LastStop + 1; i < len(t.Stops); i++ {
+			if strings.EqualFold(t.Stops[i].StationName, t.LastStation) {
+				pos.LastStop = i
+				break
+			}
+		}
+	}
+	if t.Status == TrainStatusArrived && len(t.Stops) > 0 {
+		pos.LastStop = len(t.Stops) - 1
+	}
+
+	for i := pos.LastStop + 1; i < len(t.Stops); i++ {
+		if t.Stops[i].Cancelled {
+			continue
+		}
+		if pos.NextStop < 0 {
+			pos.NextStop = i
+		}
+		s := t.Stops[i]
+		pos.Remaining = append(pos.Remaining, Estimate{
+			Stop:        i,
+			StationCode: s.StationCode,
+			StationName: s.StationName,
+			Arrival:     delayed(s.ScheduledArrival, t.Delay),
+			Departure:   delayed(s.ScheduledDepart, t.Delay),
+		})
+	}
+
+	if pos.LastStop >= 0 {
+		pos.LastStation = t.LastStation
+		if pos.LastStation == "" {
+			pos.LastStation = t.Stops[pos.LastStop].StationName
+		}
+	}
+	pos.Progress = t.progress(pos, now)
+	return pos
+}
+
+// progress is the share of the scheduled journey time covered at now. Between
+// two stops it moves with the clock, but never past the next stop.
+func (t *Train) progress(pos Position, now time.Time) int {
+	if pos.LastStop < 0 || len(t.Stops) == 0 {
+		return 0
+	}
+	if pos.NextStop < 0 {
+		return 100
+	}
+
+	start := t.Stops[0].scheduled()
+	total := t.Stops[len(t.Stops)-1].scheduled().Sub(start)
+	if start.IsZero() || total <= 0 {
+		return 100 * (pos.LastStop + 1) / len(t.Stops)
+	}
+
+	last, next := t.Stops[pos.LastStop], t.Stops[pos.NextStop]
+	covered := last.scheduled().Sub(start)
+	reached := next.ScheduledArrival
+	if reached.IsZero() {
+		reached = next.scheduled()
+	}
+	leg := reached.Sub(last.scheduled())
+
+	left := last.ActualDepart
+	if left.IsZero() {
+		left = delayed(last.ScheduledDepart, t.Delay)
+	}
+	due := delayed(next.ScheduledArrival, t.Delay)
+	if leg > 0 && !left.IsZero() && due.After(left) && now.After(left) {
+		share := float64(now.Sub(left)) / float64(due.Sub(left))
+		covered += time.Duration(min(share, 1) * float64(leg))
+	}
+
+	return min(100, max(0, int(100*covered/total)))
+}
+
+// scheduled is the time the train is timetabled at the stop: its departure,
+// or its arrival at the destination
+func (s Stop) scheduled() time.Time {
+	if !s.ScheduledDepart.IsZero() {
+		return s.ScheduledDepart
+	}
+	return s.ScheduledArrival
+}
+
+func delayed(t time.Time, delay int) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.Add(time.Duration(delay) * time.Minute)
+}
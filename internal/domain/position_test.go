@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrainPosition(t *testing.T) {
+	at := func(hhmm string) time.Time {
+		c, _ := time.Parse("15:04", hhmm)
+		return time.Date(2025, 1, 20, c.Hour(), c.Minute(), 0, 0, Rome)
+	}
+	// A 60 minute journey: A 10:00, B 10:20-10:22, C 10:40-10:42, D 11:00
+	newTrain := func() *Train {
+		return &Train{
+			Number: "2345",
+			Delay:  5,
+			Stops: []Stop{
+				{StationName: "A", ScheduledDepart: at("10:00")},
+				{StationName: "B", ScheduledArrival: at("10:20"), ScheduledDepart: at("10:22")},
+				{StationName: "C", ScheduledArrival: at("10:40"), ScheduledDepart: at("10:42")},
+				{StationName: "D", ScheduledArrival: at("11:00")},
+			},
+		}
+	}
+
+	t.Run("not departed", func(t *testing.T) {
+		pos := newTrain().Position(at("09:50"))
+		if pos.LastStop != -1 || pos.NextStop != 0 || pos.Progress != 0 || pos.LastStation != "" {
+			t.Errorf("got %+v, want the train at its origin", pos)
+		}
+		if len(pos.Remaining) != 4 {
+			t.Errorf("got %d estimates, want 4", len(pos.Remaining))
+		}
+	})
+
+	t.Run("between stops", func(t *testing.T) {
+		train := newTrain()
+		train.Stops[0].ActualDepart = at("10:05")
+		train.Stops[1].ActualArrival = at("10:25")
+		train.Stops[1].ActualDepart = at("10:27")
+
+		// Halfway from B (left 10:27) to C (due 10:45)
+		pos := train.Position(at("10:36"))
+		if pos.LastStation != "B" || pos.LastStop != 1 || pos.NextStop != 2 {
+			t.Fatalf("got %+v, want between B and C", pos)
+		}
+		// 22 minutes to B plus half of the 18 to C, out of 60
+		if pos.Progress != 51 {
+			t.Errorf("Progress = %d, want 51", pos.Progress)
+		}
+		if len(pos.Remaining) != 2 {
+			t.Fatalf("got %d estimates, want 2", len(pos.Remaining))
+		}
+		if got := pos.Remaining[0].Arrival; !got.Equal(at("10:45")) {
+			t.Errorf("expected at C %s, want 10:45", got.Format("15:04"))
+		}
+		if got := pos.Remaining[1].Arrival; !got.Equal(at("11:05")) {
+			t.Errorf("expected at D %s, want 11:05", got.Format("15:04"))
+		}
+
+		// Running late, the train does not pass C before reaching it
+		if pos := train.Position(at("10:55")); pos.Progress != 66 {
+			t.Errorf("Progress = %d, want 66 until C is reached", pos.Progress)
+		}
+	})
+
+	t.Run("detected at a stop without times", func(t *testing.T) {
+		train := newTrain()
+		train.Stops[0].ActualDepart = at("10:05")
+		train.LastStation = "c"
+		pos := train.Position(at("10:46"))
+		if pos.LastStop != 2 || pos.NextStop != 3 || pos.LastStation != "c" {
+			t.Errorf("got %+v, want at C", pos)
+		}
+	})
+
+	t.Run("cancelled stops are skipped", func(t *testing.T) {
+		train := newTrain()
+		train.Stops[0].ActualDepart = at("10:05")
+		train.Stops[1].Cancelled = true
+		pos := train.Position(at("10:10"))
+		if pos.NextStop != 2 || len(pos.Remaining) != 2 {
+			t.Errorf("got %+v, want C as the next stop", pos)
+		}
+	})
+
+	t.Run("arrived", func(t *testing.T) {
+		train := newTrain()
+		train.Stops[3].ActualArrival = at("11:04")
+		pos := train.Position(at("11:10"))
+		if !pos.Arrived() || pos.LastStation != "D" || pos.Progress != 100 || len(pos.Remaining) != 0 {
+			t.Errorf("got %+v, want arrived at D", pos)
+		}
+	})
+}
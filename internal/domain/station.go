@@ -3,34 +3,94 @@ package domain
 import "time"
 
 type Station struct {
-	Code       string
-	Name       string
-	City       string
-	Region     string
-	Latitude   float64
-	Longitude  float64
-	Arrivals   []Arrival
-	Departures []Departure
+	Code       string      `json:"code"`
+	Name       string      `json:"name"`
+	City       string      `json:"city"`
+	Region     string      `json:"region"`
+	Latitude   float64     `json:"latitude"`
+	Longitude  float64     `json:"longitude"`
+	Arrivals   []Arrival   `json:"arrivals,omitempty"`
+	Departures []Departure `json:"departures,omitempty"`
+	// Source is the provider that supplied the boards
+	Source string `json:"source"`
 }
 
 type Arrival struct {
-	TrainNumber   string
-	TrainCategory string
-	Origin        string
-	ScheduledTime time.Time
-	ActualTime    time.Time
-	Delay         int
-	Platform      string
-	Status        TrainStatus
+	TrainNumber   string `json:"train_number"`
+	TrainCategory string `json:"train_category"`
+	Origin        string `json:"origin"`
+	// OriginCode is the station code of Origin, when the provider has one
+	OriginCode    string      `json:"origin_code,omitempty"`
+	ScheduledTime time.Time   `json:"scheduled_time,omitzero"`
+	ActualTime    time.Time   `json:"actual_time,omitzero"`
+	Delay         int         `json:"delay"`
+	Platform      string      `json:"platform"`
+	Status        TrainStatus `json:"status"`
+	// ScheduledPlatform is the timetabled platform, when the provider tells
+	// it apart from the actual one
+	ScheduledPlatform string `json:"scheduled_platform,omitempty"`
+	// OriginDeparture is when the train leaves its origin, or midnight of
+	// that day when the provider gives the day alone. Zero when unknown.
+	OriginDeparture time.Time `json:"origin_departure,omitzero"`
 }
 
 type Departure struct {
-	TrainNumber   string
-	TrainCategory string
-	Destination   string
-	ScheduledTime time.Time
-	ActualTime    time.Time
-	Delay         int
-	Platform      string
-	Status        TrainStatus
+	TrainNumber   string `json:"train_number"`
+	TrainCategory string `json:"train_category"`
+	// OriginCode is the station code where the train starts, which tells
+	// apart trains sharing a number
+	OriginCode    string      `json:"origin_code,omitempty"`
+	Destination   string      `json:"destination"`
+	ScheduledTime time.Time   `json:"scheduled_time,omitzero"`
+	ActualTime    time.Time   `json:"actual_time,omitzero"`
+	Delay         int         `json:"delay"`
+	Platform      string      `json:"platform"`
+	Status        TrainStatus `json:"status"`
+	// ScheduledPlatform is the timetabled platform, when the provider tells
+	// it apart from the actual one
+	ScheduledPlatform string `json:"scheduled_platform,omitempty"`
+	// OriginDeparture is when the train leaves its origin, or midnight of
+	// that day when the provider gives the day alone. Zero when unknown.
+	OriginDeparture time.Time `json:"origin_departure,omitzero"`
+}
+
+// PlatformChanged reports whether the train arrives at another platform
+// than the timetabled one
+func (a Arrival) PlatformChanged() bool {
+	return platformChanged(a.ScheduledPlatform, a.Platform)
+}
+
+// PlatformChanged reports whether the train leaves from another platform
+// than the timetabled one
+func (d Departure) PlatformChanged() bool {
+	return platformChanged(d.ScheduledPlatform, d.Platform)
+}
+
+// ServiceDay is the day of the run the arrival belongs to, the day it left
+// its origin, as Train.ServiceDay
+func (a Arrival) ServiceDay() time.Time {
+	return boardServiceDay(a.ScheduledTime, a.OriginDeparture)
+}
+
+// ServiceDay is the day of the run the departure belongs to, as for Arrival
+func (d Departure) ServiceDay() time.Time {
+	return boardServiceDay(d.ScheduledTime, d.OriginDeparture)
+}
+
+// boardServiceDay works out the day of a run from its time at a station and
+// its departure from the origin. An origin departure later than the station
+// time was read on the wrong day: the train set off the evening before.
+// Without one, the station time is all there is.
+func boardServiceDay(scheduled, originDeparture time.Time) time.Time {
+	switch {
+	case originDeparture.IsZero():
+		return ServiceDay(scheduled)
+	case originDeparture.After(scheduled):
+		return ServiceDay(originDeparture).AddDate(0, 0, -1)
+	}
+	return ServiceDay(originDeparture)
+}
+
+func platformChanged(scheduled, actual string) bool {
+	return scheduled != "" && actual != "" && actual != scheduled
 }
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// Timetables are read in Europe/Rome even on hosts without a zone database
+	_ "time/tzdata"
+)
+
+// Rome is the timezone of Italian timetables. Times given by users and
+// providers are read there, whatever the server's local timezone.
+var Rome = mustLoadLocation("Europe/Rome")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// ServiceDay is the day, in Rome, of the moment t. Applied to a train's
+// departure from its origin it names the run: a train crossing midnight
+// keeps the day it set off on, for its records as for its lookups.
+//
+// Days are midnight UTC of the calendar day, as time.Parse reads a
+// YYYY-MM-DD date, so they compare and store the same on any host.
+func ServiceDay(t time.Time) time.Time {
+	y, m, d := t.In(Rome).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// ParseBoardTime parses the time a station board is wanted for: HH:MM on the
+// day of now, or YYYY-MM-DDTHH:MM, both in Rome. An empty string or "now"
+// gives the zero time, meaning the current board.
+func ParseBoardTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "now") {
+		return time.Time{}, nil
+	}
+
+	if clock, err := time.Parse("15:04", s); err == nil {
+		y, m, d := now.In(Rome).Date()
+		return time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, Rome), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, Rome); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: want HH:MM or YYYY-MM-DDTHH:MM", s)
+}
@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBoardTime(t *testing.T) {
+	// 23:30 UTC is already the next day in Rome
+	now := time.Date(2025, 1, 20, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"18:30", "2025-01-21 18:30 +0100", false},
+		{"2025-07-01T07:05", "2025-07-01 07:05 +0200", false},
+		{"2025-07-01 07:05", "2025-07-01 07:05 +0200", false},
+		{"6pm", "", true},
+		{"25:00", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBoardTime(tt.in, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBoardTime failed: %v", err)
+			}
+			if s := got.Format("2006-01-02 15:04 -0700"); s != tt.want {
+				t.Errorf("ParseBoardTime(%q) = %s, want %s", tt.in, s, tt.want)
+			}
+		})
+	}
+
+	for _, in := range []string{"", "now"} {
+		if got, err := ParseBoardTime(in, now); err != nil || !got.IsZero() {
+			t.Errorf("ParseBoardTime(%q) = %v, %v, want the zero time", in, got, err)
+		}
+	}
+}
+
+func TestServiceDay(t *testing.T) {
+	tests := []struct {
+		name string
+		in   time.Time
+		want string
+	}{
+		{"evening in Rome", time.Date(2025, 1, 20, 21, 0, 0, 0, Rome), "2025-01-20"},
+		{"after midnight in Rome, before in UTC", time.Date(2025, 1, 20, 23, 30, 0, 0, time.UTC), "2025-01-21"},
+		{"summer time", time.Date(2025, 7, 1, 22, 30, 0, 0, time.UTC), "2025-07-02"},
+		{"west of UTC", time.Date(2025, 1, 20, 20, 0, 0, 0, time.FixedZone("EST", -5*3600)), "2025-01-21"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ServiceDay(tt.in)
+			if s := got.Format(time.DateOnly); s != tt.want {
+				t.Errorf("ServiceDay(%v) = %s, want %s", tt.in, s, tt.want)
+			}
+			if got.Location() != time.UTC || got.Hour() != 0 {
+				t.Errorf("ServiceDay(%v) = %v, want midnight UTC", tt.in, got)
+			}
+		})
+	}
+}
+
+func TestTrainServiceDay(t *testing.T) {
+	// The night train leaves on the 20th and arrives on the 21st
+	train := &Train{
+		Number:        "1911",
+		DepartureTime: time.Date(2025, 1, 20, 23, 50, 0, 0, Rome),
+		ArrivalTime:   time.Date(2025, 1, 21, 6, 10, 0, 0, Rome),
+	}
+	if got := train.Ref().String(); got != "1911//2025-01-20" {
+		t.Errorf("Ref() = %s, want the departure day", got)
+	}
+
+	// Without a departure time, the origin stop gives the day
+	train.DepartureTime = time.Time{}
+	train.Stops = []Stop{{ScheduledDepart: time.Date(2025, 1, 20, 22, 50, 0, 0, time.UTC)}}
+	if got := train.ServiceDay().Format(time.DateOnly); got != "2025-01-20" {
+		t.Errorf("ServiceDay() = %s, want 2025-01-20", got)
+	}
+
+	train.Stops = nil
+	if !train.ServiceDay().IsZero() {
+		t.Error("a train without times has no service day")
+	}
+}
+
+func TestBoardServiceDay(t *testing.T) {
+	// The night train from the 20th, at a station past midnight
+	at := time.Date(2025, 1, 21, 0, 40, 0, 0, Rome)
+	tests := []struct {
+		name   string
+		origin time.Time
+		want   string
+	}{
+		{"origin day given", time.Date(2025, 1, 20, 0, 0, 0, 0, Rome), "2025-01-20"},
+		{"origin time given", time.Date(2025, 1, 20, 23, 50, 0, 0, Rome), "2025-01-20"},
+		{"origin time read on the station day", time.Date(2025, 1, 21, 23, 50, 0, 0, Rome), "2025-01-20"},
+		{"origin unknown", time.Time{}, "2025-01-21"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Departure{ScheduledTime: at, OriginDeparture: tt.origin}
+			if got := d.ServiceDay().Format(time.DateOnly); got != tt.want {
+				t.Errorf("ServiceDay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,38 +1,303 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Train struct {
-	Number        string
-	Category      string
-	Origin        string
-	Destination   string
-	DepartureTime time.Time
-	ArrivalTime   time.Time
-	Delay         int
-	Status        TrainStatus
-	Stops         []Stop
-	LastUpdate    time.Time
+	Number   string `json:"number"`
+	Category string `json:"category"`
+	Origin   string `json:"origin"`
+	// OriginCode is the station code of Origin, when the provider has one
+	OriginCode    string      `json:"origin_code,omitempty"`
+	Destination   string      `json:"destination"`
+	DepartureTime time.Time   `json:"departure_time,omitzero"`
+	ArrivalTime   time.Time   `json:"arrival_time,omitzero"`
+	Delay         int         `json:"delay"`
+	Status        TrainStatus `json:"status"`
+	Stops         []Stop      `json:"stops"`
+	LastUpdate    time.Time   `json:"last_update,omitzero"`
+	// LastStation is the station the train was last detected at, when the
+	// provider reports it
+	LastStation string `json:"last_station,omitempty"`
+	// Source is the provider that supplied the train-level fields
+	Source string `json:"source"`
+}
+
+// Ref identifies the run of the train
+func (t *Train) Ref() TrainRef {
+	return TrainRef{Number: t.Number, OriginCode: t.OriginCode, Origin: t.Origin, Date: t.ServiceDay()}
 }
 
+// ServiceDay is the day the train left, or is due to leave, its origin. It
+// is zero when the provider gave no departure time.
+func (t *Train) ServiceDay() time.Time {
+	dep := t.DepartureTime
+	if dep.IsZero() && len(t.Stops) > 0 {
+		dep = t.Stops[0].ScheduledDepart
+	}
+	if dep.IsZero() {
+		return time.Time{}
+	}
+	return ServiceDay(dep)
+}
+
+// TrainRef identifies a single run of a train. A number alone is not enough:
+// different trains can share it on the same day, leaving from different
+// origins.
+type TrainRef struct {
+	Number string `json:"number"`
+	// OriginCode is the origin station code; empty means any origin
+	OriginCode string `json:"origin_code,omitempty"`
+	// Origin is the origin station name, for display only
+	Origin string `json:"origin,omitempty"`
+	// Date is the service day, the day the train leaves its origin; zero
+	// means today. Only its calendar date is used.
+	Date time.Time `json:"date,omitzero"`
+}
+
+// String formats the ref as NUMBER[/ORIGIN[/YYYY-MM-DD]], the form accepted
+// by ParseTrainRef
+func (r TrainRef) String() string {
+	s := r.Number
+	if r.OriginCode != "" || !r.Date.IsZero() {
+		s += "/" + r.OriginCode
+	}
+	if !r.Date.IsZero() {
+		s += "/" + r.Date.Format(time.DateOnly)
+	}
+	return s
+}
+
+// ParseTrainRef parses NUMBER, NUMBER/ORIGIN or NUMBER/ORIGIN/YYYY-MM-DD,
+// where ORIGIN may be empty to give only a date
+func ParseTrainRef(s string) (TrainRef, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return TrainRef{}, fmt.Errorf("invalid train %q: want NUMBER[/ORIGIN[/YYYY-MM-DD]]", s)
+	}
+
+	ref := TrainRef{Number: parts[0]}
+	if len(parts) > 1 {
+		ref.OriginCode = strings.ToUpper(parts[1])
+	}
+	if len(parts) > 2 {
+		date, err := time.Parse(time.DateOnly, parts[2])
+		if err != nil {
+			return TrainRef{}, fmt.Errorf("invalid train %q: date must be YYYY-MM-DD", s)
+		}
+		ref.Date = date
+	}
+	return ref, nil
+}
+
+// ParseDate parses a departure day given as YYYY-MM-DD or as today,
+// yesterday or tomorrow relative to now in Rome. The result is a day as
+// ServiceDay returns it; an empty string gives the zero time.
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	today := ServiceDay(now)
+
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return time.Time{}, nil
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+
+	date, err := time.Parse(time.DateOnly, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: want YYYY-MM-DD, today, yesterday or tomorrow", s)
+	}
+	return date, nil
+}
+
+// TrainStatus is where a train stands on its journey, or how it departs or
+// arrives on a station board
 type TrainStatus string
 
 const (
-	TrainStatusOnTime    TrainStatus = "on_time"
-	TrainStatusDelayed   TrainStatus = "delayed"
+	// TrainStatusNotDeparted is a train that has not left its origin yet
+	TrainStatusNotDeparted TrainStatus = "not_departed"
+	// TrainStatusRunning is a train on its way and on time
+	TrainStatusRunning TrainStatus = "running"
+	// TrainStatusOnTime is a board entry, or a train whose progress is not
+	// known, that is on time
+	TrainStatusOnTime TrainStatus = "on_time"
+	// TrainStatusDelayed is running, or due, more than OnTimeThreshold late
+	TrainStatusDelayed TrainStatus = "delayed"
+	// TrainStatusArrived is a train that reached its destination
+	TrainStatusArrived TrainStatus = "arrived"
+	// TrainStatusPartiallyCancelled runs on part of its route only
+	TrainStatusPartiallyCancelled TrainStatus = "partially_cancelled"
+	// TrainStatusCancelled does not run at all
 	TrainStatusCancelled TrainStatus = "cancelled"
-	TrainStatusUnknown   TrainStatus = "unknown"
+	// TrainStatusRerouted runs on another route than planned, skipping
+	// some of its stops
+	TrainStatusRerouted TrainStatus = "rerouted"
+	TrainStatusUnknown  TrainStatus = "unknown"
 )
 
+// OnTimeThreshold is the delay, in minutes, up to which a train is on time
+// unless the punctuality policy says otherwise. Providers use it for live
+// statuses, which WithThreshold adjusts to the policy.
+const OnTimeThreshold = 5
+
+// Cancelled reports whether the train, or part of it, does not run
+func (s TrainStatus) Cancelled() bool {
+	return s == TrainStatusCancelled || s == TrainStatusPartiallyCancelled
+}
+
+// Disrupted reports whether the train departs from its planned service:
+// cancelled in full or in part, or rerouted
+func (s TrainStatus) Disrupted() bool {
+	return s.Cancelled() || s == TrainStatusRerouted
+}
+
+// Label is the status in words, for people
+func (s TrainStatus) Label() string {
+	switch s {
+	case TrainStatusNotDeparted:
+		return "Not departed"
+	case TrainStatusRunning:
+		return "Running"
+	case TrainStatusOnTime:
+		return "On time"
+	case TrainStatusDelayed:
+		return "Delayed"
+	case TrainStatusArrived:
+		return "Arrived"
+	case TrainStatusPartiallyCancelled:
+		return "Partially cancelled"
+	case TrainStatusCancelled:
+		return "Cancelled"
+	case TrainStatusRerouted:
+		return "Rerouted"
+	default:
+		return "Unknown"
+	}
+}
+
+// ProgressStatus is the status of a train running as planned: whether it has
+// left its origin, reached its destination, and how late it is. Providers
+// check for cancellations and reroutes first.
+func ProgressStatus(departed, arrived bool, delay int) TrainStatus {
+	switch {
+	case arrived:
+		return TrainStatusArrived
+	case !departed:
+		return TrainStatusNotDeparted
+	case delay > OnTimeThreshold:
+		return TrainStatusDelayed
+	default:
+		return TrainStatusRunning
+	}
+}
+
+// WithThreshold re-derives a delayed status, worked out by providers with
+// OnTimeThreshold, for another on-time threshold. A train on time but more
+// than threshold late becomes delayed. One delayed by OnTimeThreshold yet
+// within threshold gets onTime back: running for a train, on_time for a
+// board entry. Delays reported by the provider itself are kept.
+func (s TrainStatus) WithThreshold(delay, threshold int, onTime TrainStatus) TrainStatus {
+	switch s {
+	case TrainStatusRunning, TrainStatusOnTime, TrainStatusUnknown:
+		if delay > threshold {
+			return TrainStatusDelayed
+		}
+	case TrainStatusDelayed:
+		if delay > OnTimeThreshold && delay <= threshold {
+			return onTime
+		}
+	}
+	return s
+}
+
+// Departed reports whether the train has left its origin, judging by the
+// actual times of its stops
+func (t *Train) Departed() bool {
+	for _, s := range t.Stops {
+		if !s.ActualDepart.IsZero() || !s.ActualArrival.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// Arrived reports whether the train has reached its destination, judging by
+// the actual arrival at its last stop
+func (t *Train) Arrived() bool {
+	return len(t.Stops) > 0 && !t.Stops[len(t.Stops)-1].ActualArrival.IsZero()
+}
+
+// Completeness is how far along a run was when it was recorded, telling a
+// final delay from a provisional one
+type Completeness string
+
+const (
+	CompletenessNotDeparted Completeness = "not_departed"
+	CompletenessEnRoute     Completeness = "en_route"
+	// CompletenessArrived is a run that reached the last stop it serves, or
+	// was cancelled: its delay will not change any more
+	CompletenessArrived Completeness = "arrived"
+)
+
+// Final reports whether a record holds the run's final delay. Records older
+// than completeness tracking have none and are taken as final.
+func (c Completeness) Final() bool {
+	return c == CompletenessArrived || c == ""
+}
+
+// Completeness works out from the stop list whether the train has left its
+// origin and reached the last stop it still serves
+func (t *Train) Completeness() Completeness {
+	switch t.Status {
+	case TrainStatusArrived, TrainStatusCancelled:
+		return CompletenessArrived
+	}
+	for i := len(t.Stops) - 1; i >= 0; i-- {
+		if !t.Stops[i].Cancelled {
+			if !t.Stops[i].ActualArrival.IsZero() {
+				return CompletenessArrived
+			}
+			break
+		}
+	}
+	if t.Departed() {
+		return CompletenessEnRoute
+	}
+	return CompletenessNotDeparted
+}
+
 type Stop struct {
-	StationCode       string
-	StationName       string
-	ScheduledArrival  time.Time
-	ActualArrival     time.Time
-	ScheduledDepart   time.Time
-	ActualDepart      time.Time
-	ArrivalDelay      int
-	DepartureDelay    int
-	Platform          string
-	PlatformConfirmed bool
+	StationCode       string    `json:"station_code"`
+	StationName       string    `json:"station_name"`
+	ScheduledArrival  time.Time `json:"scheduled_arrival,omitzero"`
+	ActualArrival     time.Time `json:"actual_arrival,omitzero"`
+	ScheduledDepart   time.Time `json:"scheduled_departure,omitzero"`
+	ActualDepart      time.Time `json:"actual_departure,omitzero"`
+	ArrivalDelay      int       `json:"arrival_delay"`
+	DepartureDelay    int       `json:"departure_delay"`
+	Platform          string    `json:"platform"`
+	PlatformConfirmed bool      `json:"platform_confirmed"`
+	// ScheduledPlatform is the timetabled platform, which Platform replaces
+	// once the actual one is announced
+	ScheduledPlatform string `json:"scheduled_platform"`
+	// Source is the provider that supplied the actual times and delays
+	Source string `json:"source"`
+	// PlatformSource is the provider that supplied the platform
+	PlatformSource string `json:"platform_source"`
+	// Cancelled is set when the train no longer calls at the stop
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+// PlatformChanged reports whether the train was moved to another platform
+// than the timetabled one
+func (s Stop) PlatformChanged() bool {
+	return s.PlatformConfirmed && s.ScheduledPlatform != "" && s.Platform != s.ScheduledPlatform
 }
@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTrainRef(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"9311", "9311", false},
+		{"2345/S00219", "2345/S00219", false},
+		{"2345/s00219", "2345/S00219", false},
+		{"2345/S00219/2025-01-20", "2345/S00219/2025-01-20", false},
+		{"2345//2025-01-20", "2345//2025-01-20", false},
+		{"2345/S00219/20-01-2025", "", true},
+		{"/S00219", "", true},
+		{"1/2/3/4", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			ref, err := ParseTrainRef(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTrainRef failed: %v", err)
+			}
+			if got := ref.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	// Still the 20th in UTC, already the 21st in Rome
+	now := time.Date(2025, 1, 20, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"2025-01-05", "2025-01-05", false},
+		{"today", "2025-01-21", false},
+		{"Yesterday", "2025-01-20", false},
+		{"tomorrow", "2025-01-22", false},
+		{"05/01/2025", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDate(tt.in, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDate failed: %v", err)
+			}
+			if s := got.Format(time.DateOnly); s != tt.want {
+				t.Errorf("ParseDate(%q) = %s, want %s", tt.in, s, tt.want)
+			}
+		})
+	}
+
+	if got, err := ParseDate("", now); err != nil || !got.IsZero() {
+		t.Errorf("ParseDate(\"\") = %v, %v, want the zero time", got, err)
+	}
+}
+
+func TestTrainCompleteness(t *testing.T) {
+	at := time.Date(2025, 1, 20, 8, 0, 0, 0, Rome)
+	tests := []struct {
+		name   string
+		status TrainStatus
+		stops  []Stop
+		want   Completeness
+	}{
+		{"not departed", TrainStatusNotDeparted, []Stop{{}, {}}, CompletenessNotDeparted},
+		{"en route", TrainStatusRunning, []Stop{{ActualDepart: at}, {}}, CompletenessEnRoute},
+		{"arrived", TrainStatusRunning, []Stop{{ActualDepart: at}, {ActualArrival: at}}, CompletenessArrived},
+		{"last stop cancelled", TrainStatusPartiallyCancelled, []Stop{{ActualDepart: at}, {ActualArrival: at}, {Cancelled: true}}, CompletenessArrived},
+		{"cancelled", TrainStatusCancelled, []Stop{{}, {}}, CompletenessArrived},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			train := &Train{Status: tt.status, Stops: tt.stops}
+			if got := train.Completeness(); got != tt.want {
+				t.Errorf("Completeness() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusWithThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    TrainStatus
+		delay     int
+		threshold int
+		want      TrainStatus
+	}{
+		{"late past a looser threshold", TrainStatusDelayed, 20, 15, TrainStatusDelayed},
+		{"late within a looser threshold", TrainStatusDelayed, 10, 15, TrainStatusRunning},
+		{"late past a stricter threshold", TrainStatusRunning, 4, 3, TrainStatusDelayed},
+		{"reported late by the provider", TrainStatusDelayed, 2, 15, TrainStatusDelayed},
+		{"not departed", TrainStatusNotDeparted, 10, 3, TrainStatusNotDeparted},
+		{"cancelled", TrainStatusCancelled, 10, 15, TrainStatusCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.WithThreshold(tt.delay, tt.threshold, TrainStatusRunning); got != tt.want {
+				t.Errorf("WithThreshold(%d, %d) = %q, want %q", tt.delay, tt.threshold, got, tt.want)
+			}
+		})
+	}
+}
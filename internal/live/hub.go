@@ -0,0 +1,168 @@
+// Package live shares upstream polling between every client watching the
+// same station or train: each topic is fetched once per interval while it has
+// subscribers, and only changed results are pushed to them.
+package live
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Fetcher loads the current value of a topic. It outlives the request that
+// subscribed first, so it must not capture a request context.
+type Fetcher func(ctx context.Context) (any, error)
+
+// Update carries a topic's value after it changed
+type Update struct {
+	Key   string
+	Value any
+	Time  time.Time
+}
+
+// Hub polls subscribed topics and fans their changes out
+type Hub struct {
+	interval time.Duration
+
+	mu     sync.Mutex
+	topics map[string]*topic
+}
+
+type topic struct {
+	key      string
+	fetch    Fetcher
+	subs     map[*Subscription]struct{}
+	last     *Update
+	lastJSON []byte
+	cancel   context.CancelFunc
+}
+
+// Subscription receives a topic's updates on C until Close is called. A
+// subscriber that falls behind only sees the latest value.
+type Subscription struct {
+	C <-chan Update
+
+	ch  chan Update
+	hub *Hub
+	key string
+}
+
+func NewHub(interval time.Duration) *Hub {
+	return &Hub{
+		interval: interval,
+		topics:   make(map[string]*topic),
+	}
+}
+
+// Subscribe starts watching key, polling it with fetch if nobody else is.
+// The current value, when known, is delivered straight away.
+func (h *Hub) Subscribe(key string, fetch Fetcher) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.topics[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		t = &topic{key: key, fetch: fetch, subs: make(map[*Subscription]struct{}), cancel: cancel}
+		h.topics[key] = t
+		go h.run(ctx, t)
+	}
+
+	ch := make(chan Update, 1)
+	sub := &Subscription{C: ch, ch: ch, hub: h, key: key}
+	t.subs[sub] = struct{}{}
+	if t.last != nil {
+		sub.offer(*t.last)
+	}
+	return sub
+}
+
+// Close stops the subscription; the topic stops polling with its last
+// subscriber
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.topics[s.key]
+	if !ok {
+		return
+	}
+	if _, ok := t.subs[s]; !ok {
+		return
+	}
+	delete(t.subs, s)
+	close(s.ch)
+
+	if len(t.subs) == 0 {
+		t.cancel()
+		delete(h.topics, s.key)
+	}
+}
+
+// offer replaces any undelivered update with u. Callers hold the hub lock, so
+// there is a single sender and the send never blocks.
+func (s *Subscription) offer(u Update) {
+	select {
+	case <-s.ch:
+	default:
+	}
+	s.ch <- u
+}
+
+// Watching returns the number of topics being polled
+func (h *Hub) Watching() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.topics)
+}
+
+func (h *Hub) run(ctx context.Context, t *topic) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.poll(ctx, t)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches the topic and publishes the result if it differs from the
+// previous one
+func (h *Hub) poll(ctx context.Context, t *topic) {
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	v, err := t.fetch(reqCtx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("live: fetch %s: %v", t.key, err)
+		}
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("live: encode %s: %v", t.key, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if bytes.Equal(data, t.lastJSON) {
+		return
+	}
+	u := Update{Key: t.key, Value: v, Time: time.Now()}
+	t.last = &u
+	t.lastJSON = data
+	for sub := range t.subs {
+		sub.offer(u)
+	}
+}
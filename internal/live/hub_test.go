@@ -0,0 +1,106 @@
+package live
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type counter struct {
+	calls atomic.Int32
+	value atomic.Int32
+}
+
+func (c *counter) fetch(ctx context.Context) (any, error) {
+	c.calls.Add(1)
+	return map[string]int32{"value": c.value.Load()}, nil
+}
+
+func receive(t *testing.T, sub *Subscription) Update {
+	t.Helper()
+	select {
+	case u := <-sub.C:
+		return u
+	case <-time.After(time.Second):
+		t.Fatal("no update received")
+		return Update{}
+	}
+}
+
+func TestHubFansOutOneFetch(t *testing.T) {
+	hub := NewHub(10 * time.Millisecond)
+	src := &counter{}
+	start := time.Now()
+
+	subs := make([]*Subscription, 50)
+	for i := range subs {
+		subs[i] = hub.Subscribe("station:S01700", src.fetch)
+	}
+	for _, s := range subs {
+		receive(t, s)
+	}
+
+	// Unchanged results are polled but not pushed
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case u := <-subs[0].C:
+		t.Fatalf("unexpected update without a change: %+v", u)
+	default:
+	}
+
+	src.value.Store(1)
+	for _, s := range subs {
+		u := receive(t, s)
+		if u.Value.(map[string]int32)["value"] != 1 {
+			t.Errorf("got %v, want the changed value", u.Value)
+		}
+	}
+
+	// One poller for fifty subscribers
+	calls := src.calls.Load()
+	if polls := int32(time.Since(start)/(10*time.Millisecond)) + 2; calls > polls {
+		t.Errorf("fetched %d times, want one fetch per interval", calls)
+	}
+	if hub.Watching() != 1 {
+		t.Errorf("watching %d topics, want 1", hub.Watching())
+	}
+
+	for _, s := range subs {
+		s.Close()
+	}
+	if hub.Watching() != 0 {
+		t.Error("topic still polled after the last subscriber left")
+	}
+}
+
+func TestHubLateSubscriberGetsCurrentValue(t *testing.T) {
+	hub := NewHub(time.Hour)
+	src := &counter{}
+
+	first := hub.Subscribe("train:9311", src.fetch)
+	defer first.Close()
+	receive(t, first)
+
+	late := hub.Subscribe("train:9311", src.fetch)
+	defer late.Close()
+	receive(t, late)
+
+	if src.calls.Load() != 1 {
+		t.Errorf("fetched %d times, want 1", src.calls.Load())
+	}
+}
+
+func TestSubscriptionCloseIsIdempotent(t *testing.T) {
+	hub := NewHub(time.Hour)
+	sub := hub.Subscribe("train:1", (&counter{}).fetch)
+	sub.Close()
+	sub.Close()
+
+	if _, ok := <-sub.C; ok {
+		// drain the initial value if it raced the close
+		if _, ok := <-sub.C; ok {
+			t.Error("channel still open after Close")
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package punctuality decides up to how many minutes late a train still
+// counts as on time. Trenitalia holds long-distance trains to a looser
+// standard than regional ones, so the threshold depends on the train
+// category, and optionally on the data provider.
+//
+// The built-in policy counts Frecce, Intercity and other long-distance trains
+// as on time up to 15 minutes late and every other train up to 5. The JSON
+// file named by TRENI_PUNCTUALITY adjusts it:
+//
+//	{
+//	  "default": 5,
+//	  "categories": {"FR": 15, "REG": 3},
+//	  "providers": {"trenord": 5}
+//	}
+//
+// Providers are the data sources a train is read from, such as viaggiatreno
+// or trenord, not the railway undertaking running it: no provider reports
+// that. A category threshold wins over a provider one, which wins over the
+// default.
+//
+// The policy applies to recorded history, statistics, rankings and history
+// listings, and to the delayed status of live trains and board entries.
+package punctuality
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+// Categories of long-distance trains, punctual within 15 minutes by default
+var longDistance = []string{"FR", "FA", "FB", "IC", "ICN", "EC", "EN", "ES"}
+
+// Policy holds the on-time thresholds, in minutes
+type Policy struct {
+	// Default applies to trains no other threshold matches
+	Default int `json:"default"`
+	// Categories are keyed by train category, such as FR
+	Categories map[string]int `json:"categories,omitempty"`
+	// Providers are keyed by data provider, such as trenord
+	Providers map[string]int `json:"providers,omitempty"`
+}
+
+// Default is the built-in policy
+func Default() Policy {
+	p := Policy{
+		Default:    domain.OnTimeThreshold,
+		Categories: make(map[string]int, len(longDistance)),
+		Providers:  map[string]int{},
+	}
+	for _, c := range longDistance {
+		p.Categories[c] = 15
+	}
+	return p
+}
+
+// FromEnv loads the file named by TRENI_PUNCTUALITY, returning the built-in
+// policy when it is unset
+func FromEnv() (Policy, error) {
+	path := os.Getenv("TRENI_PUNCTUALITY")
+	if path == "" {
+		return Default(), nil
+	}
+	return Load(path)
+}
+
+// Load reads a policy file over the built-in policy: the thresholds it sets
+// replace the built-in ones, the others are kept
+func Load(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("read punctuality policy: %w", err)
+	}
+
+	var file struct {
+		Default    *int           `json:"default"`
+		Categories map[string]int `json:"categories"`
+		Providers  map[string]int `json:"providers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Policy{}, fmt.Errorf("parse punctuality policy %s: %w", path, err)
+	}
+
+	p := Default()
+	if file.Default != nil {
+		p.Default = *file.Default
+	}
+	for c, minutes := range file.Categories {
+		p.Categories[strings.ToUpper(c)] = minutes
+	}
+	for name, minutes := range file.Providers {
+		p.Providers[strings.ToLower(name)] = minutes
+	}
+	if err := p.validate(); err != nil {
+		return Policy{}, fmt.Errorf("punctuality policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p Policy) validate() error {
+	if p.Default < 0 {
+		return fmt.Errorf("negative default threshold %d", p.Default)
+	}
+	for c, minutes := range p.Categories {
+		if minutes < 0 {
+			return fmt.Errorf("negative threshold %d for category %s", minutes, c)
+		}
+	}
+	for name, minutes := range p.Providers {
+		if minutes < 0 {
+			return fmt.Errorf("negative threshold %d for provider %s", minutes, name)
+		}
+	}
+	return nil
+}
+
+// Threshold is the delay, in minutes, up to which a train of the category
+// read from the provider is on time
+func (p Policy) Threshold(category, provider string) int {
+	if minutes, ok := p.Categories[strings.ToUpper(category)]; ok {
+		return minutes
+	}
+	if minutes, ok := p.Providers[strings.ToLower(provider)]; ok {
+		return minutes
+	}
+	return p.Default
+}
+
+// OnTime reports whether a train of the category read from the provider is
+// on time with the delay
+func (p Policy) OnTime(category, provider string, delay int) bool {
+	return delay <= p.Threshold(category, provider)
+}
+
+// TrainStatus is the status of a live train by the policy: the provider's,
+// with the train judged delayed by its own threshold
+func (p Policy) TrainStatus(train *domain.Train) domain.TrainStatus {
+	return train.Status.WithThreshold(train.Delay, p.Threshold(train.Category, train.Source), domain.TrainStatusRunning)
+}
+
+// BoardStatus is the status of a board entry by the policy, as TrainStatus
+func (p Policy) BoardStatus(status domain.TrainStatus, delay int, category, provider string) domain.TrainStatus {
+	return status.WithThreshold(delay, p.Threshold(category, provider), domain.TrainStatusOnTime)
+}
@@ -0,0 +1,50 @@
+package punctuality
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "punctuality.json")
+	data := `{"default": 4, "categories": {"reg": 3}, "providers": {"Trenord": 6}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	tests := []struct {
+		category, provider string
+		want               int
+	}{
+		{"FR", "viaggiatreno", 15}, // built in
+		{"REG", "viaggiatreno", 3},
+		{"REG", "trenord", 3}, // the category wins
+		{"S", "trenord", 6},
+		{"RV", "viaggiatreno", 4},
+		{"", "", 4},
+	}
+	for _, tt := range tests {
+		if got := p.Threshold(tt.category, tt.provider); got != tt.want {
+			t.Errorf("Threshold(%q, %q) = %d, want %d", tt.category, tt.provider, got, tt.want)
+		}
+	}
+
+	if !p.OnTime("FR", "", 15) || p.OnTime("FR", "", 16) {
+		t.Error("FR should be on time up to 15 minutes late")
+	}
+}
+
+func TestLoadRejectsNegativeThresholds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "punctuality.json")
+	if err := os.WriteFile(path, []byte(`{"categories": {"FR": -1}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected an error for a negative threshold")
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/storage/sqlc"
+)
+
+// Board kinds, as stored in board_observations
+const (
+	boardDeparture = "departure"
+	boardArrival   = "arrival"
+)
+
+// RecordBoard stores every train on the station's departure and arrival
+// boards as seen at observedAt. A train already seen on the same board is
+// updated, so the latest snapshot wins.
+func (s *Service) RecordBoard(ctx context.Context, station *domain.Station, observedAt time.Time) error {
+	if s.queries == nil {
+		return nil
+	}
+
+	base := sqlc.InsertBoardObservationParams{
+		StationCode: station.Code,
+		StationName: station.Name,
+		Source:      sql.NullString{String: station.Source, Valid: station.Source != ""},
+		ObservedAt:  observedAt,
+	}
+
+	for _, d := range station.Departures {
+		if d.ScheduledTime.IsZero() {
+			continue
+		}
+		p := base
+		p.TrainNumber = d.TrainNumber
+		p.OriginCode = d.OriginCode
+		p.TrainCategory = sql.NullString{String: d.TrainCategory, Valid: d.TrainCategory != ""}
+		p.Kind = boardDeparture
+		p.Destination = sql.NullString{String: d.Destination, Valid: d.Destination != ""}
+		p.Date = d.ServiceDay()
+		p.ScheduledTime = d.ScheduledTime
+		p.Delay = int64(d.Delay)
+		p.Platform = sql.NullString{String: d.Platform, Valid: d.Platform != ""}
+		p.ScheduledPlatform = sql.NullString{String: d.ScheduledPlatform, Valid: d.ScheduledPlatform != ""}
+		p.Status = string(s.punctuality.BoardStatus(d.Status, d.Delay, d.TrainCategory, station.Source))
+		if err := s.queries.InsertBoardObservation(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range station.Arrivals {
+		if a.ScheduledTime.IsZero() {
+			continue
+		}
+		p := base
+		p.TrainNumber = a.TrainNumber
+		p.OriginCode = a.OriginCode
+		p.TrainCategory = sql.NullString{String: a.TrainCategory, Valid: a.TrainCategory != ""}
+		p.Kind = boardArrival
+		p.Origin = sql.NullString{String: a.Origin, Valid: a.Origin != ""}
+		p.Date = a.ServiceDay()
+		p.ScheduledTime = a.ScheduledTime
+		p.Delay = int64(a.Delay)
+		p.Platform = sql.NullString{String: a.Platform, Valid: a.Platform != ""}
+		p.ScheduledPlatform = sql.NullString{String: a.ScheduledPlatform, Valid: a.ScheduledPlatform != ""}
+		p.Status = string(s.punctuality.BoardStatus(a.Status, a.Delay, a.TrainCategory, station.Source))
+		if err := s.queries.InsertBoardObservation(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// observedRuns returns the runs of a train known only from station boards,
+// as delay records
+func (s *Service) observedRuns(ctx context.Context, ref domain.TrainRef) ([]domain.DelayRecord, error) {
+	runs, err := s.queries.GetObservedRunsByTrain(ctx, sqlc.GetObservedRunsByTrainParams{
+		TrainNumber: ref.Number,
+		OriginCode:  ref.OriginCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]domain.DelayRecord, len(runs))
+	for i, r := range runs {
+		status := domain.TrainStatus(r.Status)
+		result[i] = domain.DelayRecord{
+			TrainNumber:   r.TrainNumber,
+			OriginCode:    r.OriginCode,
+			TrainCategory: nullString(r.TrainCategory),
+			Origin:        r.Origin,
+			Destination:   r.Destination,
+			Date:          r.Date,
+			Delay:         int(r.Delay),
+			Cancelled:     status == domain.TrainStatusCancelled,
+			Source:        nullString(r.Source),
+			RecordedAt:    r.ObservedAt.In(domain.Rome),
+			Status:        status,
+			Observed:      true,
+			Completeness:  domain.Completeness(r.Completeness),
+		}
+	}
+	return result, nil
+}
+
+// mergeHistory adds the observed runs to the recorded ones, newest first
+func mergeHistory(records, observed []domain.DelayRecord) []domain.DelayRecord {
+	if len(observed) == 0 {
+		return records
+	}
+	merged := append(records, observed...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Date.After(merged[j].Date)
+	})
+	return merged
+}
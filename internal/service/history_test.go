@@ -0,0 +1,457 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/punctuality"
+)
+
+func TestGetPlatformUsage(t *testing.T) {
+	svc := New(nil, newTestDB(t))
+	ctx := context.Background()
+
+	// Timetabled at platform 12, moved to 14 on one of three days
+	for i, platform := range []string{"12", "14", "12"} {
+		train := &domain.Train{
+			Number: "9311",
+			Origin: "ROMA TERMINI",
+			Stops: []domain.Stop{{
+				StationCode:       "S01700",
+				StationName:       "MILANO CENTRALE",
+				Platform:          platform,
+				PlatformConfirmed: true,
+				ScheduledPlatform: "12",
+			}},
+			Source: "test",
+		}
+		date := time.Date(2025, 1, 20+i, 0, 0, 0, 0, time.UTC)
+		if err := svc.RecordTrain(ctx, train, date); err != nil {
+			t.Fatalf("RecordTrain failed: %v", err)
+		}
+	}
+
+	usage, err := svc.GetPlatformUsage(ctx, domain.TrainRef{Number: "9311"}, "S01700")
+	if err != nil {
+		t.Fatalf("GetPlatformUsage failed: %v", err)
+	}
+	if len(usage) != 2 {
+		t.Fatalf("got %d platforms, want 2: %+v", len(usage), usage)
+	}
+	if u := usage[0]; u.Platform != "12" || u.Uses != 2 || u.Changes != 0 {
+		t.Errorf("most used = %+v, want platform 12 twice", u)
+	}
+	if u := usage[1]; u.Platform != "14" || u.Uses != 1 || u.Changes != 1 {
+		t.Errorf("second = %+v, want platform 14 once, as a change", u)
+	}
+
+	history, err := svc.GetStopHistory(ctx, domain.TrainRef{Number: "9311"}, "S01700")
+	if err != nil {
+		t.Fatalf("GetStopHistory failed: %v", err)
+	}
+	if len(history) != 3 || history[1].ScheduledPlatform != "12" || history[1].Platform != "14" {
+		t.Errorf("unexpected stop history: %+v", history)
+	}
+}
+
+func TestRecordTrainKeepsStopSources(t *testing.T) {
+	svc := New(nil, newTestDB(t))
+	ctx := context.Background()
+
+	// Times from Trenord merged into a ViaggiaTreno train, platform from both
+	train := &domain.Train{
+		Number:     "2647",
+		OriginCode: "S01700",
+		Stops: []domain.Stop{
+			{StationCode: "S01700", StationName: "MILANO CENTRALE", Platform: "21", Source: "viaggiatreno", PlatformSource: "viaggiatreno"},
+			{StationCode: "S01520", StationName: "LECCO", Platform: "2", Source: "trenord", PlatformSource: "trenord"},
+		},
+		Source: "viaggiatreno",
+	}
+	date := time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)
+	if err := svc.RecordTrain(ctx, train, date); err != nil {
+		t.Fatalf("RecordTrain failed: %v", err)
+	}
+
+	history, err := svc.GetStopHistory(ctx, domain.TrainRef{Number: "2647"}, "S01520")
+	if err != nil {
+		t.Fatalf("GetStopHistory failed: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d stop records, want 1", len(history))
+	}
+	if r := history[0]; r.Source != "viaggiatreno" || r.StopSource != "trenord" || r.PlatformSource != "trenord" {
+		t.Errorf("sources = %q, %q, %q, want the run from viaggiatreno and the stop from trenord",
+			r.Source, r.StopSource, r.PlatformSource)
+	}
+}
+
+func TestGetDelayTimeline(t *testing.T) {
+	svc := New(nil, newTestDB(t))
+	ctx := context.Background()
+
+	date := time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)
+	departure := time.Date(2025, 1, 20, 10, 0, 0, 0, domain.Rome)
+	train := &domain.Train{
+		Number:     "2345",
+		OriginCode: "S01700",
+		Stops: []domain.Stop{
+			{StationName: "MILANO CENTRALE", ScheduledDepart: departure},
+			{StationName: "BRESCIA", ScheduledArrival: departure.Add(time.Hour)},
+		},
+		Source: "test",
+	}
+
+	// Polled late first, then on time before departure: stored by time
+	train.Delay = 7
+	train.Stops[0].ActualDepart = departure.Add(7 * time.Minute)
+	if err := svc.ObserveTrain(ctx, train, date, departure.Add(20*time.Minute)); err != nil {
+		t.Fatalf("ObserveTrain failed: %v", err)
+	}
+	train.Delay = 0
+	train.Stops[0].ActualDepart = time.Time{}
+	if err := svc.ObserveTrain(ctx, train, date, departure.Add(-5*time.Minute)); err != nil {
+		t.Fatalf("ObserveTrain failed: %v", err)
+	}
+
+	timeline, err := svc.GetDelayTimeline(ctx, domain.TrainRef{Number: "2345", Date: date})
+	if err != nil {
+		t.Fatalf("GetDelayTimeline failed: %v", err)
+	}
+	if len(timeline) != 2 {
+		t.Fatalf("got %d observations, want 2", len(timeline))
+	}
+	if o := timeline[0]; o.Delay != 0 || o.LastStation != "" {
+		t.Errorf("first = %+v, want on time before departure", o)
+	}
+	if o := timeline[1]; o.Delay != 7 || o.LastStation != "MILANO CENTRALE" {
+		t.Errorf("second = %+v, want 7 minutes late after leaving", o)
+	}
+
+	other, err := svc.GetDelayTimeline(ctx, domain.TrainRef{Number: "2345", OriginCode: "S01645", Date: date})
+	if err != nil {
+		t.Fatalf("GetDelayTimeline failed: %v", err)
+	}
+	if len(other) != 0 {
+		t.Errorf("got %d observations for another origin, want 0", len(other))
+	}
+}
+
+func TestFinalizeRecords(t *testing.T) {
+	date := time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)
+	departure := time.Date(2025, 1, 20, 8, 0, 0, 0, domain.Rome)
+	train := &domain.Train{
+		Number:     "9311",
+		OriginCode: "S08409",
+		Origin:     "ROMA TERMINI",
+		Delay:      12,
+		Stops: []domain.Stop{
+			{StationCode: "S08409", ScheduledDepart: departure, ActualDepart: departure.Add(2 * time.Minute)},
+			{StationCode: "S01700", ScheduledArrival: departure.Add(3 * time.Hour)},
+		},
+		Source: "test",
+	}
+	client := &fakeBoardClient{trains: map[string]*domain.Train{"9311": train}}
+	svc := New(client, newTestDB(t))
+	ctx := context.Background()
+
+	// Recorded mid-route: kept out of the statistics
+	if err := svc.RecordTrain(ctx, train, date); err != nil {
+		t.Fatalf("RecordTrain failed: %v", err)
+	}
+	stats, err := svc.GetTrainStats(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil {
+		t.Fatalf("GetTrainStats failed: %v", err)
+	}
+	if stats.TotalTrips != 0 || stats.ProvisionalTrips != 1 {
+		t.Errorf("stats = %+v, want only a provisional trip", stats)
+	}
+
+	if n, err := svc.FinalizeRecords(ctx, date); err != nil || n != 0 {
+		t.Errorf("FinalizeRecords = %d, %v, want nothing finalised en route", n, err)
+	}
+
+	// Answered by another provider, the provisional record is still the one
+	// finalised, once
+	train.Stops[1].ActualArrival = departure.Add(3*time.Hour + 5*time.Minute)
+	train.Delay = 5
+	train.Source = "other"
+	if n, err := svc.FinalizeRecords(ctx, date); err != nil || n != 1 {
+		t.Fatalf("FinalizeRecords = %d, %v, want 1 finalised", n, err)
+	}
+	if n, err := svc.FinalizeRecords(ctx, date); err != nil || n != 0 {
+		t.Errorf("FinalizeRecords = %d, %v, want nothing left to finalise", n, err)
+	}
+	train.Source = "test"
+
+	// A late provisional record does not undo the final one
+	train.Stops[1].ActualArrival = time.Time{}
+	train.Delay = 20
+	if written, err := svc.recordTrain(ctx, train, date); err != nil || written {
+		t.Fatalf("recordTrain = %v, %v, want the final record left alone", written, err)
+	}
+
+	history, err := svc.GetDelayHistory(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil {
+		t.Fatalf("GetDelayHistory failed: %v", err)
+	}
+	if len(history) != 1 || history[0].Delay != 5 || history[0].Source != "test" || history[0].Completeness != domain.CompletenessArrived {
+		t.Errorf("history = %+v, want the final 5 minutes", history)
+	}
+	stats, err = svc.GetTrainStats(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil {
+		t.Fatalf("GetTrainStats failed: %v", err)
+	}
+	if stats.TotalTrips != 1 || stats.ProvisionalTrips != 0 || stats.MaxDelay != 5 {
+		t.Errorf("stats = %+v, want one final trip", stats)
+	}
+	if stats.P95Delay != 5 || stats.Histogram[0].Trips != 1 {
+		t.Errorf("distribution = %+v, want the final trip only", stats)
+	}
+}
+
+func TestLateProvisionalKeepsFinalStops(t *testing.T) {
+	svc := New(nil, newTestDB(t))
+	ctx := context.Background()
+
+	date := time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)
+	departure := time.Date(2025, 1, 20, 8, 0, 0, 0, domain.Rome)
+	arrival := departure.Add(3*time.Hour + 5*time.Minute)
+	train := &domain.Train{
+		Number:     "9311",
+		OriginCode: "S08409",
+		Delay:      5,
+		Status:     domain.TrainStatusArrived,
+		Stops: []domain.Stop{
+			{StationCode: "S08409", ScheduledDepart: departure, ActualDepart: departure},
+			{StationCode: "S01700", ScheduledArrival: departure.Add(3 * time.Hour), ActualArrival: arrival, ArrivalDelay: 5, Platform: "12"},
+		},
+		Source: "test",
+	}
+	if err := svc.RecordTrain(ctx, train, date); err != nil {
+		t.Fatalf("RecordTrain failed: %v", err)
+	}
+
+	// A poll taken before the arrival, stored after it
+	late := *train
+	late.Delay = 20
+	late.Status = domain.TrainStatusRunning
+	late.Stops = []domain.Stop{
+		train.Stops[0],
+		{StationCode: "S01700", ScheduledArrival: departure.Add(3 * time.Hour), ArrivalDelay: 20, Platform: "14"},
+	}
+	if err := svc.RecordTrain(ctx, &late, date); err != nil {
+		t.Fatalf("RecordTrain failed: %v", err)
+	}
+
+	stops, err := svc.GetStopHistory(ctx, domain.TrainRef{Number: "9311"}, "S01700")
+	if err != nil {
+		t.Fatalf("GetStopHistory failed: %v", err)
+	}
+	if len(stops) != 1 || stops[0].Platform != "12" || stops[0].ArrivalDelay != 5 || !stops[0].ActualArrival.Equal(arrival) {
+		t.Errorf("stops = %+v, want the final arrival at platform 12", stops)
+	}
+	timeline, err := svc.GetDelayTimeline(ctx, domain.TrainRef{Number: "9311", OriginCode: "S08409", Date: date})
+	if err != nil {
+		t.Fatalf("GetDelayTimeline failed: %v", err)
+	}
+	if len(timeline) != 1 || timeline[0].Delay != 5 {
+		t.Errorf("timeline = %+v, want the final observation only", timeline)
+	}
+}
+
+func TestPunctualityPolicy(t *testing.T) {
+	svc := New(nil, newTestDB(t))
+	ctx := context.Background()
+
+	// Ten minutes late on each of five days: on time for a Frecciarossa,
+	// delayed for a regional train
+	for _, train := range []*domain.Train{
+		{Number: "9311", Category: "FR", Origin: "ROMA TERMINI", Destination: "MILANO CENTRALE"},
+		{Number: "2345", Category: "REG", Origin: "MILANO CENTRALE", Destination: "BRESCIA"},
+	} {
+		train.Delay = 10
+		train.Status = domain.TrainStatusArrived
+		train.Source = "trenord"
+		for i := range 5 {
+			date := domain.ServiceDay(time.Now()).AddDate(0, 0, -1-i)
+			if err := svc.RecordTrain(ctx, train, date); err != nil {
+				t.Fatalf("RecordTrain failed: %v", err)
+			}
+		}
+	}
+
+	stats, err := svc.GetTrainStats(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil {
+		t.Fatalf("GetTrainStats failed: %v", err)
+	}
+	if stats.OnTimeTrips != 5 || stats.OnTimeThreshold != 15 {
+		t.Errorf("FR stats = %+v, want on time within 15 minutes", stats)
+	}
+	stats, err = svc.GetTrainStats(ctx, domain.TrainRef{Number: "2345"})
+	if err != nil {
+		t.Fatalf("GetTrainStats failed: %v", err)
+	}
+	if stats.DelayedTrips != 5 || stats.OnTimeThreshold != 5 {
+		t.Errorf("REG stats = %+v, want delayed past 5 minutes", stats)
+	}
+
+	reliable, err := svc.GetMostReliableTrains(ctx, 30, 10)
+	if err != nil {
+		t.Fatalf("GetMostReliableTrains failed: %v", err)
+	}
+	if len(reliable) != 2 || reliable[0].TrainNumber != "9311" {
+		t.Errorf("reliable = %+v, want the FR first", reliable)
+	}
+
+	// A provider threshold covers categories the policy does not list
+	svc.SetPunctuality(punctuality.Policy{
+		Default:    5,
+		Categories: map[string]int{"FR": 3},
+		Providers:  map[string]int{"trenord": 10},
+	})
+	if stats, err := svc.GetTrainStats(ctx, domain.TrainRef{Number: "9311"}); err != nil || stats.DelayedTrips != 5 {
+		t.Errorf("FR stats = %+v, %v, want delayed past 3 minutes", stats, err)
+	}
+	if stats, err := svc.GetTrainStats(ctx, domain.TrainRef{Number: "2345"}); err != nil || stats.OnTimeTrips != 5 || stats.OnTimeThreshold != 10 {
+		t.Errorf("REG stats = %+v, %v, want on time within the provider's 10 minutes", stats, err)
+	}
+}
+
+func TestPunctualityStatuses(t *testing.T) {
+	client := &fakeBoardClient{
+		board: &domain.Station{Code: "S01700", Source: "test", Departures: []domain.Departure{
+			{TrainNumber: "9311", TrainCategory: "FR", Delay: 10, Status: domain.TrainStatusDelayed},
+			{TrainNumber: "2345", TrainCategory: "REG", Delay: 4, Status: domain.TrainStatusOnTime},
+		}},
+		trains: map[string]*domain.Train{
+			"9311": {Number: "9311", Category: "FR", Delay: 10, Status: domain.TrainStatusDelayed},
+		},
+	}
+	svc := New(client, nil)
+	svc.SetPunctuality(punctuality.Policy{Default: 5, Categories: map[string]int{"FR": 15, "REG": 3}})
+	ctx := context.Background()
+
+	// Ten minutes late is on time for a Frecciarossa, four is late for a
+	// regional train
+	result, err := svc.GetTrain(ctx, domain.TrainRef{Number: "9311"})
+	if err != nil {
+		t.Fatalf("GetTrain failed: %v", err)
+	}
+	if result.Train.Status != domain.TrainStatusRunning {
+		t.Errorf("train status = %q, want running", result.Train.Status)
+	}
+	station, err := svc.GetStation(ctx, "S01700")
+	if err != nil {
+		t.Fatalf("GetStation failed: %v", err)
+	}
+	if got := station.Departures[0].Status; got != domain.TrainStatusOnTime {
+		t.Errorf("FR departure status = %q, want on_time", got)
+	}
+	if got := station.Departures[1].Status; got != domain.TrainStatusDelayed {
+		t.Errorf("REG departure status = %q, want delayed", got)
+	}
+}
+
+func TestSharedNumberHistory(t *testing.T) {
+	svc := New(nil, newTestDB(t))
+	ctx := context.Background()
+
+	// Two trains numbered 2345 from different origins, one always on time
+	// and one always late
+	for _, train := range []*domain.Train{
+		{Number: "2345", Category: "REG", OriginCode: "S01700", Origin: "MILANO CENTRALE", Destination: "BRESCIA", Delay: 0},
+		{Number: "2345", Category: "REG", OriginCode: "S05042", Origin: "PAVIA", Destination: "MILANO CENTRALE", Delay: 20},
+	} {
+		train.Status = domain.TrainStatusArrived
+		train.Stops = []domain.Stop{{StationCode: train.OriginCode, StationName: train.Origin, Platform: "3"}}
+		train.Source = "test"
+		for i := range 3 {
+			date := domain.ServiceDay(time.Now()).AddDate(0, 0, -1-i)
+			if err := svc.RecordTrain(ctx, train, date); err != nil {
+				t.Fatalf("RecordTrain failed: %v", err)
+			}
+		}
+	}
+
+	ref := domain.TrainRef{Number: "2345", OriginCode: "S05042"}
+	stats, err := svc.GetTrainStats(ctx, ref)
+	if err != nil {
+		t.Fatalf("GetTrainStats failed: %v", err)
+	}
+	if stats.TotalTrips != 3 || stats.DelayedTrips != 3 {
+		t.Errorf("stats = %+v, want three delayed trips from Pavia", stats)
+	}
+	if stats, err := svc.GetTrainStats(ctx, domain.TrainRef{Number: "2345"}); err != nil || stats.TotalTrips != 6 {
+		t.Errorf("stats = %+v, %v, want both trains without an origin", stats, err)
+	}
+
+	history, err := svc.GetDelayHistory(ctx, ref)
+	if err != nil {
+		t.Fatalf("GetDelayHistory failed: %v", err)
+	}
+	if len(history) != 3 || history[0].OriginCode != "S05042" {
+		t.Errorf("history = %+v, want the three runs from Pavia", history)
+	}
+	if usage, err := svc.GetPlatformUsage(ctx, ref, "S01700"); err != nil || len(usage) != 0 {
+		t.Errorf("platforms = %+v, %v, want none for the train from Pavia", usage, err)
+	}
+
+	delayed, err := svc.GetMostDelayedTrains(ctx, 30, 10)
+	if err != nil {
+		t.Fatalf("GetMostDelayedTrains failed: %v", err)
+	}
+	if len(delayed) != 2 || delayed[0].OriginCode != "S05042" || delayed[0].MaxDelay != 20 {
+		t.Errorf("delayed = %+v, want the train from Pavia ranked apart", delayed)
+	}
+}
+
+func TestRecordBoardNightTrain(t *testing.T) {
+	svc := New(nil, newTestDB(t))
+	ctx := context.Background()
+
+	// The night train from the 20th, seen before and after midnight
+	left := time.Date(2025, 1, 20, 0, 0, 0, 0, domain.Rome)
+	boards := []*domain.Station{
+		{Code: "S05042", Name: "PAVIA", Departures: []domain.Departure{{
+			TrainNumber: "1911", OriginCode: "S08409", Destination: "MILANO CENTRALE",
+			ScheduledTime: time.Date(2025, 1, 20, 23, 40, 0, 0, domain.Rome), Delay: 5, OriginDeparture: left,
+		}}},
+		{Code: "S01700", Name: "MILANO CENTRALE", Arrivals: []domain.Arrival{{
+			TrainNumber: "1911", OriginCode: "S08409", Origin: "ROMA TERMINI",
+			ScheduledTime: time.Date(2025, 1, 21, 0, 30, 0, 0, domain.Rome), Delay: 8, OriginDeparture: left,
+		}}},
+	}
+	for _, b := range boards {
+		if err := svc.RecordBoard(ctx, b, time.Date(2025, 1, 21, 0, 45, 0, 0, domain.Rome)); err != nil {
+			t.Fatalf("RecordBoard failed: %v", err)
+		}
+	}
+
+	history, err := svc.GetDelayHistory(ctx, domain.TrainRef{Number: "1911"})
+	if err != nil {
+		t.Fatalf("GetDelayHistory failed: %v", err)
+	}
+	if len(history) != 1 || history[0].Delay != 8 || history[0].Date.Format(time.DateOnly) != "2025-01-20" {
+		t.Fatalf("history = %+v, want one run on the 20th", history)
+	}
+
+	// A record of another train with the number leaves the run observed,
+	// one of this train replaces it
+	date := domain.ServiceDay(left)
+	for _, origin := range []string{"S01520", "S08409"} {
+		train := &domain.Train{Number: "1911", OriginCode: origin, Delay: 9, Source: "test"}
+		if err := svc.RecordTrain(ctx, train, date); err != nil {
+			t.Fatalf("RecordTrain failed: %v", err)
+		}
+		observed, err := svc.GetDelayHistory(ctx, domain.TrainRef{Number: "1911", OriginCode: "S08409"})
+		if err != nil {
+			t.Fatalf("GetDelayHistory failed: %v", err)
+		}
+		if want := origin != "S08409"; len(observed) != 1 || observed[0].Observed != want {
+			t.Errorf("after recording the train from %s, history = %+v, want observed %v", origin, observed, want)
+		}
+	}
+}
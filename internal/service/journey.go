@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+const (
+	// How many departures from the origin board are checked for a direct
+	// connection
+	maxJourneyCandidates = 25
+	// How many GetTrain requests run at once while checking candidates
+	journeyWorkers = 5
+)
+
+// AmbiguousStationError is returned by ResolveStation when a name matches
+// several stations
+type AmbiguousStationError struct {
+	Query      string
+	Candidates []domain.Station
+}
+
+func (e *AmbiguousStationError) Error() string {
+	names := make([]string, len(e.Candidates))
+	for i, s := range e.Candidates {
+		names[i] = s.Name + " (" + s.Code + ")"
+	}
+	return fmt.Sprintf("%q matches %d stations: %s", e.Query, len(e.Candidates), strings.Join(names, ", "))
+}
+
+// ResolveStation turns a station code or name into a station. A name must
+// match exactly one station, or one station's full name.
+func (s *Service) ResolveStation(ctx context.Context, query string) (*domain.Station, error) {
+	query = strings.TrimSpace(query)
+	if IsStationCode(query) {
+		return &domain.Station{Code: query, Name: query}, nil
+	}
+
+	stations, err := s.SearchStations(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(stations) == 0 {
+		return nil, fmt.Errorf("no stations found for %q", query)
+	}
+	if len(stations) == 1 {
+		return &stations[0], nil
+	}
+	for i := range stations {
+		if strings.EqualFold(stations[i].Name, query) {
+			return &stations[i], nil
+		}
+	}
+	return nil, &AmbiguousStationError{Query: query, Candidates: stations}
+}
+
+// IsStationCode reports whether s looks like a station code (S01700) rather
+// than a name
+func IsStationCode(s string) bool {
+	if len(s) < 3 || s[0] != 'S' {
+		return false
+	}
+	for _, r := range s[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FindJourneys lists the direct trains from one station to another among the
+// next departures at the origin, ordered by departure time
+func (s *Service) FindJourneys(ctx context.Context, fromCode, toCode string, limit int) ([]domain.Journey, error) {
+	board, err := s.api.GetStation(ctx, fromCode)
+	if err != nil {
+		return nil, err
+	}
+
+	departures := board.Departures
+	if len(departures) > maxJourneyCandidates {
+		departures = departures[:maxJourneyCandidates]
+	}
+
+	var (
+		mu       sync.Mutex
+		journeys []domain.Journey
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, journeyWorkers)
+	)
+	for _, d := range departures {
+		wg.Add(1)
+		go func(ref domain.TrainRef) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// The board's origin code tells apart trains sharing a number
+			train, err := api.GetTrainRun(ctx, s.api, ref)
+			if err != nil {
+				return
+			}
+			if j, ok := journeyOn(s.withPunctuality(train), fromCode, toCode); ok {
+				mu.Lock()
+				journeys = append(journeys, j)
+				mu.Unlock()
+			}
+		}(domain.TrainRef{Number: d.TrainNumber, OriginCode: d.OriginCode})
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil && len(journeys) == 0 {
+		return nil, err
+	}
+
+	sort.Slice(journeys, func(i, j int) bool {
+		return journeys[i].From.ScheduledDepart.Before(journeys[j].From.ScheduledDepart)
+	})
+	if limit > 0 && len(journeys) > limit {
+		journeys = journeys[:limit]
+	}
+	return journeys, nil
+}
+
+// journeyOn returns the leg of the train between the two stations, if it
+// calls at both in that order
+func journeyOn(train *domain.Train, fromCode, toCode string) (domain.Journey, bool) {
+	from, to := -1, -1
+	for i, stop := range train.Stops {
+		switch {
+		case from < 0 && stop.StationCode == fromCode:
+			from = i
+		case from >= 0 && stop.StationCode == toCode:
+			to = i
+		}
+	}
+	if from < 0 || to < 0 {
+		return domain.Journey{}, false
+	}
+
+	return domain.Journey{
+		TrainNumber:   train.Number,
+		TrainCategory: train.Category,
+		Origin:        train.Origin,
+		OriginCode:    train.OriginCode,
+		Destination:   train.Destination,
+		Delay:         train.Delay,
+		Status:        train.Status,
+		From:          projectDelay(train.Stops[from], train.Delay),
+		To:            projectDelay(train.Stops[to], train.Delay),
+	}, true
+}
+
+// projectDelay carries the train's current delay onto a stop it has not
+// reached yet, whose own delays are still zero
+func projectDelay(stop domain.Stop, delay int) domain.Stop {
+	if stop.ActualArrival.IsZero() && stop.ActualDepart.IsZero() {
+		stop.ArrivalDelay = delay
+		stop.DepartureDelay = delay
+	}
+	return stop
+}
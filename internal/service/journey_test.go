@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+)
+
+type fakeBoardClient struct {
+	board  *domain.Station
+	trains map[string]*domain.Train
+}
+
+func (f *fakeBoardClient) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	t, ok := f.trains[trainNumber]
+	if !ok {
+		return nil, errors.New("unknown train")
+	}
+	return t, nil
+}
+
+func (f *fakeBoardClient) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	return f.board, nil
+}
+
+func (f *fakeBoardClient) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	return []domain.Station{
+		{Code: "S05043", Name: "FIRENZE S. M. N."},
+		{Code: "S06421", Name: "FIRENZE RIFREDI"},
+	}, nil
+}
+
+func TestFindJourneys(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2025, 1, 20, h, m, 0, 0, time.UTC) }
+	stop := func(code string, dep time.Time) domain.Stop {
+		return domain.Stop{StationCode: code, StationName: code, ScheduledArrival: dep.Add(-2 * time.Minute), ScheduledDepart: dep}
+	}
+
+	client := &fakeBoardClient{
+		board: &domain.Station{Code: "S01700", Departures: []domain.Departure{
+			{TrainNumber: "9541"}, {TrainNumber: "2647"}, {TrainNumber: "9511"}, {TrainNumber: "404"},
+		}},
+		trains: map[string]*domain.Train{
+			// Calls at Firenze, delayed and not yet departed
+			"9541": {Number: "9541", Delay: 7, Stops: []domain.Stop{stop("S01700", at(9, 15)), stop("S05043", at(10, 20))}},
+			// Never reaches Firenze
+			"2647": {Number: "2647", Stops: []domain.Stop{stop("S01700", at(8, 20)), stop("S01520", at(9, 0))}},
+			// Calls at Firenze, earlier
+			"9511": {Number: "9511", Stops: []domain.Stop{stop("S01700", at(8, 45)), stop("S05043", at(9, 50)), stop("S08409", at(11, 40))}},
+		},
+	}
+
+	journeys, err := New(client, nil).FindJourneys(context.Background(), "S01700", "S05043", 0)
+	if err != nil {
+		t.Fatalf("FindJourneys failed: %v", err)
+	}
+	if len(journeys) != 2 || journeys[0].TrainNumber != "9511" || journeys[1].TrainNumber != "9541" {
+		t.Fatalf("unexpected journeys: %+v", journeys)
+	}
+
+	j := journeys[1]
+	if j.From.StationCode != "S01700" || j.To.StationCode != "S05043" {
+		t.Errorf("unexpected leg: %s → %s", j.From.StationCode, j.To.StationCode)
+	}
+	if got := j.From.ExpectedDeparture(); !got.Equal(at(9, 22)) {
+		t.Errorf("expected departure = %v, want 09:22", got)
+	}
+}
+
+func TestFindJourneysIgnoresReverseDirection(t *testing.T) {
+	client := &fakeBoardClient{
+		board: &domain.Station{Departures: []domain.Departure{{TrainNumber: "1"}}},
+		trains: map[string]*domain.Train{
+			"1": {Number: "1", Stops: []domain.Stop{{StationCode: "S05043"}, {StationCode: "S01700"}}},
+		},
+	}
+
+	journeys, err := New(client, nil).FindJourneys(context.Background(), "S01700", "S05043", 0)
+	if err != nil {
+		t.Fatalf("FindJourneys failed: %v", err)
+	}
+	if len(journeys) != 0 {
+		t.Errorf("got %d journeys, want none", len(journeys))
+	}
+}
+
+func TestResolveStation(t *testing.T) {
+	svc := New(&fakeBoardClient{}, nil)
+	ctx := context.Background()
+
+	if st, err := svc.ResolveStation(ctx, "S01700"); err != nil || st.Code != "S01700" {
+		t.Errorf("code: got %+v, %v", st, err)
+	}
+	if st, err := svc.ResolveStation(ctx, "firenze rifredi"); err != nil || st.Code != "S06421" {
+		t.Errorf("exact name: got %+v, %v", st, err)
+	}
+
+	_, err := svc.ResolveStation(ctx, "Firenze")
+	var ambiguous *AmbiguousStationError
+	if !errors.As(err, &ambiguous) || len(ambiguous.Candidates) != 2 {
+		t.Errorf("expected an ambiguity error, got %v", err)
+	}
+}
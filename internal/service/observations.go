@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/storage/sqlc"
+)
+
+// ObserveTrain stores the train's delay and last detected station as seen at
+// observedAt, one point of the run's delay timeline
+func (s *Service) ObserveTrain(ctx context.Context, train *domain.Train, date, observedAt time.Time) error {
+	if s.queries == nil {
+		return ErrNoDatabase
+	}
+	return observeTrain(ctx, s.queries, s.withPunctuality(train), date, observedAt)
+}
+
+func observeTrain(ctx context.Context, q *sqlc.Queries, train *domain.Train, date, observedAt time.Time) error {
+	return q.InsertDelayObservation(ctx, sqlc.InsertDelayObservationParams{
+		TrainNumber: train.Number,
+		OriginCode:  train.OriginCode,
+		Date:        date,
+		ObservedAt:  observedAt,
+		Delay:       int64(train.Delay),
+		LastStation: train.Position(observedAt).LastStation,
+		Status:      string(train.Status),
+		Source:      sql.NullString{String: train.Source, Valid: train.Source != ""},
+	})
+}
+
+// GetDelayTimeline returns how the delay of a train run evolved, oldest
+// observation first. A ref without a date means today's run.
+func (s *Service) GetDelayTimeline(ctx context.Context, ref domain.TrainRef) ([]domain.DelayObservation, error) {
+	if s.queries == nil {
+		return nil, nil
+	}
+
+	date := ref.Date
+	if date.IsZero() {
+		date = domain.ServiceDay(time.Now())
+	}
+	rows, err := s.queries.GetDelayObservations(ctx, sqlc.GetDelayObservationsParams{
+		TrainNumber: ref.Number,
+		OriginCode:  ref.OriginCode,
+		Date:        date,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []domain.DelayObservation
+	for _, r := range rows {
+		result = append(result, domain.DelayObservation{
+			ObservedAt:  r.ObservedAt.In(domain.Rome),
+			Delay:       int(r.Delay),
+			LastStation: r.LastStation,
+			Status:      domain.TrainStatus(r.Status),
+			Source:      nullString(r.Source),
+		})
+	}
+	return result, nil
+}
@@ -3,85 +3,214 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/emiliopalmerini/treni/internal/api"
 	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/punctuality"
 	"github.com/emiliopalmerini/treni/internal/storage/sqlc"
 )
 
+// ErrNoDatabase is returned by write operations when no database is configured
+var ErrNoDatabase = errors.New("database not available")
+
 type Service struct {
 	api     api.TrainClient
+	db      *sql.DB
 	queries *sqlc.Queries
+
+	// stations caches complete station metadata in memory, keyed by code
+	stations sync.Map
+
+	// punctuality decides which recorded trips count as on time
+	punctuality punctuality.Policy
+}
+
+// New builds a service on the train client, keeping history in db. With a
+// nil db nothing is cached or recorded.
+func New(api api.TrainClient, db *sql.DB) *Service {
+	s := &Service{
+		api:         api,
+		db:          db,
+		punctuality: punctuality.Default(),
+	}
+	if db != nil {
+		s.queries = sqlc.New(db)
+	}
+	return s
+}
+
+// SetPunctuality replaces the built-in punctuality policy
+func (s *Service) SetPunctuality(p punctuality.Policy) {
+	s.punctuality = p
+}
+
+// Punctuality is the policy deciding which trips count as on time
+func (s *Service) Punctuality() punctuality.Policy {
+	return s.punctuality
+}
+
+// thresholds encodes the punctuality policy for the analytics queries: the
+// category and provider thresholds as JSON objects, then the default
+func (s *Service) thresholds() (string, string, int64) {
+	categories, _ := json.Marshal(s.punctuality.Categories)
+	providers, _ := json.Marshal(s.punctuality.Providers)
+	return string(categories), string(providers), int64(s.punctuality.Default)
 }
 
-func New(api api.TrainClient, queries *sqlc.Queries) *Service {
-	return &Service{
-		api:     api,
-		queries: queries,
+// withPunctuality returns the train with its status judged by the
+// punctuality policy, copied when that changes it
+func (s *Service) withPunctuality(train *domain.Train) *domain.Train {
+	status := s.punctuality.TrainStatus(train)
+	if status == train.Status {
+		return train
 	}
+	judged := *train
+	judged.Status = status
+	return &judged
+}
+
+// HasDatabase reports whether historical data is available
+func (s *Service) HasDatabase() bool {
+	return s.queries != nil
 }
 
 // TrainResult combines real-time data with historical stats
 type TrainResult struct {
 	Train *domain.Train
 	Stats *domain.TrainStats
+
+	// Timeline is how the run's delay evolved, when it was observed
+	Timeline []domain.DelayObservation
+	// OnTimeThreshold is the delay, in minutes, up to which the train is on
+	// time by the punctuality policy
+	OnTimeThreshold int
 }
 
 // TrainRanking represents a train in rankings
 type TrainRanking struct {
-	TrainNumber string
-	Category    string
-	Origin      string
-	Destination string
-	TripCount   int
-	AvgDelay    float64
-	MaxDelay    int
-	OnTimeRate  float64
-}
-
-// GetTrain returns real-time train data combined with historical stats if available
-func (s *Service) GetTrain(ctx context.Context, trainNumber string) (*TrainResult, error) {
-	train, err := s.api.GetTrain(ctx, trainNumber)
+	TrainNumber string  `json:"train_number"`
+	OriginCode  string  `json:"origin_code"`
+	Category    string  `json:"category"`
+	Origin      string  `json:"origin"`
+	Destination string  `json:"destination"`
+	TripCount   int     `json:"trip_count"`
+	AvgDelay    float64 `json:"avg_delay"`
+	MaxDelay    int     `json:"max_delay"`
+	OnTimeRate  float64 `json:"on_time_rate"`
+}
+
+// GetTrain returns real-time data for the train run combined with historical
+// stats if available. A number shared by several trains fails with an
+// *api.AmbiguousTrainError listing them.
+func (s *Service) GetTrain(ctx context.Context, ref domain.TrainRef) (*TrainResult, error) {
+	train, err := api.GetTrainRun(ctx, s.api, ref)
 	if err != nil {
 		return nil, err
 	}
+	train = s.withPunctuality(train)
 
-	result := &TrainResult{Train: train}
+	result := &TrainResult{
+		Train:           train,
+		OnTimeThreshold: s.punctuality.Threshold(train.Category, train.Source),
+	}
 
 	// Try to get historical stats (don't fail if not available)
 	if s.queries != nil {
-		stats, err := s.queries.GetTrainStats(ctx, trainNumber)
-		if err == nil && stats.TotalTrips > 0 {
-			result.Stats = mapTrainStats(stats)
+		stats, err := s.GetTrainStats(ctx, train.Ref())
+		if err == nil && stats != nil && stats.TotalTrips > 0 {
+			result.Stats = stats
+		}
+		if timeline, err := s.GetDelayTimeline(ctx, train.Ref()); err == nil {
+			result.Timeline = timeline
 		}
 	}
 
 	return result, nil
 }
 
+// FindTrains lists the runs carrying a train number
+func (s *Service) FindTrains(ctx context.Context, trainNumber string) ([]domain.TrainRef, error) {
+	return api.FindTrains(ctx, s.api, trainNumber)
+}
+
 // GetStation returns station data with arrivals and departures
 func (s *Service) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
-	station, err := s.api.GetStation(ctx, stationCode)
+	return s.GetStationAt(ctx, stationCode, time.Time{})
+}
+
+// GetStationAt returns the station board as it stands at the given time, or
+// the current one when at is zero
+func (s *Service) GetStationAt(ctx context.Context, stationCode string, at time.Time) (*domain.Station, error) {
+	station, err := api.GetStationAt(ctx, s.api, stationCode, at)
 	if err != nil {
 		return nil, err
 	}
 
+	// Boards carry no metadata; fill it from the station directory
+	info, err := s.StationInfo(ctx, stationCode)
+	if err == nil && info != nil {
+		station.Name = info.Name
+		station.City = info.City
+		station.Region = info.Region
+		station.Latitude = info.Latitude
+		station.Longitude = info.Longitude
+	}
+
+	for i, d := range station.Departures {
+		station.Departures[i].Status = s.punctuality.BoardStatus(d.Status, d.Delay, d.TrainCategory, station.Source)
+	}
+	for i, a := range station.Arrivals {
+		station.Arrivals[i].Status = s.punctuality.BoardStatus(a.Status, a.Delay, a.TrainCategory, station.Source)
+	}
+
 	return station, nil
 }
 
-// SearchStations searches for stations by name
+// SearchStations searches for stations by name. A query the provider answered
+// recently is served from the cache; others go to the provider, caching the
+// names it finds, and fall back to the cache when it is unavailable.
 func (s *Service) SearchStations(ctx context.Context, query string) ([]domain.Station, error) {
-	return s.api.SearchStation(ctx, query)
+	if s.searchedBefore(ctx, query) {
+		if cached, err := s.searchCachedStations(ctx, query); err == nil {
+			return cached, nil
+		}
+	}
+
+	stations, err := s.api.SearchStation(ctx, query)
+	if err != nil {
+		cached, cacheErr := s.searchCachedStations(ctx, query)
+		if cacheErr == nil && len(cached) > 0 {
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if s.rememberStations(ctx, stations) {
+		s.rememberSearch(ctx, query)
+	}
+	return stations, nil
 }
 
-// GetTrainStats returns historical statistics for a train
-func (s *Service) GetTrainStats(ctx context.Context, trainNumber string) (*domain.TrainStats, error) {
+// GetTrainStats returns historical statistics for a train. A ref without an
+// origin covers every train carrying the number; its date is ignored.
+func (s *Service) GetTrainStats(ctx context.Context, ref domain.TrainRef) (*domain.TrainStats, error) {
 	if s.queries == nil {
 		return nil, nil
 	}
 
-	stats, err := s.queries.GetTrainStats(ctx, trainNumber)
+	categories, providers, fallback := s.thresholds()
+	stats, err := s.queries.GetTrainStats(ctx, sqlc.GetTrainStatsParams{
+		CategoryThresholds: categories,
+		ProviderThresholds: providers,
+		DefaultThreshold:   fallback,
+		TrainNumber:        ref.Number,
+		OriginCode:         ref.OriginCode,
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -89,16 +218,30 @@ func (s *Service) GetTrainStats(ctx context.Context, trainNumber string) (*domai
 		return nil, err
 	}
 
-	return mapTrainStats(stats), nil
+	delays, err := s.queries.GetTrainDelays(ctx, sqlc.GetTrainDelaysParams{
+		TrainNumber: ref.Number,
+		OriginCode:  ref.OriginCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := mapTrainStats(stats)
+	result.SetDistribution(toInts(delays))
+	return result, nil
 }
 
-// GetDelayHistory returns historical delay records for a train
-func (s *Service) GetDelayHistory(ctx context.Context, trainNumber string) ([]domain.DelayRecord, error) {
+// GetDelayHistory returns historical delay records for a train, completed
+// by the runs seen on recorded station boards for days without a record. A
+// ref without an origin covers every train carrying the number.
+func (s *Service) GetDelayHistory(ctx context.Context, ref domain.TrainRef) ([]domain.DelayRecord, error) {
 	if s.queries == nil {
 		return nil, nil
 	}
 
-	records, err := s.queries.GetDelayRecordsByTrain(ctx, trainNumber)
+	records, err := s.queries.GetDelayRecordsByTrain(ctx, sqlc.GetDelayRecordsByTrainParams{
+		TrainNumber: ref.Number,
+		OriginCode:  ref.OriginCode,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +251,7 @@ func (s *Service) GetDelayHistory(ctx context.Context, trainNumber string) ([]do
 		result[i] = domain.DelayRecord{
 			ID:            r.ID,
 			TrainNumber:   r.TrainNumber,
+			OriginCode:    r.OriginCode,
 			TrainCategory: nullString(r.TrainCategory),
 			Origin:        r.Origin,
 			Destination:   r.Destination,
@@ -116,6 +260,245 @@ func (s *Service) GetDelayHistory(ctx context.Context, trainNumber string) ([]do
 			Cancelled:     nullBool(r.Cancelled),
 			Source:        nullString(r.Source),
 			RecordedAt:    nullTime(r.RecordedAt),
+			Status:        domain.TrainStatus(r.Status),
+			Completeness:  domain.Completeness(r.Completeness),
+		}
+	}
+
+	observed, err := s.observedRuns(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeHistory(result, observed), nil
+}
+
+// RecordTrain stores the train's delay and the delay at each of its stops for
+// the given service date, in one transaction so a run is never half written
+func (s *Service) RecordTrain(ctx context.Context, train *domain.Train, date time.Time) error {
+	_, err := s.recordTrain(ctx, train, date)
+	return err
+}
+
+// recordTrain is RecordTrain, also reporting whether the run's delay record
+// was written: a final record is left alone by a provisional one
+func (s *Service) recordTrain(ctx context.Context, train *domain.Train, date time.Time) (bool, error) {
+	if s.queries == nil {
+		return false, ErrNoDatabase
+	}
+
+	train = s.withPunctuality(train)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	q := s.queries.WithTx(tx)
+
+	// Rows are keyed by the provider that supplied the train, so a run is
+	// stored once per source even when stop fields were merged from others.
+	// Stop rows also keep which providers supplied their times and platform.
+	source := train.Source
+	if source == "" {
+		source = "unknown"
+	}
+
+	written, err := q.InsertDelayRecord(ctx, sqlc.InsertDelayRecordParams{
+		TrainNumber:   train.Number,
+		OriginCode:    train.OriginCode,
+		TrainCategory: sql.NullString{String: train.Category, Valid: train.Category != ""},
+		Origin:        train.Origin,
+		Destination:   train.Destination,
+		Date:          date,
+		Delay:         int64(train.Delay),
+		Cancelled:     sql.NullBool{Bool: train.Status == domain.TrainStatusCancelled, Valid: true},
+		Source:        sql.NullString{String: source, Valid: true},
+		Status:        string(train.Status),
+		Completeness:  string(train.Completeness()),
+	})
+	if err != nil {
+		return false, err
+	}
+	// A final record is kept whole: a later provisional poll changes
+	// neither its stops nor its timeline
+	if written == 0 {
+		return false, nil
+	}
+
+	// The recorded delay is also the last point of the run's timeline
+	if err := observeTrain(ctx, q, train, date, time.Now()); err != nil {
+		return false, err
+	}
+
+	for i, stop := range train.Stops {
+		err := q.InsertStopRecord(ctx, sqlc.InsertStopRecordParams{
+			TrainNumber:        train.Number,
+			OriginCode:         train.OriginCode,
+			Date:               date,
+			StationCode:        stop.StationCode,
+			StationName:        stop.StationName,
+			StopIndex:          int64(i),
+			ScheduledArrival:   toNullTime(stop.ScheduledArrival),
+			ActualArrival:      toNullTime(stop.ActualArrival),
+			ScheduledDeparture: toNullTime(stop.ScheduledDepart),
+			ActualDeparture:    toNullTime(stop.ActualDepart),
+			ArrivalDelay:       int64(stop.ArrivalDelay),
+			DepartureDelay:     int64(stop.DepartureDelay),
+			Platform:           sql.NullString{String: stop.Platform, Valid: stop.Platform != ""},
+			PlatformConfirmed:  sql.NullBool{Bool: stop.PlatformConfirmed, Valid: true},
+			Source:             sql.NullString{String: source, Valid: true},
+			ScheduledPlatform:  sql.NullString{String: stop.ScheduledPlatform, Valid: stop.ScheduledPlatform != ""},
+			StopSource:         sql.NullString{String: stop.Source, Valid: stop.Source != ""},
+			PlatformSource:     sql.NullString{String: stop.PlatformSource, Valid: stop.PlatformSource != ""},
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FinalizeRecords polls again the runs recorded before they arrived, on or
+// after since, and records those that have arrived by now. A run is written
+// back under the source of its provisional record, whichever provider
+// answers. It returns how many records were finalised; runs that fail to
+// load are skipped and their errors returned together.
+func (s *Service) FinalizeRecords(ctx context.Context, since time.Time) (int, error) {
+	if s.queries == nil {
+		return 0, ErrNoDatabase
+	}
+
+	records, err := s.queries.GetProvisionalDelayRecords(ctx, since)
+	if err != nil {
+		return 0, err
+	}
+
+	finalized := 0
+	var errs []error
+	for _, r := range records {
+		ref := domain.TrainRef{Number: r.TrainNumber, OriginCode: r.OriginCode, Date: r.Date}
+		train, err := api.GetTrainRun(ctx, s.api, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("train %s: %w", ref, err))
+			continue
+		}
+		if train.Completeness() != domain.CompletenessArrived {
+			continue
+		}
+		written, err := s.recordTrain(ctx, underSource(train, r.Source.String), r.Date)
+		if err != nil {
+			return finalized, err
+		}
+		if written {
+			finalized++
+		}
+	}
+
+	return finalized, errors.Join(errs...)
+}
+
+// underSource returns a copy of train to be recorded under source, its stops
+// keeping the provider that actually supplied them
+func underSource(train *domain.Train, source string) *domain.Train {
+	if source == "" || source == train.Source {
+		return train
+	}
+	run := *train
+	run.Source = source
+	run.Stops = make([]domain.Stop, len(train.Stops))
+	for i, stop := range train.Stops {
+		if stop.Source == "" {
+			stop.Source = train.Source
+		}
+		if stop.PlatformSource == "" && stop.Platform != "" {
+			stop.PlatformSource = train.Source
+		}
+		run.Stops[i] = stop
+	}
+	return &run
+}
+
+// GetStopHistory returns the recorded delays of a train at one station
+func (s *Service) GetStopHistory(ctx context.Context, ref domain.TrainRef, stationCode string) ([]domain.StopRecord, error) {
+	if s.queries == nil {
+		return nil, nil
+	}
+
+	records, err := s.queries.GetStopRecordsByTrainAndStation(ctx, sqlc.GetStopRecordsByTrainAndStationParams{
+		TrainNumber: ref.Number,
+		OriginCode:  ref.OriginCode,
+		StationCode: stationCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]domain.StopRecord, len(records))
+	for i, r := range records {
+		result[i] = mapStopRecord(r)
+	}
+
+	return result, nil
+}
+
+// GetStopStats returns historical statistics for a train at one station
+func (s *Service) GetStopStats(ctx context.Context, ref domain.TrainRef, stationCode string) (*domain.StopStats, error) {
+	if s.queries == nil {
+		return nil, nil
+	}
+
+	categories, providers, fallback := s.thresholds()
+	stats, err := s.queries.GetStopStats(ctx, sqlc.GetStopStatsParams{
+		CategoryThresholds: categories,
+		ProviderThresholds: providers,
+		DefaultThreshold:   fallback,
+		TrainNumber:        ref.Number,
+		OriginCode:         ref.OriginCode,
+		StationCode:        stationCode,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return mapStopStats(stats), nil
+}
+
+// GetPlatformUsage returns the platforms a train was seen at in one station,
+// the most used first
+func (s *Service) GetPlatformUsage(ctx context.Context, ref domain.TrainRef, stationCode string) ([]domain.PlatformUsage, error) {
+	if s.queries == nil {
+		return nil, nil
+	}
+
+	rows, err := s.queries.GetPlatformUsage(ctx, sqlc.GetPlatformUsageParams{
+		TrainNumber: ref.Number,
+		OriginCode:  ref.OriginCode,
+		StationCode: stationCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	for _, r := range rows {
+		total += int(r.Uses)
+	}
+
+	result := make([]domain.PlatformUsage, len(rows))
+	for i, r := range rows {
+		result[i] = domain.PlatformUsage{
+			Platform: nullString(r.Platform),
+			Uses:     int(r.Uses),
+			Changes:  int(nullFloat(r.Changes)),
+			Share:    float64(r.Uses) / float64(total),
 		}
 	}
 
@@ -128,7 +511,7 @@ func (s *Service) GetMostDelayedTrains(ctx context.Context, days, limit int) ([]
 		return nil, nil
 	}
 
-	to := time.Now()
+	to := domain.ServiceDay(time.Now())
 	from := to.AddDate(0, 0, -days)
 
 	rows, err := s.queries.GetMostDelayedTrains(ctx, sqlc.GetMostDelayedTrainsParams{
@@ -144,7 +527,8 @@ func (s *Service) GetMostDelayedTrains(ctx context.Context, days, limit int) ([]
 	for i, r := range rows {
 		result[i] = TrainRanking{
 			TrainNumber: r.TrainNumber,
-			Category:    nullString(r.TrainCategory),
+			OriginCode:  r.OriginCode,
+			Category:    r.TrainCategory,
 			Origin:      r.Origin,
 			Destination: r.Destination,
 			TripCount:   int(r.TripCount),
@@ -162,13 +546,17 @@ func (s *Service) GetMostReliableTrains(ctx context.Context, days, limit int) ([
 		return nil, nil
 	}
 
-	to := time.Now()
+	to := domain.ServiceDay(time.Now())
 	from := to.AddDate(0, 0, -days)
 
+	categories, providers, fallback := s.thresholds()
 	rows, err := s.queries.GetMostReliableTrains(ctx, sqlc.GetMostReliableTrainsParams{
-		FromDate:   from,
-		ToDate:     to,
-		LimitCount: int64(limit),
+		CategoryThresholds: categories,
+		ProviderThresholds: providers,
+		DefaultThreshold:   fallback,
+		FromDate:           from,
+		ToDate:             to,
+		LimitCount:         int64(limit),
 	})
 	if err != nil {
 		return nil, err
@@ -178,7 +566,8 @@ func (s *Service) GetMostReliableTrains(ctx context.Context, days, limit int) ([
 	for i, r := range rows {
 		result[i] = TrainRanking{
 			TrainNumber: r.TrainNumber,
-			Category:    nullString(r.TrainCategory),
+			OriginCode:  r.OriginCode,
+			Category:    r.TrainCategory,
 			Origin:      r.Origin,
 			Destination: r.Destination,
 			TripCount:   int(r.TripCount),
@@ -210,6 +599,57 @@ func mapTrainStats(s sqlc.GetTrainStatsRow) *domain.TrainStats {
 		AverageDelay:   nullFloat(s.AverageDelay),
 		MaxDelay:       interfaceToInt(s.MaxDelay),
 		OnTimeRate:     onTimeRate,
+
+		PartiallyCancelledTrips: int(nullFloat(s.PartiallyCancelledTrips)),
+		ReroutedTrips:           int(nullFloat(s.ReroutedTrips)),
+		ProvisionalTrips:        int(s.ProvisionalTrips),
+		OnTimeThreshold:         interfaceToInt(s.OnTimeThreshold),
+	}
+}
+
+func mapStopRecord(r sqlc.StopRecord) domain.StopRecord {
+	return domain.StopRecord{
+		ID:                r.ID,
+		TrainNumber:       r.TrainNumber,
+		OriginCode:        r.OriginCode,
+		Date:              r.Date,
+		StationCode:       r.StationCode,
+		StationName:       r.StationName,
+		StopIndex:         int(r.StopIndex),
+		ScheduledArrival:  nullTime(r.ScheduledArrival),
+		ActualArrival:     nullTime(r.ActualArrival),
+		ScheduledDepart:   nullTime(r.ScheduledDeparture),
+		ActualDepart:      nullTime(r.ActualDeparture),
+		ArrivalDelay:      int(r.ArrivalDelay),
+		DepartureDelay:    int(r.DepartureDelay),
+		Platform:          nullString(r.Platform),
+		PlatformConfirmed: nullBool(r.PlatformConfirmed),
+		ScheduledPlatform: nullString(r.ScheduledPlatform),
+		Source:            nullString(r.Source),
+		RecordedAt:        nullTime(r.RecordedAt),
+		StopSource:        nullString(r.StopSource),
+		PlatformSource:    nullString(r.PlatformSource),
+	}
+}
+
+func mapStopStats(s sqlc.GetStopStatsRow) *domain.StopStats {
+	totalStops := int(s.TotalStops)
+	onTimeStops := int(nullFloat(s.OnTimeStops))
+
+	var onTimeRate float64
+	if totalStops > 0 {
+		onTimeRate = float64(onTimeStops) / float64(totalStops)
+	}
+
+	return &domain.StopStats{
+		TrainNumber:           s.TrainNumber,
+		StationCode:           s.StationCode,
+		TotalStops:            totalStops,
+		OnTimeStops:           onTimeStops,
+		AverageArrivalDelay:   nullFloat(s.AverageArrivalDelay),
+		MaxArrivalDelay:       interfaceToInt(s.MaxArrivalDelay),
+		AverageDepartureDelay: nullFloat(s.AverageDepartureDelay),
+		OnTimeRate:            onTimeRate,
 	}
 }
 
@@ -234,13 +674,26 @@ func nullFloat(nf sql.NullFloat64) float64 {
 	return 0
 }
 
+// nullTime reads a stored timestamp back in Italian time
 func nullTime(nt sql.NullTime) time.Time {
 	if nt.Valid {
-		return nt.Time
+		return nt.Time.In(domain.Rome)
 	}
 	return time.Time{}
 }
 
+func toNullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func toInts(values []int64) []int {
+	ints := make([]int, len(values))
+	for i, v := range values {
+		ints[i] = int(v)
+	}
+	return ints
+}
+
 func interfaceToInt(v interface{}) int {
 	switch val := v.(type) {
 	case int64:
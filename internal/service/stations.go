@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/storage/sqlc"
+)
+
+// StationInfo returns the station's metadata. Complete entries come from the
+// in-memory or database cache; on first sight the provider's directory is
+// queried and the result cached.
+func (s *Service) StationInfo(ctx context.Context, stationCode string) (*domain.Station, error) {
+	if v, ok := s.stations.Load(stationCode); ok {
+		station := v.(domain.Station)
+		return &station, nil
+	}
+
+	var cached *domain.Station
+	if s.queries != nil {
+		row, err := s.queries.GetStation(ctx, stationCode)
+		switch {
+		case err == nil:
+			cached = mapStation(row)
+			if row.Region.Valid {
+				s.stations.Store(stationCode, *cached)
+				return cached, nil
+			}
+		case err != sql.ErrNoRows:
+			return nil, err
+		}
+	}
+
+	dir, ok := s.api.(api.StationDirectory)
+	if !ok {
+		return cached, nil
+	}
+
+	station, err := dir.GetStationDetails(ctx, stationCode)
+	if err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	s.saveStation(ctx, station)
+	return station, nil
+}
+
+// saveStation stores complete station metadata in both caches. The region is
+// stored even when the provider does not know it, as an empty string, which
+// marks the entry as complete so it is not fetched again.
+func (s *Service) saveStation(ctx context.Context, station *domain.Station) {
+	s.stations.Store(station.Code, *station)
+
+	if s.queries == nil {
+		return
+	}
+	err := s.queries.UpsertStation(ctx, sqlc.UpsertStationParams{
+		Code:      station.Code,
+		Name:      station.Name,
+		City:      sql.NullString{String: station.City, Valid: station.City != ""},
+		Region:    sql.NullString{String: station.Region, Valid: true},
+		Latitude:  sql.NullFloat64{Float64: station.Latitude, Valid: station.Latitude != 0},
+		Longitude: sql.NullFloat64{Float64: station.Longitude, Valid: station.Longitude != 0},
+	})
+	if err != nil {
+		log.Printf("cache station %s: %v", station.Code, err)
+	}
+}
+
+// rememberStations records the names seen in search results without
+// overwriting richer cached entries, reporting whether all were stored
+func (s *Service) rememberStations(ctx context.Context, stations []domain.Station) bool {
+	if s.queries == nil {
+		return false
+	}
+	for _, st := range stations {
+		if st.Code == "" || st.Name == "" {
+			continue
+		}
+		err := s.queries.InsertStationIfMissing(ctx, sqlc.InsertStationIfMissingParams{
+			Code: st.Code,
+			Name: st.Name,
+		})
+		if err != nil {
+			log.Printf("cache station %s: %v", st.Code, err)
+			return false
+		}
+	}
+	return true
+}
+
+// rememberSearch records that the provider answered the query, whose results
+// are now in the stations cache
+func (s *Service) rememberSearch(ctx context.Context, query string) {
+	if err := s.queries.InsertStationSearch(ctx, searchKey(query)); err != nil {
+		log.Printf("cache station search %q: %v", query, err)
+	}
+}
+
+// searchedBefore reports whether the provider answered the query in the last
+// 30 days, so the stations cache holds its results
+func (s *Service) searchedBefore(ctx context.Context, query string) bool {
+	if s.queries == nil {
+		return false
+	}
+	n, err := s.queries.CountRecentStationSearches(ctx, searchKey(query))
+	return err == nil && n > 0
+}
+
+func searchKey(query string) string {
+	return strings.ToLower(strings.TrimSpace(query))
+}
+
+// searchCachedStations looks up stations by name in the database cache
+func (s *Service) searchCachedStations(ctx context.Context, query string) ([]domain.Station, error) {
+	if s.queries == nil {
+		return nil, nil
+	}
+
+	rows, err := s.queries.GetStationByName(ctx, "%"+strings.TrimSpace(query)+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]domain.Station, len(rows))
+	for i, r := range rows {
+		result[i] = *mapStation(r)
+	}
+	return result, nil
+}
+
+func mapStation(r sqlc.Station) *domain.Station {
+	return &domain.Station{
+		Code:      r.Code,
+		Name:      r.Name,
+		City:      nullString(r.City),
+		Region:    nullString(r.Region),
+		Latitude:  nullFloat(r.Latitude),
+		Longitude: nullFloat(r.Longitude),
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/storage"
+)
+
+type fakeDirectory struct {
+	details  map[string]domain.Station
+	stations []domain.Station
+	err      error
+	calls    int
+	searches int
+}
+
+func (f *fakeDirectory) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeDirectory) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	return &domain.Station{Code: stationCode, Name: stationCode}, nil
+}
+
+func (f *fakeDirectory) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	f.searches++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.stations, nil
+}
+
+func (f *fakeDirectory) GetStationDetails(ctx context.Context, stationCode string) (*domain.Station, error) {
+	f.calls++
+	st, ok := f.details[stationCode]
+	if !ok {
+		return nil, errors.New("unknown station")
+	}
+	return &st, nil
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := storage.NewLocal(filepath.Join(t.TempDir(), "treni.db"))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db.DB
+}
+
+func TestGetStationUsesDirectoryCache(t *testing.T) {
+	dir := &fakeDirectory{details: map[string]domain.Station{
+		"S01520": {Code: "S01520", Name: "LECCO", City: "Lecco", Region: "Lombardia", Latitude: 45.85, Longitude: 9.39},
+	}}
+	db := newTestDB(t)
+
+	station, err := New(dir, db).GetStation(context.Background(), "S01520")
+	if err != nil {
+		t.Fatalf("GetStation failed: %v", err)
+	}
+	if station.Name != "LECCO" || station.Region != "Lombardia" {
+		t.Errorf("unexpected station metadata: %+v", station)
+	}
+
+	// A fresh service reads the entry back from the database
+	station, err = New(dir, db).GetStation(context.Background(), "S01520")
+	if err != nil {
+		t.Fatalf("GetStation failed: %v", err)
+	}
+	if station.Name != "LECCO" || station.Latitude != 45.85 {
+		t.Errorf("unexpected cached station: %+v", station)
+	}
+	if dir.calls != 1 {
+		t.Errorf("directory called %d times, want 1", dir.calls)
+	}
+}
+
+func TestSearchStationsFallsBackToCache(t *testing.T) {
+	dir := &fakeDirectory{stations: []domain.Station{{Code: "S01520", Name: "LECCO"}}}
+	svc := New(dir, newTestDB(t))
+
+	if _, err := svc.SearchStations(context.Background(), "Lecco"); err != nil {
+		t.Fatalf("SearchStations failed: %v", err)
+	}
+
+	dir.err = errors.New("upstream down")
+	stations, err := svc.SearchStations(context.Background(), "lec")
+	if err != nil {
+		t.Fatalf("SearchStations should fall back to cache: %v", err)
+	}
+	if len(stations) != 1 || stations[0].Code != "S01520" {
+		t.Errorf("unexpected cached results: %+v", stations)
+	}
+}
+
+func TestSearchStationsServedFromCache(t *testing.T) {
+	dir := &fakeDirectory{stations: []domain.Station{{Code: "S01520", Name: "LECCO"}, {Code: "S01521", Name: "LECCO MAGGIANICO"}}}
+	svc := New(dir, newTestDB(t))
+
+	for range 2 {
+		stations, err := svc.SearchStations(context.Background(), "Lecco ")
+		if err != nil {
+			t.Fatalf("SearchStations failed: %v", err)
+		}
+		if len(stations) != 2 {
+			t.Errorf("got %d stations, want 2", len(stations))
+		}
+	}
+	if dir.searches != 1 {
+		t.Errorf("provider searched %d times, want 1", dir.searches)
+	}
+
+	// A new query goes to the provider
+	if _, err := svc.SearchStations(context.Background(), "Milano"); err != nil {
+		t.Fatalf("SearchStations failed: %v", err)
+	}
+	if dir.searches != 2 {
+		t.Errorf("provider searched %d times, want 2", dir.searches)
+	}
+}
+
+func TestStationInfoWithoutRegion(t *testing.T) {
+	dir := &fakeDirectory{details: map[string]domain.Station{
+		"S01520": {Code: "S01520", Name: "LECCO", City: "Lecco"},
+	}}
+	db := newTestDB(t)
+
+	for range 2 {
+		if _, err := New(dir, db).StationInfo(context.Background(), "S01520"); err != nil {
+			t.Fatalf("StationInfo failed: %v", err)
+		}
+	}
+	if dir.calls != 1 {
+		t.Errorf("directory called %d times, want 1", dir.calls)
+	}
+}
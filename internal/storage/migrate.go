@@ -1,23 +1,364 @@
 package storage
 
 import (
+	"database/sql"
 	"embed"
 	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+// Migration is a versioned schema change loaded from
+// migrations/NNN_name.up.sql and its matching .down.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Migrate applies every pending migration in version order
 func (db *DB) Migrate() error {
-	content, err := migrationsFS.ReadFile("migrations/001_init.up.sql")
+	migrations, err := loadMigrations()
 	if err != nil {
-		return fmt.Errorf("read migration file: %w", err)
+		return err
 	}
 
-	_, err = db.Exec(string(content))
+	applied, err := db.appliedVersions()
 	if err != nil {
-		return fmt.Errorf("execute migration: %w", err)
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := db.apply(m); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// Rollback reverts the given number of most recently applied migrations,
+// newest first. A negative steps reverts all of them.
+func (db *DB) Rollback(steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.appliedVersions()
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps != 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := db.revert(m); err != nil {
+			return err
+		}
+		steps--
+	}
+
+	return nil
+}
+
+// MigrationStatus lists every known migration and whether it is applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		result[i] = MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		}
+	}
+
+	return result, nil
+}
+
+func (db *DB) appliedVersions() (map[int]time.Time, error) {
+	if _, err := db.Exec(createSchemaMigrations); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("read schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt.Time
+	}
+
+	return applied, rows.Err()
+}
+
+func (db *DB) apply(m Migration) error {
+	return db.inTx(m.Up, func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+		return err
+	}, "apply migration %03d_%s", m.Version, m.Name)
+}
+
+func (db *DB) revert(m Migration) error {
+	if m.Down == "" {
+		return fmt.Errorf("migration %03d_%s has no down file", m.Version, m.Name)
+	}
+	return db.inTx(m.Down, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+		return err
+	}, "revert migration %03d_%s", m.Version, m.Name)
+}
+
+// inTx runs script and then bookkeep in a single transaction
+func (db *DB) inTx(script string, bookkeep func(*sql.Tx) error, format string, args ...any) error {
+	wrap := func(err error) error {
+		return fmt.Errorf(format+": %w", append(args, err)...)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return wrap(err)
+	}
+	defer tx.Rollback()
+
+	// libsql only executes the first statement of a multi-statement Exec
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return wrap(err)
+		}
+	}
+	if err := bookkeep(tx); err != nil {
+		return wrap(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// loadMigrations reads the embedded migration files sorted by version
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("list migration files: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		version, name, direction, err := parseMigrationName(path.Base(file))
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read migration file: %w", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %03d has conflicting names %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// parseMigrationName splits "001_init.up.sql" into 1, "init" and "up"
+func parseMigrationName(file string) (int, string, string, error) {
+	base := strings.TrimSuffix(file, ".sql")
+	var direction string
+	switch {
+	case strings.HasSuffix(base, ".up"):
+		direction = "up"
+	case strings.HasSuffix(base, ".down"):
+		direction = "down"
+	default:
+		return 0, "", "", fmt.Errorf("migration %s: expected .up.sql or .down.sql", file)
+	}
+	base = strings.TrimSuffix(base, "."+direction)
+
+	prefix, name, ok := strings.Cut(base, "_")
+	if !ok {
+		return 0, "", "", fmt.Errorf("migration %s: expected NNN_name", file)
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("migration %s: invalid version: %w", file, err)
+	}
+
+	return version, name, direction, nil
+}
+
+// splitStatements splits a SQL script on the semicolons ending its
+// statements, dropping chunks that contain only whitespace and comments.
+// Semicolons inside quotes, comments and trigger bodies are kept.
+func splitStatements(script string) []string {
+	var (
+		stmts []string
+		start int
+		code  bool     // the current statement has more than comments
+		words []string // its leading keywords, enough to spot a trigger
+		depth int      // open BEGIN and CASE blocks of a trigger
+	)
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case strings.HasPrefix(script[i:], "--"):
+			i = skipPast(script, i, "\n")
+		case strings.HasPrefix(script[i:], "/*"):
+			i = skipPast(script, i+2, "*/")
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			i = skipQuoted(script, i)
+			code = true
+		case isWordByte(c):
+			j := i
+			for j < len(script) && isWordByte(script[j]) {
+				j++
+			}
+			word := strings.ToUpper(script[i:j])
+			if len(words) < 3 {
+				words = append(words, word)
+			}
+			if isTrigger(words) {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					depth--
+				}
+			}
+			code = true
+			i = j
+		case c == ';' && depth <= 0:
+			if code {
+				stmts = append(stmts, strings.TrimSpace(script[start:i]))
+			}
+			start, code, words, depth = i+1, false, nil, 0
+			i++
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				code = true
+			}
+			i++
+		}
+	}
+	if code {
+		stmts = append(stmts, strings.TrimSpace(script[start:]))
+	}
+	return stmts
+}
+
+// skipPast returns the index just after the next end at or after i, or the
+// end of the script when there is none
+func skipPast(script string, i int, end string) int {
+	n := strings.Index(script[i:], end)
+	if n < 0 {
+		return len(script)
+	}
+	return i + n + len(end)
+}
+
+// skipQuoted returns the index just after the string or identifier opening
+// at i; a doubled quote inside it is an escaped one
+func skipQuoted(script string, i int) int {
+	closing := script[i]
+	if closing == '[' {
+		closing = ']'
+	}
+	for j := i + 1; j < len(script); j++ {
+		if script[j] != closing {
+			continue
+		}
+		if closing != ']' && j+1 < len(script) && script[j+1] == closing {
+			j++
+			continue
+		}
+		return j + 1
+	}
+	return len(script)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// isTrigger reports whether a statement starting with words creates a
+// trigger, whose body holds statements of its own
+func isTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+	if words[1] == "TEMP" || words[1] == "TEMPORARY" {
+		return len(words) > 2 && words[2] == "TRIGGER"
+	}
+	return words[1] == "TRIGGER"
+}
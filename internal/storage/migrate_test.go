@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := NewLocal(filepath.Join(t.TempDir(), "treni.db"))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	return count > 0
+}
+
+func TestMigrateAndRollback(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	// Applying again is a no-op
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to re-migrate: %v", err)
+	}
+
+	for _, table := range []string{"stations", "delay_records", "stop_records"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("expected table %s after migrate", table)
+		}
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	if len(status) < 2 {
+		t.Fatalf("expected at least 2 migrations, got %d", len(status))
+	}
+	for _, s := range status {
+		if !s.Applied {
+			t.Errorf("migration %03d_%s not applied", s.Version, s.Name)
+		}
+	}
+	last := status[len(status)-1]
+
+	if err := db.Rollback(1); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	status, err = db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	if status[len(status)-1].Applied {
+		t.Errorf("migration %03d_%s still applied after rollback", last.Version, last.Name)
+	}
+	if !status[0].Applied {
+		t.Error("rollback of one step reverted the first migration")
+	}
+
+	if err := db.Rollback(-1); err != nil {
+		t.Fatalf("failed to roll back all: %v", err)
+	}
+	for _, table := range []string{"stations", "delay_records", "stop_records"} {
+		if tableExists(t, db, table) {
+			t.Errorf("table %s still exists after full rollback", table)
+		}
+	}
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate after rollback: %v", err)
+	}
+	if !tableExists(t, db, "delay_records") {
+		t.Error("expected delay_records after re-applying migrations")
+	}
+}
+
+func TestParseMigrationName(t *testing.T) {
+	tests := []struct {
+		file          string
+		wantVersion   int
+		wantName      string
+		wantDirection string
+		wantErr       bool
+	}{
+		{"001_init.up.sql", 1, "init", "up", false},
+		{"002_stop_records.down.sql", 2, "stop_records", "down", false},
+		{"init.up.sql", 0, "", "", true},
+		{"003_missing_direction.sql", 0, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			version, name, direction, err := parseMigrationName(tt.file)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != tt.wantVersion || name != tt.wantName || direction != tt.wantDirection {
+				t.Errorf("got %d %q %q", version, name, direction)
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			"plain",
+			"CREATE TABLE a (x INT);\nCREATE TABLE b (y INT);\n",
+			[]string{"CREATE TABLE a (x INT)", "CREATE TABLE b (y INT)"},
+		},
+		{
+			"semicolon in literal",
+			"INSERT INTO a VALUES ('x;y', 'it''s; here');\nSELECT 1;",
+			[]string{"INSERT INTO a VALUES ('x;y', 'it''s; here')", "SELECT 1"},
+		},
+		{
+			"semicolon in line comment",
+			"-- first; then second\nSELECT 1;\nSELECT 2; -- done; really\n",
+			[]string{"-- first; then second\nSELECT 1", "SELECT 2"},
+		},
+		{
+			"semicolon in block comment",
+			"SELECT /* a; b */ 1;",
+			[]string{"SELECT /* a; b */ 1"},
+		},
+		{
+			"trigger body",
+			"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET y = CASE WHEN y > 0 THEN 1 END;\n  DELETE FROM c;\nEND;\nSELECT 1;",
+			[]string{"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET y = CASE WHEN y > 0 THEN 1 END;\n  DELETE FROM c;\nEND", "SELECT 1"},
+		},
+		{
+			"comments only",
+			"-- nothing here;\n/* nor; here */\n",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
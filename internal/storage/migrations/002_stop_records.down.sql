@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_stop_records_station_date;
+DROP INDEX IF EXISTS idx_stop_records_train_station;
+DROP TABLE IF EXISTS stop_records;
@@ -0,0 +1,28 @@
+-- Per-stop delay history for each recorded train run
+CREATE TABLE IF NOT EXISTS stop_records (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    train_number TEXT NOT NULL,
+    date DATE NOT NULL,
+    station_code TEXT NOT NULL,
+    station_name TEXT NOT NULL,
+    stop_index INTEGER NOT NULL,
+    scheduled_arrival TIMESTAMP,
+    actual_arrival TIMESTAMP,
+    scheduled_departure TIMESTAMP,
+    actual_departure TIMESTAMP,
+    arrival_delay INTEGER NOT NULL DEFAULT 0,
+    departure_delay INTEGER NOT NULL DEFAULT 0,
+    platform TEXT,
+    platform_confirmed BOOLEAN DEFAULT FALSE,
+    source TEXT DEFAULT 'viaggiatreno',
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    -- One row per stop of a train run
+    UNIQUE(train_number, date, station_code, source)
+);
+
+-- Index for "how late is this train usually at this station"
+CREATE INDEX IF NOT EXISTS idx_stop_records_train_station ON stop_records(train_number, station_code);
+
+-- Index for querying a station over a date range
+CREATE INDEX IF NOT EXISTS idx_stop_records_station_date ON stop_records(station_code, date);
@@ -0,0 +1,72 @@
+-- Runs of different origins on the same day collapse into one, and the most
+-- recently recorded one wins
+CREATE TABLE delay_records_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    train_number TEXT NOT NULL,
+    train_category TEXT,
+    origin TEXT NOT NULL,
+    destination TEXT NOT NULL,
+    date DATE NOT NULL,
+    delay INTEGER NOT NULL,
+    cancelled BOOLEAN DEFAULT FALSE,
+    source TEXT DEFAULT 'viaggiatreno',
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE(train_number, date, source)
+);
+
+INSERT OR REPLACE INTO delay_records_old (id, train_number, train_category, origin, destination, date, delay, cancelled, source, recorded_at)
+SELECT id, train_number, train_category, origin, destination, date, delay, cancelled, source, recorded_at
+FROM delay_records
+ORDER BY recorded_at;
+
+DROP TABLE delay_records;
+
+ALTER TABLE delay_records_old RENAME TO delay_records;
+
+CREATE INDEX IF NOT EXISTS idx_delay_records_train ON delay_records(train_number);
+
+CREATE INDEX IF NOT EXISTS idx_delay_records_date ON delay_records(date);
+
+CREATE INDEX IF NOT EXISTS idx_delay_records_analytics ON delay_records(train_number, date, delay);
+
+CREATE TABLE stop_records_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    train_number TEXT NOT NULL,
+    date DATE NOT NULL,
+    station_code TEXT NOT NULL,
+    station_name TEXT NOT NULL,
+    stop_index INTEGER NOT NULL,
+    scheduled_arrival TIMESTAMP,
+    actual_arrival TIMESTAMP,
+    scheduled_departure TIMESTAMP,
+    actual_departure TIMESTAMP,
+    arrival_delay INTEGER NOT NULL DEFAULT 0,
+    departure_delay INTEGER NOT NULL DEFAULT 0,
+    platform TEXT,
+    platform_confirmed BOOLEAN DEFAULT FALSE,
+    source TEXT DEFAULT 'viaggiatreno',
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE(train_number, date, station_code, source)
+);
+
+INSERT OR REPLACE INTO stop_records_old (
+    id, train_number, date, station_code, station_name, stop_index,
+    scheduled_arrival, actual_arrival, scheduled_departure, actual_departure,
+    arrival_delay, departure_delay, platform, platform_confirmed, source, recorded_at
+)
+SELECT
+    id, train_number, date, station_code, station_name, stop_index,
+    scheduled_arrival, actual_arrival, scheduled_departure, actual_departure,
+    arrival_delay, departure_delay, platform, platform_confirmed, source, recorded_at
+FROM stop_records
+ORDER BY recorded_at;
+
+DROP TABLE stop_records;
+
+ALTER TABLE stop_records_old RENAME TO stop_records;
+
+CREATE INDEX IF NOT EXISTS idx_stop_records_train_station ON stop_records(train_number, station_code);
+
+CREATE INDEX IF NOT EXISTS idx_stop_records_station_date ON stop_records(station_code, date);
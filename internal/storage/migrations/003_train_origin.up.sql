@@ -0,0 +1,75 @@
+-- Different trains can share a number on the same day, so runs are keyed by
+-- their origin station code too. SQLite cannot change a UNIQUE constraint in
+-- place, so both tables are rebuilt. Existing rows get an empty origin code.
+CREATE TABLE delay_records_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    train_number TEXT NOT NULL,
+    origin_code TEXT NOT NULL DEFAULT '',
+    train_category TEXT,
+    origin TEXT NOT NULL,
+    destination TEXT NOT NULL,
+    date DATE NOT NULL,
+    delay INTEGER NOT NULL,
+    cancelled BOOLEAN DEFAULT FALSE,
+    source TEXT DEFAULT 'viaggiatreno',
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    -- Prevent duplicate records for the same run
+    UNIQUE(train_number, origin_code, date, source)
+);
+
+INSERT INTO delay_records_new (id, train_number, train_category, origin, destination, date, delay, cancelled, source, recorded_at)
+SELECT id, train_number, train_category, origin, destination, date, delay, cancelled, source, recorded_at
+FROM delay_records;
+
+DROP TABLE delay_records;
+
+ALTER TABLE delay_records_new RENAME TO delay_records;
+
+CREATE INDEX IF NOT EXISTS idx_delay_records_train ON delay_records(train_number);
+
+CREATE INDEX IF NOT EXISTS idx_delay_records_date ON delay_records(date);
+
+CREATE INDEX IF NOT EXISTS idx_delay_records_analytics ON delay_records(train_number, date, delay);
+
+CREATE TABLE stop_records_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    train_number TEXT NOT NULL,
+    origin_code TEXT NOT NULL DEFAULT '',
+    date DATE NOT NULL,
+    station_code TEXT NOT NULL,
+    station_name TEXT NOT NULL,
+    stop_index INTEGER NOT NULL,
+    scheduled_arrival TIMESTAMP,
+    actual_arrival TIMESTAMP,
+    scheduled_departure TIMESTAMP,
+    actual_departure TIMESTAMP,
+    arrival_delay INTEGER NOT NULL DEFAULT 0,
+    departure_delay INTEGER NOT NULL DEFAULT 0,
+    platform TEXT,
+    platform_confirmed BOOLEAN DEFAULT FALSE,
+    source TEXT DEFAULT 'viaggiatreno',
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    -- One row per stop of a train run
+    UNIQUE(train_number, origin_code, date, station_code, source)
+);
+
+INSERT INTO stop_records_new (
+    id, train_number, date, station_code, station_name, stop_index,
+    scheduled_arrival, actual_arrival, scheduled_departure, actual_departure,
+    arrival_delay, departure_delay, platform, platform_confirmed, source, recorded_at
+)
+SELECT
+    id, train_number, date, station_code, station_name, stop_index,
+    scheduled_arrival, actual_arrival, scheduled_departure, actual_departure,
+    arrival_delay, departure_delay, platform, platform_confirmed, source, recorded_at
+FROM stop_records;
+
+DROP TABLE stop_records;
+
+ALTER TABLE stop_records_new RENAME TO stop_records;
+
+CREATE INDEX IF NOT EXISTS idx_stop_records_train_station ON stop_records(train_number, station_code);
+
+CREATE INDEX IF NOT EXISTS idx_stop_records_station_date ON stop_records(station_code, date);
@@ -0,0 +1 @@
+ALTER TABLE delay_records DROP COLUMN status;
@@ -0,0 +1,3 @@
+-- The train's status when recorded, so partial cancellations and reroutes
+-- show up in history and statistics. Older rows keep an empty status.
+ALTER TABLE delay_records ADD COLUMN status TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE stop_records DROP COLUMN scheduled_platform;
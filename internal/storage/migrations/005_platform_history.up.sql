@@ -0,0 +1,3 @@
+-- The timetabled platform of each recorded stop, kept beside the actual one
+-- so platform changes can be counted. Older rows have none.
+ALTER TABLE stop_records ADD COLUMN scheduled_platform TEXT;
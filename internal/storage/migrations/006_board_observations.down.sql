@@ -0,0 +1,3 @@
+DROP VIEW IF EXISTS observed_runs;
+
+DROP TABLE IF EXISTS board_observations;
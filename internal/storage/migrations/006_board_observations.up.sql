@@ -0,0 +1,62 @@
+-- Trains seen on the departure and arrival boards of recorded stations. A
+-- train keeps one row per board it appears on, updated by later snapshots.
+CREATE TABLE IF NOT EXISTS board_observations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    train_number TEXT NOT NULL,
+    origin_code TEXT NOT NULL DEFAULT '',
+    train_category TEXT,
+    station_code TEXT NOT NULL,
+    station_name TEXT NOT NULL,
+    -- departure or arrival
+    kind TEXT NOT NULL,
+    -- Origin of the train on arrival boards, destination on departure boards
+    origin TEXT,
+    destination TEXT,
+    -- Day of the scheduled time at the station, in Rome
+    date DATE NOT NULL,
+    scheduled_time TIMESTAMP NOT NULL,
+    delay INTEGER NOT NULL DEFAULT 0,
+    platform TEXT,
+    scheduled_platform TEXT,
+    status TEXT NOT NULL DEFAULT '',
+    source TEXT,
+    observed_at TIMESTAMP NOT NULL,
+
+    UNIQUE(train_number, origin_code, station_code, kind, scheduled_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_board_observations_train_date ON board_observations(train_number, date);
+
+CREATE INDEX IF NOT EXISTS idx_board_observations_station_date ON board_observations(station_code, date);
+
+-- One run per train and day known only from board observations: the last
+-- board the train was seen on, which is closest to its final delay. Runs
+-- with a delay record are left out, the record being authoritative.
+CREATE VIEW IF NOT EXISTS observed_runs AS
+SELECT
+    train_number, origin_code, train_category, origin, destination,
+    date, delay, status, source, observed_at
+FROM (
+    SELECT
+        o.train_number,
+        o.origin_code,
+        o.train_category,
+        COALESCE(MAX(o.origin) OVER train_days, '') AS origin,
+        COALESCE(MAX(o.destination) OVER train_days, '') AS destination,
+        o.date,
+        o.delay,
+        o.status,
+        o.source,
+        o.observed_at,
+        ROW_NUMBER() OVER (
+            PARTITION BY o.train_number, o.origin_code, o.date
+            ORDER BY o.scheduled_time DESC, o.kind
+        ) AS latest
+    FROM board_observations o
+    WINDOW train_days AS (PARTITION BY o.train_number, o.origin_code)
+) runs
+WHERE latest = 1
+AND NOT EXISTS (
+    SELECT 1 FROM delay_records d
+    WHERE d.train_number = runs.train_number AND d.date = runs.date
+)
@@ -0,0 +1,18 @@
+-- Every poll of a train run, to follow how its delay builds up along the
+-- journey. delay_records keeps only the last one.
+CREATE TABLE IF NOT EXISTS delay_observations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    train_number TEXT NOT NULL,
+    origin_code TEXT NOT NULL DEFAULT '',
+    date DATE NOT NULL,
+    observed_at TIMESTAMP NOT NULL,
+    delay INTEGER NOT NULL DEFAULT 0,
+    -- Station the train was last detected at, empty before departure
+    last_station TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT '',
+    source TEXT,
+
+    UNIQUE(train_number, origin_code, date, observed_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_delay_observations_train_date ON delay_observations(train_number, date);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_delay_records_completeness;
+
+ALTER TABLE delay_records DROP COLUMN completeness;
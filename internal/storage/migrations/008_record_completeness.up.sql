@@ -0,0 +1,6 @@
+-- How far along a run was when recorded: not_departed, en_route or arrived.
+-- Only arrived records hold a final delay. Older rows keep an empty value
+-- and are taken as final.
+ALTER TABLE delay_records ADD COLUMN completeness TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_delay_records_completeness ON delay_records(completeness, date);
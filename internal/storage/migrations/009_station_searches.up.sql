@@ -0,0 +1,6 @@
+-- Station searches the provider has answered. Their results are kept in
+-- stations, so repeating a recent one is served from there.
+CREATE TABLE IF NOT EXISTS station_searches (
+    query TEXT PRIMARY KEY,
+    searched_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+ALTER TABLE stop_records DROP COLUMN platform_source;
+ALTER TABLE stop_records DROP COLUMN stop_source;
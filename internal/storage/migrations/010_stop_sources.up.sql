@@ -0,0 +1,6 @@
+-- The providers that supplied a stop, when merged from another than the one
+-- the run is recorded under: stop_source for its times and delays,
+-- platform_source for its platform. Older rows leave them empty, meaning the
+-- run source.
+ALTER TABLE stop_records ADD COLUMN stop_source TEXT;
+ALTER TABLE stop_records ADD COLUMN platform_source TEXT;
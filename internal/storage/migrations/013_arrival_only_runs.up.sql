@@ -0,0 +1,47 @@
+-- A run never seen on a departure board has no known destination, yet the
+-- station it arrives at without leaving is its destination. Such a run is
+-- final once its last board is an arrival board, and takes the name of
+-- that station as its destination.
+DROP VIEW IF EXISTS observed_runs;
+
+CREATE VIEW observed_runs AS
+SELECT
+    train_number, origin_code, train_category, origin, destination,
+    date, delay, status, source, observed_at, completeness
+FROM (
+    SELECT
+        o.train_number,
+        o.origin_code,
+        o.train_category,
+        COALESCE(MAX(o.origin) OVER train_days, '') AS origin,
+        COALESCE(
+            MAX(o.destination) OVER train_days,
+            CASE WHEN o.kind = 'arrival' THEN o.station_name END,
+            ''
+        ) AS destination,
+        o.date,
+        o.delay,
+        o.status,
+        o.source,
+        o.observed_at,
+        CAST(CASE
+            WHEN o.status IN ('arrived', 'cancelled') THEN 'arrived'
+            WHEN o.kind = 'arrival' AND MAX(o.destination) OVER train_days IS NULL THEN 'arrived'
+            WHEN o.kind = 'arrival'
+                AND UPPER(o.station_name) = UPPER(MAX(o.destination) OVER train_days) THEN 'arrived'
+            ELSE 'en_route'
+        END AS TEXT) AS completeness,
+        ROW_NUMBER() OVER (
+            PARTITION BY o.train_number, o.origin_code, o.date
+            ORDER BY o.scheduled_time DESC, o.kind
+        ) AS latest
+    FROM board_observations o
+    WINDOW train_days AS (PARTITION BY o.train_number, o.origin_code)
+) runs
+WHERE latest = 1
+AND NOT EXISTS (
+    SELECT 1 FROM delay_records d
+    WHERE d.train_number = runs.train_number
+    AND (d.origin_code = runs.origin_code OR d.origin_code = '' OR runs.origin_code = '')
+    AND d.date = runs.date
+)
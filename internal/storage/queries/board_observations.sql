@@ -0,0 +1,24 @@
+-- name: InsertBoardObservation :exec
+INSERT INTO board_observations (
+    train_number, origin_code, train_category, station_code, station_name, kind,
+    origin, destination, date, scheduled_time, delay, platform, scheduled_platform,
+    status, source, observed_at
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(train_number, origin_code, station_code, kind, scheduled_time) DO UPDATE SET
+    train_category = excluded.train_category,
+    station_name = excluded.station_name,
+    origin = excluded.origin,
+    destination = excluded.destination,
+    delay = excluded.delay,
+    platform = excluded.platform,
+    scheduled_platform = excluded.scheduled_platform,
+    status = excluded.status,
+    source = excluded.source,
+    observed_at = excluded.observed_at;
+
+-- name: GetObservedRunsByTrain :many
+SELECT * FROM observed_runs
+WHERE train_number = sqlc.arg(train_number)
+AND (CAST(sqlc.arg(origin_code) AS TEXT) = '' OR origin_code = sqlc.arg(origin_code))
+ORDER BY date DESC;
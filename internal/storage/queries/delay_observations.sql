@@ -0,0 +1,13 @@
+-- name: InsertDelayObservation :exec
+INSERT INTO delay_observations (
+    train_number, origin_code, date, observed_at, delay, last_station, status, source
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(train_number, origin_code, date, observed_at) DO NOTHING;
+
+-- name: GetDelayObservations :many
+SELECT * FROM delay_observations
+WHERE train_number = sqlc.arg(train_number)
+AND (CAST(sqlc.arg(origin_code) AS TEXT) = '' OR origin_code = sqlc.arg(origin_code))
+AND date = sqlc.arg(date)
+ORDER BY observed_at;
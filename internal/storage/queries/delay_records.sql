@@ -1,16 +1,27 @@
--- name: InsertDelayRecord :exec
-INSERT INTO delay_records (train_number, train_category, origin, destination, date, delay, cancelled, source)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT(train_number, date, source) DO UPDATE SET
+-- name: InsertDelayRecord :execrows
+INSERT INTO delay_records (train_number, origin_code, train_category, origin, destination, date, delay, cancelled, source, status, completeness)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(train_number, origin_code, date, source) DO UPDATE SET
     delay = excluded.delay,
     cancelled = excluded.cancelled,
-    recorded_at = CURRENT_TIMESTAMP;
+    status = excluded.status,
+    completeness = excluded.completeness,
+    recorded_at = CURRENT_TIMESTAMP
+WHERE delay_records.completeness NOT IN ('', 'arrived')
+    OR excluded.completeness IN ('', 'arrived');
 
 -- name: GetDelayRecordsByTrain :many
 SELECT * FROM delay_records
-WHERE train_number = ?
+WHERE train_number = sqlc.arg(train_number)
+AND (CAST(sqlc.arg(origin_code) AS TEXT) = '' OR origin_code = sqlc.arg(origin_code))
 ORDER BY date DESC;
 
+-- name: GetProvisionalDelayRecords :many
+SELECT * FROM delay_records
+WHERE completeness IN ('not_departed', 'en_route')
+AND date >= ?
+ORDER BY date, train_number;
+
 -- name: GetDelayRecordsByTrainInRange :many
 SELECT * FROM delay_records
 WHERE train_number = sqlc.arg(train_number)
@@ -25,45 +36,95 @@ ORDER BY date DESC, train_number;
 -- name: GetTrainStats :one
 SELECT
     train_number,
-    COUNT(*) as total_trips,
-    SUM(CASE WHEN delay <= 5 AND cancelled = FALSE THEN 1 ELSE 0 END) as on_time_trips,
-    SUM(CASE WHEN delay > 5 AND cancelled = FALSE THEN 1 ELSE 0 END) as delayed_trips,
-    SUM(CASE WHEN cancelled = TRUE THEN 1 ELSE 0 END) as cancelled_trips,
-    AVG(CASE WHEN cancelled = FALSE THEN delay ELSE NULL END) as average_delay,
-    MAX(CASE WHEN cancelled = FALSE THEN delay ELSE NULL END) as max_delay
-FROM delay_records
-WHERE train_number = ?
+    COUNT(CASE WHEN final THEN 1 END) as total_trips,
+    SUM(CASE WHEN final AND delay <= on_time_threshold AND cancelled = FALSE THEN 1 ELSE 0 END) as on_time_trips,
+    SUM(CASE WHEN final AND delay > on_time_threshold AND cancelled = FALSE THEN 1 ELSE 0 END) as delayed_trips,
+    SUM(CASE WHEN final AND cancelled = TRUE THEN 1 ELSE 0 END) as cancelled_trips,
+    SUM(CASE WHEN final AND status = 'partially_cancelled' THEN 1 ELSE 0 END) as partially_cancelled_trips,
+    SUM(CASE WHEN final AND status = 'rerouted' THEN 1 ELSE 0 END) as rerouted_trips,
+    AVG(CASE WHEN final AND cancelled = FALSE THEN delay ELSE NULL END) as average_delay,
+    MAX(CASE WHEN final AND cancelled = FALSE THEN delay ELSE NULL END) as max_delay,
+    COUNT(CASE WHEN NOT final THEN 1 END) as provisional_trips,
+    MAX(on_time_threshold) as on_time_threshold
+FROM (
+    SELECT runs.*, COALESCE(
+        (SELECT value FROM json_each(CAST(sqlc.arg(category_thresholds) AS TEXT)) WHERE key = UPPER(runs.train_category)),
+        (SELECT value FROM json_each(CAST(sqlc.arg(provider_thresholds) AS TEXT)) WHERE key = LOWER(runs.source)),
+        CAST(sqlc.arg(default_threshold) AS INTEGER)
+    ) AS on_time_threshold
+    FROM (
+        SELECT train_number, origin_code, train_category, source, delay, cancelled, status, completeness IN ('', 'arrived') AS final FROM delay_records
+        UNION ALL
+        SELECT train_number, origin_code, train_category, source, delay, status = 'cancelled', status, completeness IN ('', 'arrived') FROM observed_runs
+    ) runs
+) runs
+WHERE train_number = sqlc.arg(train_number)
+AND (CAST(sqlc.arg(origin_code) AS TEXT) = '' OR origin_code = sqlc.arg(origin_code))
 GROUP BY train_number;
 
+-- name: GetTrainDelays :many
+SELECT delay FROM (
+    SELECT train_number, origin_code, delay, cancelled FROM delay_records
+    WHERE completeness IN ('', 'arrived')
+    UNION ALL
+    SELECT train_number, origin_code, delay, status = 'cancelled' FROM observed_runs
+    WHERE completeness IN ('', 'arrived')
+) runs
+WHERE train_number = sqlc.arg(train_number)
+AND (CAST(sqlc.arg(origin_code) AS TEXT) = '' OR origin_code = sqlc.arg(origin_code))
+AND cancelled = FALSE
+ORDER BY delay;
+
 -- name: GetMostDelayedTrains :many
 SELECT
     train_number,
-    train_category,
-    origin,
-    destination,
+    origin_code,
+    CAST(COALESCE(MAX(train_category), '') AS TEXT) as train_category,
+    CAST(MAX(origin) AS TEXT) as origin,
+    CAST(MAX(destination) AS TEXT) as destination,
     COUNT(*) as trip_count,
     AVG(delay) as avg_delay,
     MAX(delay) as max_delay
-FROM delay_records
+FROM (
+    SELECT train_number, origin_code, train_category, origin, destination, date, delay, cancelled FROM delay_records
+    WHERE completeness IN ('', 'arrived')
+    UNION ALL
+    SELECT train_number, origin_code, train_category, origin, destination, date, delay, status = 'cancelled' FROM observed_runs
+    WHERE completeness IN ('', 'arrived')
+) runs
 WHERE date BETWEEN sqlc.arg(from_date) AND sqlc.arg(to_date)
 AND cancelled = FALSE
-GROUP BY train_number, train_category, origin, destination
+GROUP BY train_number, origin_code
 ORDER BY avg_delay DESC
 LIMIT sqlc.arg(limit_count);
 
 -- name: GetMostReliableTrains :many
 SELECT
     train_number,
-    train_category,
-    origin,
-    destination,
+    origin_code,
+    CAST(COALESCE(MAX(train_category), '') AS TEXT) as train_category,
+    CAST(MAX(origin) AS TEXT) as origin,
+    CAST(MAX(destination) AS TEXT) as destination,
     COUNT(*) as trip_count,
     AVG(delay) as avg_delay,
-    SUM(CASE WHEN delay <= 5 THEN 1 ELSE 0 END) * 100.0 / COUNT(*) as on_time_rate
-FROM delay_records
+    SUM(CASE WHEN delay <= on_time_threshold THEN 1 ELSE 0 END) * 100.0 / COUNT(*) as on_time_rate
+FROM (
+    SELECT runs.*, COALESCE(
+        (SELECT value FROM json_each(CAST(sqlc.arg(category_thresholds) AS TEXT)) WHERE key = UPPER(runs.train_category)),
+        (SELECT value FROM json_each(CAST(sqlc.arg(provider_thresholds) AS TEXT)) WHERE key = LOWER(runs.source)),
+        CAST(sqlc.arg(default_threshold) AS INTEGER)
+    ) AS on_time_threshold
+    FROM (
+        SELECT train_number, origin_code, train_category, origin, destination, source, date, delay, cancelled FROM delay_records
+        WHERE completeness IN ('', 'arrived')
+        UNION ALL
+        SELECT train_number, origin_code, train_category, origin, destination, source, date, delay, status = 'cancelled' FROM observed_runs
+        WHERE completeness IN ('', 'arrived')
+    ) runs
+) runs
 WHERE date BETWEEN sqlc.arg(from_date) AND sqlc.arg(to_date)
 AND cancelled = FALSE
-GROUP BY train_number, train_category, origin, destination
+GROUP BY train_number, origin_code
 HAVING COUNT(*) >= 5
 ORDER BY on_time_rate DESC, avg_delay ASC
 LIMIT sqlc.arg(limit_count);
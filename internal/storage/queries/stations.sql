@@ -17,3 +17,17 @@ SELECT * FROM stations WHERE name LIKE ? LIMIT 20;
 
 -- name: ListStations :many
 SELECT * FROM stations ORDER BY name;
+
+-- name: InsertStationIfMissing :exec
+INSERT INTO stations (code, name)
+VALUES (?, ?)
+ON CONFLICT(code) DO NOTHING;
+
+-- name: InsertStationSearch :exec
+INSERT INTO station_searches (query)
+VALUES (?)
+ON CONFLICT(query) DO UPDATE SET searched_at = CURRENT_TIMESTAMP;
+
+-- name: CountRecentStationSearches :one
+SELECT COUNT(*) FROM station_searches
+WHERE query = ? AND searched_at > datetime('now', '-30 days');
@@ -0,0 +1,74 @@
+-- name: InsertStopRecord :exec
+INSERT INTO stop_records (
+    train_number, origin_code, date, station_code, station_name, stop_index,
+    scheduled_arrival, actual_arrival, scheduled_departure, actual_departure,
+    arrival_delay, departure_delay, platform, platform_confirmed, source,
+    scheduled_platform, stop_source, platform_source
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(train_number, origin_code, date, station_code, source) DO UPDATE SET
+    station_name = excluded.station_name,
+    stop_index = excluded.stop_index,
+    scheduled_arrival = excluded.scheduled_arrival,
+    actual_arrival = excluded.actual_arrival,
+    scheduled_departure = excluded.scheduled_departure,
+    actual_departure = excluded.actual_departure,
+    arrival_delay = excluded.arrival_delay,
+    departure_delay = excluded.departure_delay,
+    platform = excluded.platform,
+    platform_confirmed = excluded.platform_confirmed,
+    scheduled_platform = excluded.scheduled_platform,
+    stop_source = excluded.stop_source,
+    platform_source = excluded.platform_source,
+    recorded_at = CURRENT_TIMESTAMP;
+
+-- name: GetStopRecordsByTrainAndDate :many
+SELECT * FROM stop_records
+WHERE train_number = ? AND date = ?
+ORDER BY stop_index;
+
+-- name: GetStopRecordsByTrainAndStation :many
+SELECT * FROM stop_records
+WHERE train_number = sqlc.arg(train_number)
+AND (CAST(sqlc.arg(origin_code) AS TEXT) = '' OR origin_code = sqlc.arg(origin_code))
+AND station_code = sqlc.arg(station_code)
+ORDER BY date DESC;
+
+-- name: GetStopStats :one
+SELECT
+    s.train_number,
+    s.station_code,
+    COUNT(*) as total_stops,
+    SUM(CASE WHEN s.arrival_delay <= COALESCE(
+        (SELECT value FROM json_each(CAST(sqlc.arg(category_thresholds) AS TEXT)) WHERE key = UPPER(d.train_category)),
+        (SELECT value FROM json_each(CAST(sqlc.arg(provider_thresholds) AS TEXT)) WHERE key = LOWER(s.source)),
+        CAST(sqlc.arg(default_threshold) AS INTEGER)
+    ) THEN 1 ELSE 0 END) as on_time_stops,
+    AVG(s.arrival_delay) as average_arrival_delay,
+    MAX(s.arrival_delay) as max_arrival_delay,
+    AVG(s.departure_delay) as average_departure_delay
+FROM stop_records s
+LEFT JOIN delay_records d
+    ON d.train_number = s.train_number AND d.origin_code = s.origin_code
+    AND d.date = s.date AND d.source = s.source
+WHERE s.train_number = sqlc.arg(train_number)
+AND (CAST(sqlc.arg(origin_code) AS TEXT) = '' OR s.origin_code = sqlc.arg(origin_code))
+AND s.station_code = sqlc.arg(station_code)
+AND NOT (
+    s.actual_arrival IS NULL AND s.actual_departure IS NULL
+    AND COALESCE(d.completeness, '') IN ('not_departed', 'en_route')
+)
+GROUP BY s.train_number, s.station_code;
+
+-- name: GetPlatformUsage :many
+SELECT
+    platform,
+    COUNT(*) as uses,
+    SUM(CASE WHEN scheduled_platform IS NOT NULL AND scheduled_platform != '' AND platform != scheduled_platform THEN 1 ELSE 0 END) as changes
+FROM stop_records
+WHERE train_number = sqlc.arg(train_number)
+    AND (CAST(sqlc.arg(origin_code) AS TEXT) = '' OR origin_code = sqlc.arg(origin_code))
+    AND station_code = sqlc.arg(station_code)
+    AND platform IS NOT NULL AND platform != '' AND platform_confirmed
+GROUP BY platform
+ORDER BY uses DESC, MAX(date) DESC;
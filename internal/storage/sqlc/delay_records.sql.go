@@ -12,7 +12,7 @@ import (
 )
 
 const getDelayRecordsByDateRange = `-- name: GetDelayRecordsByDateRange :many
-SELECT id, train_number, train_category, origin, destination, date, delay, cancelled, source, recorded_at FROM delay_records
+SELECT id, train_number, origin_code, train_category, origin, destination, date, delay, cancelled, source, recorded_at, status, completeness FROM delay_records
 WHERE date BETWEEN ?1 AND ?2
 ORDER BY date DESC, train_number
 `
@@ -34,6 +34,7 @@ func (q *Queries) GetDelayRecordsByDateRange(ctx context.Context, arg GetDelayRe
 		if err := rows.Scan(
 			&i.ID,
 			&i.TrainNumber,
+			&i.OriginCode,
 			&i.TrainCategory,
 			&i.Origin,
 			&i.Destination,
@@ -42,6 +43,8 @@ func (q *Queries) GetDelayRecordsByDateRange(ctx context.Context, arg GetDelayRe
 			&i.Cancelled,
 			&i.Source,
 			&i.RecordedAt,
+			&i.Status,
+			&i.Completeness,
 		); err != nil {
 			return nil, err
 		}
@@ -57,13 +60,19 @@ func (q *Queries) GetDelayRecordsByDateRange(ctx context.Context, arg GetDelayRe
 }
 
 const getDelayRecordsByTrain = `-- name: GetDelayRecordsByTrain :many
-SELECT id, train_number, train_category, origin, destination, date, delay, cancelled, source, recorded_at FROM delay_records
-WHERE train_number = ?
+SELECT id, train_number, origin_code, train_category, origin, destination, date, delay, cancelled, source, recorded_at, status, completeness FROM delay_records
+WHERE train_number = ?1
+AND (CAST(?2 AS TEXT) = '' OR origin_code = ?2)
 ORDER BY date DESC
 `
 
-func (q *Queries) GetDelayRecordsByTrain(ctx context.Context, trainNumber string) ([]DelayRecord, error) {
-	rows, err := q.db.QueryContext(ctx, getDelayRecordsByTrain, trainNumber)
+type GetDelayRecordsByTrainParams struct {
+	TrainNumber string `json:"train_number"`
+	OriginCode  string `json:"origin_code"`
+}
+
+func (q *Queries) GetDelayRecordsByTrain(ctx context.Context, arg GetDelayRecordsByTrainParams) ([]DelayRecord, error) {
+	rows, err := q.db.QueryContext(ctx, getDelayRecordsByTrain, arg.TrainNumber, arg.OriginCode)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +83,7 @@ func (q *Queries) GetDelayRecordsByTrain(ctx context.Context, trainNumber string
 		if err := rows.Scan(
 			&i.ID,
 			&i.TrainNumber,
+			&i.OriginCode,
 			&i.TrainCategory,
 			&i.Origin,
 			&i.Destination,
@@ -82,6 +92,8 @@ func (q *Queries) GetDelayRecordsByTrain(ctx context.Context, trainNumber string
 			&i.Cancelled,
 			&i.Source,
 			&i.RecordedAt,
+			&i.Status,
+			&i.Completeness,
 		); err != nil {
 			return nil, err
 		}
@@ -97,7 +109,7 @@ func (q *Queries) GetDelayRecordsByTrain(ctx context.Context, trainNumber string
 }
 
 const getDelayRecordsByTrainInRange = `-- name: GetDelayRecordsByTrainInRange :many
-SELECT id, train_number, train_category, origin, destination, date, delay, cancelled, source, recorded_at FROM delay_records
+SELECT id, train_number, origin_code, train_category, origin, destination, date, delay, cancelled, source, recorded_at, status, completeness FROM delay_records
 WHERE train_number = ?1
 AND date BETWEEN ?2 AND ?3
 ORDER BY date DESC
@@ -115,6 +127,7 @@ func (q *Queries) GetDelayRecordsByTrainInRange(ctx context.Context, trainNumber
 		if err := rows.Scan(
 			&i.ID,
 			&i.TrainNumber,
+			&i.OriginCode,
 			&i.TrainCategory,
 			&i.Origin,
 			&i.Destination,
@@ -123,6 +136,8 @@ func (q *Queries) GetDelayRecordsByTrainInRange(ctx context.Context, trainNumber
 			&i.Cancelled,
 			&i.Source,
 			&i.RecordedAt,
+			&i.Status,
+			&i.Completeness,
 		); err != nil {
 			return nil, err
 		}
@@ -140,16 +155,23 @@ func (q *Queries) GetDelayRecordsByTrainInRange(ctx context.Context, trainNumber
 const getMostDelayedTrains = `-- name: GetMostDelayedTrains :many
 SELECT
     train_number,
-    train_category,
-    origin,
-    destination,
+    origin_code,
+    CAST(COALESCE(MAX(train_category), '') AS TEXT) as train_category,
+    CAST(MAX(origin) AS TEXT) as origin,
+    CAST(MAX(destination) AS TEXT) as destination,
     COUNT(*) as trip_count,
     AVG(delay) as avg_delay,
     MAX(delay) as max_delay
-FROM delay_records
+FROM (
+    SELECT train_number, origin_code, train_category, origin, destination, date, delay, cancelled FROM delay_records
+    WHERE completeness IN ('', 'arrived')
+    UNION ALL
+    SELECT train_number, origin_code, train_category, origin, destination, date, delay, status = 'cancelled' FROM observed_runs
+    WHERE completeness IN ('', 'arrived')
+) runs
 WHERE date BETWEEN ?1 AND ?2
 AND cancelled = FALSE
-GROUP BY train_number, train_category, origin, destination
+GROUP BY train_number, origin_code
 ORDER BY avg_delay DESC
 LIMIT ?3
 `
@@ -162,7 +184,8 @@ type GetMostDelayedTrainsParams struct {
 
 type GetMostDelayedTrainsRow struct {
 	TrainNumber   string          `json:"train_number"`
-	TrainCategory sql.NullString  `json:"train_category"`
+	OriginCode    string          `json:"origin_code"`
+	TrainCategory string          `json:"train_category"`
 	Origin        string          `json:"origin"`
 	Destination   string          `json:"destination"`
 	TripCount     int64           `json:"trip_count"`
@@ -181,6 +204,7 @@ func (q *Queries) GetMostDelayedTrains(ctx context.Context, arg GetMostDelayedTr
 		var i GetMostDelayedTrainsRow
 		if err := rows.Scan(
 			&i.TrainNumber,
+			&i.OriginCode,
 			&i.TrainCategory,
 			&i.Origin,
 			&i.Destination,
@@ -204,30 +228,48 @@ func (q *Queries) GetMostDelayedTrains(ctx context.Context, arg GetMostDelayedTr
 const getMostReliableTrains = `-- name: GetMostReliableTrains :many
 SELECT
     train_number,
-    train_category,
-    origin,
-    destination,
+    origin_code,
+    CAST(COALESCE(MAX(train_category), '') AS TEXT) as train_category,
+    CAST(MAX(origin) AS TEXT) as origin,
+    CAST(MAX(destination) AS TEXT) as destination,
     COUNT(*) as trip_count,
     AVG(delay) as avg_delay,
-    SUM(CASE WHEN delay <= 5 THEN 1 ELSE 0 END) * 100.0 / COUNT(*) as on_time_rate
-FROM delay_records
-WHERE date BETWEEN ?1 AND ?2
+    SUM(CASE WHEN delay <= on_time_threshold THEN 1 ELSE 0 END) * 100.0 / COUNT(*) as on_time_rate
+FROM (
+    SELECT runs.*, COALESCE(
+        (SELECT value FROM json_each(CAST(?1 AS TEXT)) WHERE key = UPPER(runs.train_category)),
+        (SELECT value FROM json_each(CAST(?2 AS TEXT)) WHERE key = LOWER(runs.source)),
+        CAST(?3 AS INTEGER)
+    ) AS on_time_threshold
+    FROM (
+        SELECT train_number, origin_code, train_category, origin, destination, source, date, delay, cancelled FROM delay_records
+        WHERE completeness IN ('', 'arrived')
+        UNION ALL
+        SELECT train_number, origin_code, train_category, origin, destination, source, date, delay, status = 'cancelled' FROM observed_runs
+        WHERE completeness IN ('', 'arrived')
+    ) runs
+) runs
+WHERE date BETWEEN ?4 AND ?5
 AND cancelled = FALSE
-GROUP BY train_number, train_category, origin, destination
+GROUP BY train_number, origin_code
 HAVING COUNT(*) >= 5
 ORDER BY on_time_rate DESC, avg_delay ASC
-LIMIT ?3
+LIMIT ?6
 `
 
 type GetMostReliableTrainsParams struct {
-	FromDate   time.Time `json:"from_date"`
-	ToDate     time.Time `json:"to_date"`
-	LimitCount int64     `json:"limit_count"`
+	CategoryThresholds string    `json:"category_thresholds"`
+	ProviderThresholds string    `json:"provider_thresholds"`
+	DefaultThreshold   int64     `json:"default_threshold"`
+	FromDate           time.Time `json:"from_date"`
+	ToDate             time.Time `json:"to_date"`
+	LimitCount         int64     `json:"limit_count"`
 }
 
 type GetMostReliableTrainsRow struct {
 	TrainNumber   string          `json:"train_number"`
-	TrainCategory sql.NullString  `json:"train_category"`
+	OriginCode    string          `json:"origin_code"`
+	TrainCategory string          `json:"train_category"`
 	Origin        string          `json:"origin"`
 	Destination   string          `json:"destination"`
 	TripCount     int64           `json:"trip_count"`
@@ -236,7 +278,14 @@ type GetMostReliableTrainsRow struct {
 }
 
 func (q *Queries) GetMostReliableTrains(ctx context.Context, arg GetMostReliableTrainsParams) ([]GetMostReliableTrainsRow, error) {
-	rows, err := q.db.QueryContext(ctx, getMostReliableTrains, arg.FromDate, arg.ToDate, arg.LimitCount)
+	rows, err := q.db.QueryContext(ctx, getMostReliableTrains,
+		arg.CategoryThresholds,
+		arg.ProviderThresholds,
+		arg.DefaultThreshold,
+		arg.FromDate,
+		arg.ToDate,
+		arg.LimitCount,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -246,6 +295,7 @@ func (q *Queries) GetMostReliableTrains(ctx context.Context, arg GetMostReliable
 		var i GetMostReliableTrainsRow
 		if err := rows.Scan(
 			&i.TrainNumber,
+			&i.OriginCode,
 			&i.TrainCategory,
 			&i.Origin,
 			&i.Destination,
@@ -266,32 +316,152 @@ func (q *Queries) GetMostReliableTrains(ctx context.Context, arg GetMostReliable
 	return items, nil
 }
 
+const getProvisionalDelayRecords = `-- name: GetProvisionalDelayRecords :many
+SELECT id, train_number, origin_code, train_category, origin, destination, date, delay, cancelled, source, recorded_at, status, completeness FROM delay_records
+WHERE completeness IN ('not_departed', 'en_route')
+AND date >= ?
+ORDER BY date, train_number
+`
+
+func (q *Queries) GetProvisionalDelayRecords(ctx context.Context, date time.Time) ([]DelayRecord, error) {
+	rows, err := q.db.QueryContext(ctx, getProvisionalDelayRecords, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DelayRecord{}
+	for rows.Next() {
+		var i DelayRecord
+		if err := rows.Scan(
+			&i.ID,
+			&i.TrainNumber,
+			&i.OriginCode,
+			&i.TrainCategory,
+			&i.Origin,
+			&i.Destination,
+			&i.Date,
+			&i.Delay,
+			&i.Cancelled,
+			&i.Source,
+			&i.RecordedAt,
+			&i.Status,
+			&i.Completeness,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTrainDelays = `-- name: GetTrainDelays :many
+SELECT delay FROM (
+    SELECT train_number, origin_code, delay, cancelled FROM delay_records
+    WHERE completeness IN ('', 'arrived')
+    UNION ALL
+    SELECT train_number, origin_code, delay, status = 'cancelled' FROM observed_runs
+    WHERE completeness IN ('', 'arrived')
+) runs
+WHERE train_number = ?1
+AND (CAST(?2 AS TEXT) = '' OR origin_code = ?2)
+AND cancelled = FALSE
+ORDER BY delay
+`
+
+type GetTrainDelaysParams struct {
+	TrainNumber string `json:"train_number"`
+	OriginCode  string `json:"origin_code"`
+}
+
+func (q *Queries) GetTrainDelays(ctx context.Context, arg GetTrainDelaysParams) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getTrainDelays, arg.TrainNumber, arg.OriginCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var delay int64
+		if err := rows.Scan(&delay); err != nil {
+			return nil, err
+		}
+		items = append(items, delay)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getTrainStats = `-- name: GetTrainStats :one
 SELECT
     train_number,
-    COUNT(*) as total_trips,
-    SUM(CASE WHEN delay <= 5 AND cancelled = FALSE THEN 1 ELSE 0 END) as on_time_trips,
-    SUM(CASE WHEN delay > 5 AND cancelled = FALSE THEN 1 ELSE 0 END) as delayed_trips,
-    SUM(CASE WHEN cancelled = TRUE THEN 1 ELSE 0 END) as cancelled_trips,
-    AVG(CASE WHEN cancelled = FALSE THEN delay ELSE NULL END) as average_delay,
-    MAX(CASE WHEN cancelled = FALSE THEN delay ELSE NULL END) as max_delay
-FROM delay_records
-WHERE train_number = ?
+    COUNT(CASE WHEN final THEN 1 END) as total_trips,
+    SUM(CASE WHEN final AND delay <= on_time_threshold AND cancelled = FALSE THEN 1 ELSE 0 END) as on_time_trips,
+    SUM(CASE WHEN final AND delay > on_time_threshold AND cancelled = FALSE THEN 1 ELSE 0 END) as delayed_trips,
+    SUM(CASE WHEN final AND cancelled = TRUE THEN 1 ELSE 0 END) as cancelled_trips,
+    SUM(CASE WHEN final AND status = 'partially_cancelled' THEN 1 ELSE 0 END) as partially_cancelled_trips,
+    SUM(CASE WHEN final AND status = 'rerouted' THEN 1 ELSE 0 END) as rerouted_trips,
+    AVG(CASE WHEN final AND cancelled = FALSE THEN delay ELSE NULL END) as average_delay,
+    MAX(CASE WHEN final AND cancelled = FALSE THEN delay ELSE NULL END) as max_delay,
+    COUNT(CASE WHEN NOT final THEN 1 END) as provisional_trips,
+    MAX(on_time_threshold) as on_time_threshold
+FROM (
+    SELECT runs.*, COALESCE(
+        (SELECT value FROM json_each(CAST(?1 AS TEXT)) WHERE key = UPPER(runs.train_category)),
+        (SELECT value FROM json_each(CAST(?2 AS TEXT)) WHERE key = LOWER(runs.source)),
+        CAST(?3 AS INTEGER)
+    ) AS on_time_threshold
+    FROM (
+        SELECT train_number, origin_code, train_category, source, delay, cancelled, status, completeness IN ('', 'arrived') AS final FROM delay_records
+        UNION ALL
+        SELECT train_number, origin_code, train_category, source, delay, status = 'cancelled', status, completeness IN ('', 'arrived') FROM observed_runs
+    ) runs
+) runs
+WHERE train_number = ?4
+AND (CAST(?5 AS TEXT) = '' OR origin_code = ?5)
 GROUP BY train_number
 `
 
+type GetTrainStatsParams struct {
+	CategoryThresholds string `json:"category_thresholds"`
+	ProviderThresholds string `json:"provider_thresholds"`
+	DefaultThreshold   int64  `json:"default_threshold"`
+	TrainNumber        string `json:"train_number"`
+	OriginCode         string `json:"origin_code"`
+}
+
 type GetTrainStatsRow struct {
-	TrainNumber    string          `json:"train_number"`
-	TotalTrips     int64           `json:"total_trips"`
-	OnTimeTrips    sql.NullFloat64 `json:"on_time_trips"`
-	DelayedTrips   sql.NullFloat64 `json:"delayed_trips"`
-	CancelledTrips sql.NullFloat64 `json:"cancelled_trips"`
-	AverageDelay   sql.NullFloat64 `json:"average_delay"`
-	MaxDelay       interface{}     `json:"max_delay"`
+	TrainNumber             string          `json:"train_number"`
+	TotalTrips              int64           `json:"total_trips"`
+	OnTimeTrips             sql.NullFloat64 `json:"on_time_trips"`
+	DelayedTrips            sql.NullFloat64 `json:"delayed_trips"`
+	CancelledTrips          sql.NullFloat64 `json:"cancelled_trips"`
+	PartiallyCancelledTrips sql.NullFloat64 `json:"partially_cancelled_trips"`
+	ReroutedTrips           sql.NullFloat64 `json:"rerouted_trips"`
+	AverageDelay            sql.NullFloat64 `json:"average_delay"`
+	MaxDelay                interface{}     `json:"max_delay"`
+	ProvisionalTrips        int64           `json:"provisional_trips"`
+	OnTimeThreshold         interface{}     `json:"on_time_threshold"`
 }
 
-func (q *Queries) GetTrainStats(ctx context.Context, trainNumber string) (GetTrainStatsRow, error) {
-	row := q.db.QueryRowContext(ctx, getTrainStats, trainNumber)
+func (q *Queries) GetTrainStats(ctx context.Context, arg GetTrainStatsParams) (GetTrainStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getTrainStats,
+		arg.CategoryThresholds,
+		arg.ProviderThresholds,
+		arg.DefaultThreshold,
+		arg.TrainNumber,
+		arg.OriginCode,
+	)
 	var i GetTrainStatsRow
 	err := row.Scan(
 		&i.TrainNumber,
@@ -299,23 +469,32 @@ func (q *Queries) GetTrainStats(ctx context.Context, trainNumber string) (GetTra
 		&i.OnTimeTrips,
 		&i.DelayedTrips,
 		&i.CancelledTrips,
+		&i.PartiallyCancelledTrips,
+		&i.ReroutedTrips,
 		&i.AverageDelay,
 		&i.MaxDelay,
+		&i.ProvisionalTrips,
+		&i.OnTimeThreshold,
 	)
 	return i, err
 }
 
-const insertDelayRecord = `-- name: InsertDelayRecord :exec
-INSERT INTO delay_records (train_number, train_category, origin, destination, date, delay, cancelled, source)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT(train_number, date, source) DO UPDATE SET
+const insertDelayRecord = `-- name: InsertDelayRecord :execrows
+INSERT INTO delay_records (train_number, origin_code, train_category, origin, destination, date, delay, cancelled, source, status, completeness)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(train_number, origin_code, date, source) DO UPDATE SET
     delay = excluded.delay,
     cancelled = excluded.cancelled,
+    status = excluded.status,
+    completeness = excluded.completeness,
     recorded_at = CURRENT_TIMESTAMP
+WHERE delay_records.completeness NOT IN ('', 'arrived')
+    OR excluded.completeness IN ('', 'arrived')
 `
 
 type InsertDelayRecordParams struct {
 	TrainNumber   string         `json:"train_number"`
+	OriginCode    string         `json:"origin_code"`
 	TrainCategory sql.NullString `json:"train_category"`
 	Origin        string         `json:"origin"`
 	Destination   string         `json:"destination"`
@@ -323,11 +502,14 @@ type InsertDelayRecordParams struct {
 	Delay         int64          `json:"delay"`
 	Cancelled     sql.NullBool   `json:"cancelled"`
 	Source        sql.NullString `json:"source"`
+	Status        string         `json:"status"`
+	Completeness  string         `json:"completeness"`
 }
 
-func (q *Queries) InsertDelayRecord(ctx context.Context, arg InsertDelayRecordParams) error {
-	_, err := q.db.ExecContext(ctx, insertDelayRecord,
+func (q *Queries) InsertDelayRecord(ctx context.Context, arg InsertDelayRecordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertDelayRecord,
 		arg.TrainNumber,
+		arg.OriginCode,
 		arg.TrainCategory,
 		arg.Origin,
 		arg.Destination,
@@ -335,6 +517,11 @@ func (q *Queries) InsertDelayRecord(ctx context.Context, arg InsertDelayRecordPa
 		arg.Delay,
 		arg.Cancelled,
 		arg.Source,
+		arg.Status,
+		arg.Completeness,
 	)
-	return err
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
@@ -9,9 +9,42 @@ import (
 	"time"
 )
 
+type BoardObservation struct {
+	ID                int64          `json:"id"`
+	TrainNumber       string         `json:"train_number"`
+	OriginCode        string         `json:"origin_code"`
+	TrainCategory     sql.NullString `json:"train_category"`
+	StationCode       string         `json:"station_code"`
+	StationName       string         `json:"station_name"`
+	Kind              string         `json:"kind"`
+	Origin            sql.NullString `json:"origin"`
+	Destination       sql.NullString `json:"destination"`
+	Date              time.Time      `json:"date"`
+	ScheduledTime     time.Time      `json:"scheduled_time"`
+	Delay             int64          `json:"delay"`
+	Platform          sql.NullString `json:"platform"`
+	ScheduledPlatform sql.NullString `json:"scheduled_platform"`
+	Status            string         `json:"status"`
+	Source            sql.NullString `json:"source"`
+	ObservedAt        time.Time      `json:"observed_at"`
+}
+
+type DelayObservation struct {
+	ID          int64          `json:"id"`
+	TrainNumber string         `json:"train_number"`
+	OriginCode  string         `json:"origin_code"`
+	Date        time.Time      `json:"date"`
+	ObservedAt  time.Time      `json:"observed_at"`
+	Delay       int64          `json:"delay"`
+	LastStation string         `json:"last_station"`
+	Status      string         `json:"status"`
+	Source      sql.NullString `json:"source"`
+}
+
 type DelayRecord struct {
 	ID            int64          `json:"id"`
 	TrainNumber   string         `json:"train_number"`
+	OriginCode    string         `json:"origin_code"`
 	TrainCategory sql.NullString `json:"train_category"`
 	Origin        string         `json:"origin"`
 	Destination   string         `json:"destination"`
@@ -20,6 +53,22 @@ type DelayRecord struct {
 	Cancelled     sql.NullBool   `json:"cancelled"`
 	Source        sql.NullString `json:"source"`
 	RecordedAt    sql.NullTime   `json:"recorded_at"`
+	Status        string         `json:"status"`
+	Completeness  string         `json:"completeness"`
+}
+
+type ObservedRun struct {
+	TrainNumber   string         `json:"train_number"`
+	OriginCode    string         `json:"origin_code"`
+	TrainCategory sql.NullString `json:"train_category"`
+	Origin        string         `json:"origin"`
+	Destination   string         `json:"destination"`
+	Date          time.Time      `json:"date"`
+	Delay         int64          `json:"delay"`
+	Status        string         `json:"status"`
+	Source        sql.NullString `json:"source"`
+	ObservedAt    time.Time      `json:"observed_at"`
+	Completeness  string         `json:"completeness"`
 }
 
 type Station struct {
@@ -32,3 +81,31 @@ type Station struct {
 	CreatedAt sql.NullTime    `json:"created_at"`
 	UpdatedAt sql.NullTime    `json:"updated_at"`
 }
+
+type StationSearch struct {
+	Query      string       `json:"query"`
+	SearchedAt sql.NullTime `json:"searched_at"`
+}
+
+type StopRecord struct {
+	ID                 int64          `json:"id"`
+	TrainNumber        string         `json:"train_number"`
+	OriginCode         string         `json:"origin_code"`
+	Date               time.Time      `json:"date"`
+	StationCode        string         `json:"station_code"`
+	StationName        string         `json:"station_name"`
+	StopIndex          int64          `json:"stop_index"`
+	ScheduledArrival   sql.NullTime   `json:"scheduled_arrival"`
+	ActualArrival      sql.NullTime   `json:"actual_arrival"`
+	ScheduledDeparture sql.NullTime   `json:"scheduled_departure"`
+	ActualDeparture    sql.NullTime   `json:"actual_departure"`
+	ArrivalDelay       int64          `json:"arrival_delay"`
+	DepartureDelay     int64          `json:"departure_delay"`
+	Platform           sql.NullString `json:"platform"`
+	PlatformConfirmed  sql.NullBool   `json:"platform_confirmed"`
+	Source             sql.NullString `json:"source"`
+	RecordedAt         sql.NullTime   `json:"recorded_at"`
+	ScheduledPlatform  sql.NullString `json:"scheduled_platform"`
+	StopSource         sql.NullString `json:"stop_source"`
+	PlatformSource     sql.NullString `json:"platform_source"`
+}
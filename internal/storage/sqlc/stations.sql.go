@@ -10,6 +10,18 @@ import (
 	"database/sql"
 )
 
+const countRecentStationSearches = `-- name: CountRecentStationSearches :one
+SELECT COUNT(*) FROM station_searches
+WHERE query = ? AND searched_at > datetime('now', '-30 days')
+`
+
+func (q *Queries) CountRecentStationSearches(ctx context.Context, query string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countRecentStationSearches, query)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const getStation = `-- name: GetStation :one
 SELECT code, name, city, region, latitude, longitude, created_at, updated_at FROM stations WHERE code = ?
 `
@@ -66,6 +78,33 @@ func (q *Queries) GetStationByName(ctx context.Context, name string) ([]Station,
 	return items, nil
 }
 
+const insertStationIfMissing = `-- name: InsertStationIfMissing :exec
+INSERT INTO stations (code, name)
+VALUES (?, ?)
+ON CONFLICT(code) DO NOTHING
+`
+
+type InsertStationIfMissingParams struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+func (q *Queries) InsertStationIfMissing(ctx context.Context, arg InsertStationIfMissingParams) error {
+	_, err := q.db.ExecContext(ctx, insertStationIfMissing, arg.Code, arg.Name)
+	return err
+}
+
+const insertStationSearch = `-- name: InsertStationSearch :exec
+INSERT INTO station_searches (query)
+VALUES (?)
+ON CONFLICT(query) DO UPDATE SET searched_at = CURRENT_TIMESTAMP
+`
+
+func (q *Queries) InsertStationSearch(ctx context.Context, query string) error {
+	_, err := q.db.ExecContext(ctx, insertStationSearch, query)
+	return err
+}
+
 const listStations = `-- name: ListStations :many
 SELECT code, name, city, region, latitude, longitude, created_at, updated_at FROM stations ORDER BY name
 `
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/go-chi/chi/v5"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/live"
+	"github.com/emiliopalmerini/treni/web/templates"
+)
+
+// Comments sent while nothing changes, so proxies keep the stream open
+const heartbeatInterval = 25 * time.Second
+
+// event is a named HTML fragment for the htmx SSE extension's sse-swap
+type event struct {
+	name string
+	body templ.Component
+}
+
+// StationEvents streams the station's departure and arrival boards, now or at
+// ?at=
+func (h *Handlers) StationEvents(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	at, err := boardTime(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := "station:" + code
+	if !at.IsZero() {
+		key += "@" + at.UTC().Format(time.RFC3339)
+	}
+	h.stream(w, r, key, func(ctx context.Context) (any, error) {
+		return h.svc.GetStationAt(ctx, code, at)
+	}, func(v any) []event {
+		station := v.(*domain.Station)
+		return []event{
+			{"departures", templates.DeparturesPartial(station.Departures, code)},
+			{"arrivals", templates.ArrivalsPartial(station.Arrivals, code)},
+		}
+	})
+}
+
+// TrainEvents streams the train's status and stops
+func (h *Handlers) TrainEvents(w http.ResponseWriter, r *http.Request) {
+	ref, err := trainRef(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.stream(w, r, "train:"+ref.String(), func(ctx context.Context) (any, error) {
+		result, err := h.svc.GetTrain(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		return result.Train, nil
+	}, func(v any) []event {
+		train := v.(*domain.Train)
+		return []event{
+			{"status", templates.TrainStatusPartial(train)},
+			{"stops", templates.StopsTable(train.Stops)},
+		}
+	})
+}
+
+// stream subscribes the client to a live topic and writes every update as
+// server-sent events until the client disconnects
+func (h *Handlers) stream(w http.ResponseWriter, r *http.Request, key string, fetch live.Fetcher, render func(any) []event) {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("events: %s: streaming unsupported: %v", key, err)
+		return
+	}
+
+	sub := h.live.Subscribe(key, fetch)
+	defer sub.Close()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case u, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			for _, e := range render(u.Value) {
+				if err := writeEvent(r.Context(), w, e); err != nil {
+					return
+				}
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent renders the fragment and writes it as one SSE event, one data
+// line per line of HTML
+func writeEvent(ctx context.Context, w http.ResponseWriter, e event) error {
+	var buf bytes.Buffer
+	if err := e.body.Render(ctx, &buf); err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "event: %s\n", e.name)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		fmt.Fprintf(&out, "data: %s\n", line)
+	}
+	out.WriteString("\n")
+
+	_, err := fmt.Fprint(w, out.String())
+	return err
+}
@@ -1,20 +1,26 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/live"
 	"github.com/emiliopalmerini/treni/internal/service"
 	"github.com/emiliopalmerini/treni/web/templates"
 )
 
 type Handlers struct {
-	svc *service.Service
+	svc  *service.Service
+	live *live.Hub
 }
 
-func New(svc *service.Service) *Handlers {
-	return &Handlers{svc: svc}
+func New(svc *service.Service, hub *live.Hub) *Handlers {
+	return &Handlers{svc: svc, live: hub}
 }
 
 // Home renders the home page
@@ -39,13 +45,24 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 	templates.SearchResults(stations, query).Render(r.Context(), w)
 }
 
-// Train renders the train page
+// Train renders the train page, or a choice between the trains sharing the
+// number when ?origin= does not pick one. ?date= selects another departure day.
 func (h *Handlers) Train(w http.ResponseWriter, r *http.Request) {
-	number := chi.URLParam(r, "number")
+	ref, err := trainRef(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		templates.ErrorPage("Invalid Date", err.Error()).Render(r.Context(), w)
+		return
+	}
 
-	result, err := h.svc.GetTrain(r.Context(), number)
+	result, err := h.svc.GetTrain(r.Context(), ref)
+	var ambiguous *api.AmbiguousTrainError
+	if errors.As(err, &ambiguous) {
+		templates.TrainChoicePage(ref.Number, ambiguous.Candidates).Render(r.Context(), w)
+		return
+	}
 	if err != nil {
-		templates.ErrorPage("Train Not Found", err.Error()).Render(r.Context(), w)
+		templates.ErrorPage(errorTitle(err, "Train Not Found"), err.Error()).Render(r.Context(), w)
 		return
 	}
 
@@ -54,9 +71,13 @@ func (h *Handlers) Train(w http.ResponseWriter, r *http.Request) {
 
 // TrainStatus returns the train status partial for HTMX refresh
 func (h *Handlers) TrainStatus(w http.ResponseWriter, r *http.Request) {
-	number := chi.URLParam(r, "number")
+	ref, err := trainRef(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	result, err := h.svc.GetTrain(r.Context(), number)
+	result, err := h.svc.GetTrain(r.Context(), ref)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -65,24 +86,35 @@ func (h *Handlers) TrainStatus(w http.ResponseWriter, r *http.Request) {
 	templates.TrainStatusPartial(result.Train).Render(r.Context(), w)
 }
 
-// Station renders the station page
+// Station renders the station page, as it stands now or at ?at=
 func (h *Handlers) Station(w http.ResponseWriter, r *http.Request) {
 	code := chi.URLParam(r, "code")
+	at, err := boardTime(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		templates.ErrorPage("Invalid Time", err.Error()).Render(r.Context(), w)
+		return
+	}
 
-	station, err := h.svc.GetStation(r.Context(), code)
+	station, err := h.svc.GetStationAt(r.Context(), code, at)
 	if err != nil {
-		templates.ErrorPage("Station Not Found", err.Error()).Render(r.Context(), w)
+		templates.ErrorPage(errorTitle(err, "Station Not Found"), err.Error()).Render(r.Context(), w)
 		return
 	}
 
-	templates.StationPage(station).Render(r.Context(), w)
+	templates.StationPage(station, at).Render(r.Context(), w)
 }
 
 // StationDepartures returns the departures partial for HTMX
 func (h *Handlers) StationDepartures(w http.ResponseWriter, r *http.Request) {
 	code := chi.URLParam(r, "code")
+	at, err := boardTime(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	station, err := h.svc.GetStation(r.Context(), code)
+	station, err := h.svc.GetStationAt(r.Context(), code, at)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -94,8 +126,13 @@ func (h *Handlers) StationDepartures(w http.ResponseWriter, r *http.Request) {
 // StationArrivals returns the arrivals partial for HTMX
 func (h *Handlers) StationArrivals(w http.ResponseWriter, r *http.Request) {
 	code := chi.URLParam(r, "code")
+	at, err := boardTime(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	station, err := h.svc.GetStation(r.Context(), code)
+	station, err := h.svc.GetStationAt(r.Context(), code, at)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -104,6 +141,36 @@ func (h *Handlers) StationArrivals(w http.ResponseWriter, r *http.Request) {
 	templates.ArrivalsPartial(station.Arrivals, code).Render(r.Context(), w)
 }
 
+// Journey renders the journey planner, with the direct trains between the
+// two stations once both are given
+func (h *Handlers) Journey(w http.ResponseWriter, r *http.Request) {
+	fromQuery := r.URL.Query().Get("from")
+	toQuery := r.URL.Query().Get("to")
+	if fromQuery == "" || toQuery == "" {
+		templates.JourneyPage(fromQuery, toQuery, nil, false, "").Render(r.Context(), w)
+		return
+	}
+
+	from, err := h.svc.ResolveStation(r.Context(), fromQuery)
+	if err != nil {
+		templates.JourneyPage(fromQuery, toQuery, nil, true, err.Error()).Render(r.Context(), w)
+		return
+	}
+	to, err := h.svc.ResolveStation(r.Context(), toQuery)
+	if err != nil {
+		templates.JourneyPage(fromQuery, toQuery, nil, true, err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	journeys, err := h.svc.FindJourneys(r.Context(), from.Code, to.Code, 10)
+	if err != nil {
+		templates.JourneyPage(fromQuery, toQuery, nil, true, err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	templates.JourneyPage(fromQuery, toQuery, journeys, true, "").Render(r.Context(), w)
+}
+
 // Analytics renders the analytics page
 func (h *Handlers) Analytics(w http.ResponseWriter, r *http.Request) {
 	templates.AnalyticsPage().Render(r.Context(), w)
@@ -136,3 +203,30 @@ func (h *Handlers) NotFound(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 	templates.NotFoundPage().Render(r.Context(), w)
 }
+
+// errorTitle tells a missing train or station apart from a provider outage
+func errorTitle(err error, notFound string) string {
+	if errors.Is(err, api.ErrNotFound) {
+		return notFound
+	}
+	return "Service Unavailable"
+}
+
+// trainRef reads the train from the URL: the number path parameter, an
+// optional ?origin= station code and an optional ?date= departure day
+func trainRef(r *http.Request) (domain.TrainRef, error) {
+	date, err := domain.ParseDate(r.URL.Query().Get("date"), time.Now())
+	if err != nil {
+		return domain.TrainRef{}, err
+	}
+	return domain.TrainRef{
+		Number:     chi.URLParam(r, "number"),
+		OriginCode: r.URL.Query().Get("origin"),
+		Date:       date,
+	}, nil
+}
+
+// boardTime reads the optional ?at= time of a station board
+func boardTime(r *http.Request) (time.Time, error) {
+	return domain.ParseBoardTime(r.URL.Query().Get("at"), time.Now())
+}
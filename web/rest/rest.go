@@ -0,0 +1,348 @@
+// Package rest serves the versioned JSON API mounted at /api/v1.
+//
+//	GET /trains/{number}          real-time status, position, stops and stats (?origin=&date=)
+//	GET /trains/{number}/history  recorded delays, newest first (?origin=)
+//	GET /trains/{number}/stats    historical statistics (?origin=)
+//	GET /trains/{number}/timeline delay observations of a run, oldest first (?origin=&date=)
+//	GET /trains/{number}/platforms/{station}
+//	                              platforms used at a station, most used first (?origin=)
+//	GET /stations?q={query}       station search
+//	GET /stations/{code}          departure and arrival boards (?at=18:30)
+//	GET /rankings/delayed         most delayed trains (?days=30&limit=20)
+//	GET /rankings/reliable        most reliable trains (?days=30&limit=20)
+//
+// Response bodies are described by the types in types.go; errors always use
+// ErrorResponse. A number shared by several trains answers 409 with the
+// candidates to choose from.
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/service"
+)
+
+const (
+	defaultDays  = 30
+	defaultLimit = 20
+	maxDays      = 365
+	maxLimit     = 100
+)
+
+type API struct {
+	svc *service.Service
+}
+
+func New(svc *service.Service) *API {
+	return &API{svc: svc}
+}
+
+// Routes returns the router to mount at /api/v1
+func (a *API) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/trains/{number}", a.Train)
+	r.Get("/trains/{number}/history", a.TrainHistory)
+	r.Get("/trains/{number}/stats", a.TrainStats)
+	r.Get("/trains/{number}/timeline", a.TrainTimeline)
+	r.Get("/trains/{number}/platforms/{station}", a.TrainPlatforms)
+	r.Get("/stations", a.SearchStations)
+	r.Get("/stations/{code}", a.Station)
+	r.Get("/rankings/delayed", a.DelayedRankings)
+	r.Get("/rankings/reliable", a.ReliableRankings)
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, "bad_request", "method not allowed")
+	})
+
+	return r
+}
+
+// Train returns the real-time status of a train. When several trains share
+// the number, ?origin= picks one by its origin station code; ?date= selects
+// the run departing on another day.
+func (a *API) Train(w http.ResponseWriter, r *http.Request) {
+	ref, err := trainRef(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	result, err := a.svc.GetTrain(r.Context(), ref)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newTrainResponse(result))
+}
+
+// TrainHistory returns the recorded delays of a train; ?origin= keeps those
+// of the train departing from that station code
+func (a *API) TrainHistory(w http.ResponseWriter, r *http.Request) {
+	if !a.requireDatabase(w) {
+		return
+	}
+
+	ref, err := trainRef(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	records, err := a.svc.GetDelayHistory(r.Context(), ref)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	resp := make([]HistoryResponse, len(records))
+	for i, rec := range records {
+		resp[i] = newHistoryResponse(rec)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// TrainStats returns historical statistics for a train, restricted by
+// ?origin= as for TrainHistory
+func (a *API) TrainStats(w http.ResponseWriter, r *http.Request) {
+	if !a.requireDatabase(w) {
+		return
+	}
+
+	ref, err := trainRef(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	stats, err := a.svc.GetTrainStats(r.Context(), ref)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if stats == nil || stats.TotalTrips == 0 {
+		writeError(w, http.StatusNotFound, "not_found", "no statistics recorded for train "+ref.String())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newStatsResponse(stats))
+}
+
+// TrainTimeline returns how the delay of a train run evolved while it ran.
+// ?origin= and ?date= pick the run as for Train; the default is today's.
+func (a *API) TrainTimeline(w http.ResponseWriter, r *http.Request) {
+	if !a.requireDatabase(w) {
+		return
+	}
+
+	ref, err := trainRef(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	timeline, err := a.svc.GetDelayTimeline(r.Context(), ref)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	resp := make([]TimelineResponse, len(timeline))
+	for i, o := range timeline {
+		resp[i] = TimelineResponse{
+			ObservedAt:  o.ObservedAt,
+			Delay:       o.Delay,
+			LastStation: o.LastStation,
+			Status:      string(o.Status),
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// TrainPlatforms returns the platforms a train used at a station, restricted
+// by ?origin= as for TrainHistory
+func (a *API) TrainPlatforms(w http.ResponseWriter, r *http.Request) {
+	if !a.requireDatabase(w) {
+		return
+	}
+
+	ref, err := trainRef(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	usage, err := a.svc.GetPlatformUsage(r.Context(), ref, chi.URLParam(r, "station"))
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	resp := make([]PlatformResponse, len(usage))
+	for i, u := range usage {
+		resp[i] = PlatformResponse{
+			Platform: u.Platform,
+			Uses:     u.Uses,
+			Changes:  u.Changes,
+			Share:    u.Share,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// SearchStations searches stations by name
+func (a *API) SearchStations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if len(query) < 2 {
+		writeError(w, http.StatusBadRequest, "bad_request", "query parameter q must be at least 2 characters")
+		return
+	}
+
+	stations, err := a.svc.SearchStations(r.Context(), query)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	resp := make([]StationSummary, len(stations))
+	for i, s := range stations {
+		resp[i] = StationSummary{Code: s.Code, Name: s.Name}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Station returns the departure and arrival boards of a station, now or at
+// ?at= (HH:MM today or YYYY-MM-DDTHH:MM, Italian time)
+func (a *API) Station(w http.ResponseWriter, r *http.Request) {
+	at, err := domain.ParseBoardTime(r.URL.Query().Get("at"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	station, err := a.svc.GetStationAt(r.Context(), chi.URLParam(r, "code"), at)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newStationResponse(station))
+}
+
+// DelayedRankings returns the most delayed trains
+func (a *API) DelayedRankings(w http.ResponseWriter, r *http.Request) {
+	a.rankings(w, r, a.svc.GetMostDelayedTrains)
+}
+
+// ReliableRankings returns the most reliable trains
+func (a *API) ReliableRankings(w http.ResponseWriter, r *http.Request) {
+	a.rankings(w, r, a.svc.GetMostReliableTrains)
+}
+
+func (a *API) rankings(w http.ResponseWriter, r *http.Request, fetch func(context.Context, int, int) ([]service.TrainRanking, error)) {
+	if !a.requireDatabase(w) {
+		return
+	}
+
+	days, err := intParam(r, "days", defaultDays, maxDays)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	limit, err := intParam(r, "limit", defaultLimit, maxLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	trains, err := fetch(r.Context(), days, limit)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newRankingResponses(trains))
+}
+
+// trainRef reads the train run of a request: the number in the path, the
+// origin and the day in ?origin= and ?date=
+func trainRef(r *http.Request) (domain.TrainRef, error) {
+	date, err := domain.ParseDate(r.URL.Query().Get("date"), time.Now())
+	if err != nil {
+		return domain.TrainRef{}, err
+	}
+	return domain.TrainRef{
+		Number:     chi.URLParam(r, "number"),
+		OriginCode: r.URL.Query().Get("origin"),
+		Date:       date,
+	}, nil
+}
+
+func (a *API) requireDatabase(w http.ResponseWriter) bool {
+	if a.svc.HasDatabase() {
+		return true
+	}
+	writeError(w, http.StatusServiceUnavailable, "unavailable", "historical data is not available: no database configured")
+	return false
+}
+
+// intParam reads a positive integer query parameter no larger than max
+func intParam(r *http.Request, name string, def, max int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > max {
+		return 0, errors.New(name + " must be an integer between 1 and " + strconv.Itoa(max))
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("rest: encode response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, ErrorResponse{Error: ErrorBody{Code: code, Message: message}})
+}
+
+// writeUpstreamError maps a provider error to an HTTP status
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var ambiguous *api.AmbiguousTrainError
+	switch {
+	case errors.As(err, &ambiguous):
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: ErrorBody{
+			Code:       "ambiguous",
+			Message:    err.Error(),
+			Candidates: newTrainRefResponses(ambiguous.Candidates),
+		}})
+	case errors.Is(err, api.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, api.ErrUpstreamDown):
+		log.Printf("rest: upstream unavailable: %v", err)
+		writeError(w, http.StatusServiceUnavailable, "upstream_unavailable", "upstream provider unavailable")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "upstream_timeout", "upstream provider timed out")
+	default:
+		log.Printf("rest: upstream error: %v", err)
+		writeError(w, http.StatusBadGateway, "upstream_error", "upstream provider error")
+	}
+}
+
+func writeInternalError(w http.ResponseWriter, err error) {
+	log.Printf("rest: internal error: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal", "internal server error")
+}
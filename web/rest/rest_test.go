@@ -0,0 +1,218 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/api"
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/service"
+)
+
+type fakeClient struct {
+	train *domain.Train
+	err   error
+}
+
+func (f *fakeClient) GetTrain(ctx context.Context, trainNumber string) (*domain.Train, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.train, nil
+}
+
+func (f *fakeClient) GetStation(ctx context.Context, stationCode string) (*domain.Station, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &domain.Station{
+		Code: stationCode,
+		Name: "MILANO CENTRALE",
+		Departures: []domain.Departure{
+			{TrainNumber: "9311", TrainCategory: "FR", Destination: "ROMA TERMINI", Delay: 3, Status: domain.TrainStatusOnTime},
+		},
+	}, nil
+}
+
+func (f *fakeClient) SearchStation(ctx context.Context, query string) ([]domain.Station, error) {
+	return []domain.Station{{Code: "S01700", Name: "MILANO CENTRALE"}}, nil
+}
+
+func serve(t *testing.T, client api.TrainClient, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	h := New(service.New(client, nil)).Routes()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return v
+}
+
+func TestTrain(t *testing.T) {
+	dep := time.Date(2025, 1, 18, 7, 0, 0, 0, time.UTC)
+	client := &fakeClient{train: &domain.Train{
+		Number:        "9311",
+		Category:      "FR",
+		Origin:        "ROMA TERMINI",
+		Destination:   "MILANO CENTRALE",
+		DepartureTime: dep,
+		Delay:         4,
+		Status:        domain.TrainStatusOnTime,
+		Stops:         []domain.Stop{{StationCode: "S08409", StationName: "ROMA TERMINI", ScheduledDepart: dep}},
+	}}
+
+	rec := serve(t, client, "/trains/9311")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("content type = %q", ct)
+	}
+
+	resp := decode[TrainResponse](t, rec)
+	if resp.Number != "9311" || resp.Delay != 4 || resp.Status != "on_time" {
+		t.Errorf("unexpected train: %+v", resp)
+	}
+	if resp.DepartureTime == nil || !resp.DepartureTime.Equal(dep) {
+		t.Errorf("departure_time = %v, want %v", resp.DepartureTime, dep)
+	}
+	if resp.ArrivalTime != nil {
+		t.Error("unknown arrival_time should be omitted")
+	}
+	if len(resp.Stops) != 1 || resp.Stops[0].StationCode != "S08409" {
+		t.Errorf("unexpected stops: %+v", resp.Stops)
+	}
+	if resp.Position.NextStationCode != "S08409" || resp.Position.Progress != 0 {
+		t.Errorf("unexpected position: %+v", resp.Position)
+	}
+	if want := dep.Add(4 * time.Minute); resp.Stops[0].ExpectedDeparture == nil || !resp.Stops[0].ExpectedDeparture.Equal(want) {
+		t.Errorf("expected_departure = %v, want %v", resp.Stops[0].ExpectedDeparture, want)
+	}
+}
+
+func TestErrorStatuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		path     string
+		wantCode int
+		wantErr  string
+	}{
+		{"not found", fmt.Errorf("train 1: %w", api.ErrNotFound), "/trains/1", http.StatusNotFound, "not_found"},
+		{"timeout", fmt.Errorf("get train: %w", context.DeadlineExceeded), "/trains/1", http.StatusGatewayTimeout, "upstream_timeout"},
+		{"down", fmt.Errorf("get train: %w", &api.StatusError{Code: 503}), "/trains/1", http.StatusServiceUnavailable, "upstream_unavailable"},
+		{"parse", fmt.Errorf("parse station: %w: bad json", api.ErrParse), "/stations/S01700", http.StatusBadGateway, "upstream_error"},
+		{"upstream", errors.New("unexpected status: 500"), "/stations/S01700", http.StatusBadGateway, "upstream_error"},
+		{"bad date", nil, "/trains/1?date=20-01-2025", http.StatusBadRequest, "bad_request"},
+		{"bad time", nil, "/stations/S01700?at=6pm", http.StatusBadRequest, "bad_request"},
+		{"short query", nil, "/stations?q=a", http.StatusBadRequest, "bad_request"},
+		{"no database", nil, "/trains/1/history", http.StatusServiceUnavailable, "unavailable"},
+		{"timeline without database", nil, "/trains/1/timeline", http.StatusServiceUnavailable, "unavailable"},
+		{"rankings without database", nil, "/rankings/delayed", http.StatusServiceUnavailable, "unavailable"},
+		{"unknown endpoint", nil, "/nope", http.StatusNotFound, "not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, &fakeClient{err: tt.err}, tt.path)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			resp := decode[ErrorResponse](t, rec)
+			if resp.Error.Code != tt.wantErr {
+				t.Errorf("error code = %q, want %q", resp.Error.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAmbiguousTrain(t *testing.T) {
+	day := time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)
+	err := &api.AmbiguousTrainError{Number: "2345", Candidates: []domain.TrainRef{
+		{Number: "2345", OriginCode: "S01700", Origin: "MILANO CENTRALE", Date: day},
+		{Number: "2345", OriginCode: "S00219", Origin: "TORINO PORTA NUOVA", Date: day},
+	}}
+
+	rec := serve(t, &fakeClient{err: err}, "/trains/2345")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	resp := decode[ErrorResponse](t, rec)
+	if resp.Error.Code != "ambiguous" || len(resp.Error.Candidates) != 2 {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+	want := TrainRefResponse{Number: "2345", OriginCode: "S00219", Origin: "TORINO PORTA NUOVA", Date: "2025-01-20"}
+	if resp.Error.Candidates[1] != want {
+		t.Errorf("candidate = %+v, want %+v", resp.Error.Candidates[1], want)
+	}
+}
+
+func TestStation(t *testing.T) {
+	rec := serve(t, &fakeClient{}, "/stations/S01700")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	resp := decode[StationResponse](t, rec)
+	if resp.Code != "S01700" || len(resp.Departures) != 1 || resp.Arrivals == nil {
+		t.Errorf("unexpected station: %+v", resp)
+	}
+	if resp.Departures[0].TrainNumber != "9311" {
+		t.Errorf("unexpected departure: %+v", resp.Departures[0])
+	}
+}
+
+func TestSearchStations(t *testing.T) {
+	rec := serve(t, &fakeClient{}, "/stations?q=Milano")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	resp := decode[[]StationSummary](t, rec)
+	if len(resp) != 1 || resp[0].Code != "S01700" {
+		t.Errorf("unexpected results: %+v", resp)
+	}
+}
+
+func TestRankingResponses(t *testing.T) {
+	resp := newRankingResponses([]service.TrainRanking{
+		{TrainNumber: "9311", Origin: "MILANO CENTRALE", Destination: "ROMA TERMINI", TripCount: 10, OnTimeRate: 90},
+	})
+	if len(resp) != 1 || resp[0].Rank != 1 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	// The rate shares the 0-1 scale of the stats
+	if resp[0].OnTimeRate != 0.9 {
+		t.Errorf("OnTimeRate = %v, want 0.9", resp[0].OnTimeRate)
+	}
+
+	b, err := json.Marshal(resp[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"max_delay", "on_time_rate"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("%s missing from %s", key, b)
+		}
+	}
+}
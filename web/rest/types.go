@@ -0,0 +1,398 @@
+package rest
+
+import (
+	"time"
+
+	"github.com/emiliopalmerini/treni/internal/domain"
+	"github.com/emiliopalmerini/treni/internal/service"
+)
+
+// Response schemas for /api/v1. Field names are part of the public contract:
+// add fields freely, but never rename or remove them. Times are RFC 3339 and
+// omitted when unknown; delays are in minutes.
+
+// ErrorResponse is returned with every non-2xx status
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	// Code is a stable machine-readable identifier: bad_request, not_found,
+	// ambiguous, upstream_error, upstream_timeout, upstream_unavailable,
+	// unavailable or internal
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Candidates lists the trains sharing the number with code ambiguous;
+	// repeat the request with one of their origin codes
+	Candidates []TrainRefResponse `json:"candidates,omitempty"`
+}
+
+// TrainRefResponse identifies one of several trains sharing a number
+type TrainRefResponse struct {
+	Number     string `json:"number"`
+	OriginCode string `json:"origin_code"`
+	Origin     string `json:"origin,omitempty"`
+	Date       string `json:"date,omitempty"` // YYYY-MM-DD
+}
+
+// TrainResponse is returned by GET /api/v1/trains/{number}
+type TrainResponse struct {
+	Number        string         `json:"number"`
+	Category      string         `json:"category"`
+	Origin        string         `json:"origin"`
+	OriginCode    string         `json:"origin_code,omitempty"`
+	Destination   string         `json:"destination"`
+	DepartureTime *time.Time     `json:"departure_time,omitempty"`
+	ArrivalTime   *time.Time     `json:"arrival_time,omitempty"`
+	Delay         int            `json:"delay"`
+	Status        string         `json:"status"` // see TrainStatus in internal/domain
+	LastUpdate    *time.Time     `json:"last_update,omitempty"`
+	Source        string         `json:"source,omitempty"`
+	Stops         []StopResponse `json:"stops"`
+	Stats         *StatsResponse `json:"stats,omitempty"`
+
+	Position PositionResponse `json:"position"`
+}
+
+// PositionResponse is where the train is at the time of the response
+type PositionResponse struct {
+	LastStation     string     `json:"last_station,omitempty"` // empty before departure
+	LastSeen        *time.Time `json:"last_seen,omitempty"`
+	NextStationCode string     `json:"next_station_code,omitempty"`
+	NextStationName string     `json:"next_station_name,omitempty"` // empty once arrived
+	Progress        int        `json:"progress"`                    // 0-100
+}
+
+type StopResponse struct {
+	StationCode        string     `json:"station_code"`
+	StationName        string     `json:"station_name"`
+	ScheduledArrival   *time.Time `json:"scheduled_arrival,omitempty"`
+	ActualArrival      *time.Time `json:"actual_arrival,omitempty"`
+	ScheduledDeparture *time.Time `json:"scheduled_departure,omitempty"`
+	ActualDeparture    *time.Time `json:"actual_departure,omitempty"`
+	ArrivalDelay       int        `json:"arrival_delay"`
+	DepartureDelay     int        `json:"departure_delay"`
+	Platform           string     `json:"platform,omitempty"`
+	PlatformConfirmed  bool       `json:"platform_confirmed"`
+	PlatformChanged    bool       `json:"platform_changed"`
+	Cancelled          bool       `json:"cancelled"`
+	// Expected times are the scheduled ones shifted by the train's current
+	// delay, given for the stops not reached yet
+	ExpectedArrival   *time.Time `json:"expected_arrival,omitempty"`
+	ExpectedDeparture *time.Time `json:"expected_departure,omitempty"`
+}
+
+// StationResponse is returned by GET /api/v1/stations/{code}
+type StationResponse struct {
+	Code       string              `json:"code"`
+	Name       string              `json:"name"`
+	City       string              `json:"city,omitempty"`
+	Region     string              `json:"region,omitempty"`
+	Latitude   float64             `json:"latitude,omitempty"`
+	Longitude  float64             `json:"longitude,omitempty"`
+	Departures []DepartureResponse `json:"departures"`
+	Arrivals   []ArrivalResponse   `json:"arrivals"`
+}
+
+type DepartureResponse struct {
+	TrainNumber   string     `json:"train_number"`
+	TrainCategory string     `json:"train_category"`
+	OriginCode    string     `json:"origin_code,omitempty"`
+	Destination   string     `json:"destination"`
+	ScheduledTime *time.Time `json:"scheduled_time,omitempty"`
+	Delay         int        `json:"delay"`
+	Platform      string     `json:"platform,omitempty"`
+	Status        string     `json:"status"`
+	// ScheduledPlatform is set when the train was moved to another platform
+	ScheduledPlatform string `json:"scheduled_platform,omitempty"`
+}
+
+type ArrivalResponse struct {
+	TrainNumber   string     `json:"train_number"`
+	TrainCategory string     `json:"train_category"`
+	Origin        string     `json:"origin"`
+	OriginCode    string     `json:"origin_code,omitempty"`
+	ScheduledTime *time.Time `json:"scheduled_time,omitempty"`
+	Delay         int        `json:"delay"`
+	Platform      string     `json:"platform,omitempty"`
+	Status        string     `json:"status"`
+	// ScheduledPlatform is set when the train was moved to another platform
+	ScheduledPlatform string `json:"scheduled_platform,omitempty"`
+}
+
+// StationSummary is an element of GET /api/v1/stations?q=
+type StationSummary struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// HistoryResponse is an element of GET /api/v1/trains/{number}/history
+type HistoryResponse struct {
+	Date          string     `json:"date"` // YYYY-MM-DD
+	OriginCode    string     `json:"origin_code"`
+	TrainCategory string     `json:"train_category,omitempty"`
+	Origin        string     `json:"origin"`
+	Destination   string     `json:"destination"`
+	Delay         int        `json:"delay"`
+	Cancelled     bool       `json:"cancelled"`
+	Status        string     `json:"status,omitempty"`
+	Source        string     `json:"source,omitempty"`
+	RecordedAt    *time.Time `json:"recorded_at,omitempty"`
+
+	// Observed runs are known only from station boards
+	Observed bool `json:"observed,omitempty"`
+	// Completeness is not_departed or en_route for provisional records,
+	// arrived for final ones; empty for records older than the distinction
+	Completeness string `json:"completeness,omitempty"`
+}
+
+// StatsResponse is returned by GET /api/v1/trains/{number}/stats
+type StatsResponse struct {
+	TrainNumber    string  `json:"train_number"`
+	TotalTrips     int     `json:"total_trips"`
+	OnTimeTrips    int     `json:"on_time_trips"`
+	DelayedTrips   int     `json:"delayed_trips"`
+	CancelledTrips int     `json:"cancelled_trips"`
+	AverageDelay   float64 `json:"average_delay"`
+	MaxDelay       int     `json:"max_delay"`
+	OnTimeRate     float64 `json:"on_time_rate"` // 0-1
+
+	PartiallyCancelledTrips int `json:"partially_cancelled_trips"`
+	ReroutedTrips           int `json:"rerouted_trips"`
+	ProvisionalTrips        int `json:"provisional_trips"` // recorded before arrival, not counted above
+	OnTimeThreshold         int `json:"on_time_threshold"` // minutes late still counted on time
+
+	// Spread of the delays of the trips that ran, in minutes
+	P50Delay    int              `json:"p50_delay"`
+	P80Delay    int              `json:"p80_delay"`
+	P95Delay    int              `json:"p95_delay"`
+	DelayStdDev float64          `json:"delay_stddev"`
+	Histogram   []BucketResponse `json:"histogram"`
+}
+
+// BucketResponse counts the trips with a delay over min and up to max
+// minutes; max is omitted for the last, open-ended bucket
+type BucketResponse struct {
+	Label string `json:"label"` // such as 5-15 or 60+
+	Min   int    `json:"min"`
+	Max   int    `json:"max,omitempty"`
+	Trips int    `json:"trips"`
+}
+
+// TimelineResponse is an element of GET /api/v1/trains/{number}/timeline
+type TimelineResponse struct {
+	ObservedAt  time.Time `json:"observed_at"`
+	Delay       int       `json:"delay"`
+	LastStation string    `json:"last_station,omitempty"`
+	Status      string    `json:"status,omitempty"`
+}
+
+// PlatformResponse is an element of GET /api/v1/trains/{number}/platforms/{station}
+type PlatformResponse struct {
+	Platform string  `json:"platform"`
+	Uses     int     `json:"uses"`
+	Changes  int     `json:"changes"` // uses replacing another timetabled platform
+	Share    float64 `json:"share"`   // 0-1
+}
+
+// RankingResponse is an element of GET /api/v1/rankings/{delayed,reliable}
+type RankingResponse struct {
+	Rank        int     `json:"rank"`
+	TrainNumber string  `json:"train_number"`
+	OriginCode  string  `json:"origin_code,omitempty"`
+	Category    string  `json:"category,omitempty"`
+	Origin      string  `json:"origin"`
+	Destination string  `json:"destination"`
+	TripCount   int     `json:"trip_count"`
+	AvgDelay    float64 `json:"avg_delay"`
+	MaxDelay    int     `json:"max_delay"`    // delayed only
+	OnTimeRate  float64 `json:"on_time_rate"` // 0-1, reliable only
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func newTrainRefResponses(refs []domain.TrainRef) []TrainRefResponse {
+	resp := make([]TrainRefResponse, len(refs))
+	for i, ref := range refs {
+		resp[i] = TrainRefResponse{
+			Number:     ref.Number,
+			OriginCode: ref.OriginCode,
+			Origin:     ref.Origin,
+		}
+		if !ref.Date.IsZero() {
+			resp[i].Date = ref.Date.Format(time.DateOnly)
+		}
+	}
+	return resp
+}
+
+func newTrainResponse(result *service.TrainResult) TrainResponse {
+	t := result.Train
+	resp := TrainResponse{
+		Number:        t.Number,
+		Category:      t.Category,
+		Origin:        t.Origin,
+		OriginCode:    t.OriginCode,
+		Destination:   t.Destination,
+		DepartureTime: timePtr(t.DepartureTime),
+		ArrivalTime:   timePtr(t.ArrivalTime),
+		Delay:         t.Delay,
+		Status:        string(t.Status),
+		LastUpdate:    timePtr(t.LastUpdate),
+		Source:        t.Source,
+		Stops:         make([]StopResponse, len(t.Stops)),
+	}
+	for i, s := range t.Stops {
+		resp.Stops[i] = StopResponse{
+			StationCode:        s.StationCode,
+			StationName:        s.StationName,
+			ScheduledArrival:   timePtr(s.ScheduledArrival),
+			ActualArrival:      timePtr(s.ActualArrival),
+			ScheduledDeparture: timePtr(s.ScheduledDepart),
+			ActualDeparture:    timePtr(s.ActualDepart),
+			ArrivalDelay:       s.ArrivalDelay,
+			DepartureDelay:     s.DepartureDelay,
+			Platform:           s.Platform,
+			PlatformConfirmed:  s.PlatformConfirmed,
+			PlatformChanged:    s.PlatformChanged(),
+			Cancelled:          s.Cancelled,
+		}
+	}
+	if result.Stats != nil {
+		stats := newStatsResponse(result.Stats)
+		resp.Stats = &stats
+	}
+
+	pos := t.Position(time.Now())
+	resp.Position = PositionResponse{
+		LastStation: pos.LastStation,
+		LastSeen:    timePtr(pos.LastSeen),
+		Progress:    pos.Progress,
+	}
+	for i, e := range pos.Remaining {
+		if i == 0 {
+			resp.Position.NextStationCode = e.StationCode
+			resp.Position.NextStationName = e.StationName
+		}
+		resp.Stops[e.Stop].ExpectedArrival = timePtr(e.Arrival)
+		resp.Stops[e.Stop].ExpectedDeparture = timePtr(e.Departure)
+	}
+	return resp
+}
+
+func newStationResponse(st *domain.Station) StationResponse {
+	resp := StationResponse{
+		Code:       st.Code,
+		Name:       st.Name,
+		City:       st.City,
+		Region:     st.Region,
+		Latitude:   st.Latitude,
+		Longitude:  st.Longitude,
+		Departures: make([]DepartureResponse, len(st.Departures)),
+		Arrivals:   make([]ArrivalResponse, len(st.Arrivals)),
+	}
+	for i, d := range st.Departures {
+		resp.Departures[i] = DepartureResponse{
+			TrainNumber:   d.TrainNumber,
+			TrainCategory: d.TrainCategory,
+			OriginCode:    d.OriginCode,
+			Destination:   d.Destination,
+			ScheduledTime: timePtr(d.ScheduledTime),
+			Delay:         d.Delay,
+			Platform:      d.Platform,
+			Status:        string(d.Status),
+		}
+		if d.PlatformChanged() {
+			resp.Departures[i].ScheduledPlatform = d.ScheduledPlatform
+		}
+	}
+	for i, a := range st.Arrivals {
+		resp.Arrivals[i] = ArrivalResponse{
+			TrainNumber:   a.TrainNumber,
+			TrainCategory: a.TrainCategory,
+			Origin:        a.Origin,
+			OriginCode:    a.OriginCode,
+			ScheduledTime: timePtr(a.ScheduledTime),
+			Delay:         a.Delay,
+			Platform:      a.Platform,
+			Status:        string(a.Status),
+		}
+		if a.PlatformChanged() {
+			resp.Arrivals[i].ScheduledPlatform = a.ScheduledPlatform
+		}
+	}
+	return resp
+}
+
+func newStatsResponse(s *domain.TrainStats) StatsResponse {
+	return StatsResponse{
+		TrainNumber:    s.TrainNumber,
+		TotalTrips:     s.TotalTrips,
+		OnTimeTrips:    s.OnTimeTrips,
+		DelayedTrips:   s.DelayedTrips,
+		CancelledTrips: s.CancelledTrips,
+		AverageDelay:   s.AverageDelay,
+		MaxDelay:       s.MaxDelay,
+		OnTimeRate:     s.OnTimeRate,
+
+		PartiallyCancelledTrips: s.PartiallyCancelledTrips,
+		ReroutedTrips:           s.ReroutedTrips,
+		ProvisionalTrips:        s.ProvisionalTrips,
+		OnTimeThreshold:         s.OnTimeThreshold,
+
+		P50Delay:    s.P50Delay,
+		P80Delay:    s.P80Delay,
+		P95Delay:    s.P95Delay,
+		DelayStdDev: s.DelayStdDev,
+		Histogram:   newBucketResponses(s.Histogram),
+	}
+}
+
+func newBucketResponses(buckets []domain.DelayBucket) []BucketResponse {
+	resp := make([]BucketResponse, len(buckets))
+	for i, b := range buckets {
+		resp[i] = BucketResponse{Label: b.Label(), Min: b.Min, Max: b.Max, Trips: b.Trips}
+	}
+	return resp
+}
+
+func newHistoryResponse(r domain.DelayRecord) HistoryResponse {
+	return HistoryResponse{
+		Date:          r.Date.Format("2006-01-02"),
+		OriginCode:    r.OriginCode,
+		TrainCategory: r.TrainCategory,
+		Origin:        r.Origin,
+		Destination:   r.Destination,
+		Delay:         r.Delay,
+		Cancelled:     r.Cancelled,
+		Status:        string(r.Status),
+		Source:        r.Source,
+		RecordedAt:    timePtr(r.RecordedAt),
+		Observed:      r.Observed,
+		Completeness:  string(r.Completeness),
+	}
+}
+
+func newRankingResponses(trains []service.TrainRanking) []RankingResponse {
+	resp := make([]RankingResponse, len(trains))
+	for i, t := range trains {
+		resp[i] = RankingResponse{
+			Rank:        i + 1,
+			TrainNumber: t.TrainNumber,
+			OriginCode:  t.OriginCode,
+			Category:    t.Category,
+			Origin:      t.Origin,
+			Destination: t.Destination,
+			TripCount:   t.TripCount,
+			AvgDelay:    t.AvgDelay,
+			MaxDelay:    t.MaxDelay,
+			OnTimeRate:  t.OnTimeRate / 100,
+		}
+	}
+	return resp
+}